@@ -1,12 +1,18 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
+	"os"
 
+	"github.com/gratten/ownpath/internal/config"
 	"github.com/gratten/ownpath/internal/db"
 	"github.com/gratten/ownpath/internal/handlers" // Adjust based on your module name
-	// Adjust based on your module name
+	"github.com/gratten/ownpath/web"
 )
 
 // Global error handler middleware (wraps all handlers)
@@ -37,42 +43,172 @@ func loggingMiddleware(next http.Handler) http.Handler {
 // }
 
 func main() {
-	// Initialize the database (this creates/opens ownpath.db and sets up the schema)
-	if err := db.InitDB("./ownpath.db"); err != nil { // Adjust path if needed (e.g., for Docker/Start9)
+	// Settings come from flags, OWNPATH_* environment variables and an optional YAML file
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		config.PrintUsage(os.Stdout)
+		return
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n", err)
+		config.PrintUsage(os.Stderr)
+		os.Exit(2)
+	}
+	if cfg.File != "" {
+		log.Printf("Configuration loaded from %s", cfg.File)
+	}
+	handlers.Configure(cfg)
+
+	// Initialize the database (this creates/opens ownpath.db in the data directory and sets up the schema)
+	if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil {
+		log.Fatalf("Failed to create data directory: %v", err)
+	}
+	if err := db.InitDB(cfg.DBPath()); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err) // Crash if init fails
 	}
 	defer db.CloseDB() // Ensure the DB closes cleanly on exit
 
-	// Serve static files from /web (no redirect; directly serve index.html at root)
-	fs := http.FileServer(http.Dir("./web"))
+	if cfg.Backup.Dir != "" {
+		if err := handlers.SetBackupDir(cfg.Backup.Dir, cfg.Backup.KeepDaily, cfg.Backup.KeepWeekly); err != nil {
+			log.Fatalf("Invalid backup directory: %v", err)
+		}
+	}
+
+	// Backup and restore commands run against the database and exit. A backup is safe
+	// while a server runs on the same database; a restore is not picked up by its
+	// background workers, so restart the server afterwards, or restore into a running
+	// instance from its admin page instead
+	if len(args) > 0 {
+		switch {
+		case args[0] == "backup" && len(args) == 1:
+			path, err := handlers.CreateBackup()
+			if err != nil {
+				log.Fatalf("Backup failed: %v", err)
+			}
+			fmt.Println(path)
+		case args[0] == "restore" && len(args) == 2:
+			if err := handlers.RestoreBackup(args[1]); err != nil {
+				log.Fatalf("Restore failed: %v", err)
+			}
+			log.Printf("Restart any server running on %s so it recomputes the training load", cfg.DBPath())
+		default:
+			config.PrintUsage(os.Stderr)
+			os.Exit(2)
+		}
+		return
+	}
+
+	// Correct track altitudes from local terrain tiles when the user provides them
+	if cfg.DEMDir != "" {
+		if err := handlers.SetDEMDir(cfg.DEMDir); err != nil {
+			log.Fatalf("Invalid DEM directory: %v", err)
+		}
+		handlers.StartDEMWorker()
+		log.Printf("Elevation correction enabled with tiles from %s", cfg.DEMDir)
+	}
+
+	// Serve the base map from a local tile file so maps work offline and over Tor
+	if cfg.TileFile != "" {
+		if err := handlers.SetTileFile(cfg.TileFile); err != nil {
+			log.Fatalf("Invalid tile file: %v", err)
+		}
+		log.Printf("Serving map tiles from %s", cfg.TileFile)
+	}
+
+	// Keep the fitness/fatigue series current as activities change, and the zones and
+	// power scores as the heart-rate profile and FTP histories do; analyze restored
+	// accounts in the background too
+	handlers.StartTrainingLoadWorker()
+	handlers.StartZonesWorker()
+	handlers.StartPowerWorker()
+	handlers.StartRestoreWorker()
+
+	// Snapshot the database on a schedule, rotating old snapshots out
+	if cfg.Backup.Dir != "" && cfg.Backup.Interval > 0 {
+		handlers.StartBackupWorker(cfg.Backup.Interval)
+		log.Printf("Backing up to %s every %s", cfg.Backup.Dir, cfg.Backup.Interval)
+	}
+
+	// Serve the pages and vendored assets embedded in the binary, or from disk with -web-dir
+	var webFS fs.FS = web.FS
+	if cfg.WebDir != "" {
+		webFS = os.DirFS(cfg.WebDir)
+		log.Printf("Serving web assets from %s", cfg.WebDir)
+	}
+	static := http.FileServerFS(webFS)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/" || r.URL.Path == "/index.html" {
 			// Directly serve index.html for root or explicit /index.html (avoids any loop)
-			http.ServeFile(w, r, "./web/index.html")
+			http.ServeFileFS(w, r, webFS, "index.html")
 			return
 		}
 		// Serve other files (strips leading /)
-		http.StripPrefix("/", fs).ServeHTTP(w, r)
+		http.StripPrefix("/", static).ServeHTTP(w, r)
 	})
 
 	// Set up routes with logging and error handling
 	// http.HandleFunc("/health", withLoggingAndErrorHandling(handlers.HealthHandler))
 	http.HandleFunc("/api/activities", withLoggingAndErrorHandling(handlers.ActivitiesHandler))
+	http.HandleFunc("GET /api/activities/{id}/thumbnail.png", withLoggingAndErrorHandling(handlers.ThumbnailHandler))
+	http.HandleFunc("GET /api/activities/{id}/track", withLoggingAndErrorHandling(handlers.TrackHandler))
+	http.HandleFunc("GET /api/share/{token}/track", withLoggingAndErrorHandling(handlers.SharedTrackHandler))
+	http.HandleFunc("GET /api/activities/{id}/export.gpx", withLoggingAndErrorHandling(handlers.ExportGPXHandler))
+	http.HandleFunc("GET /api/activities/{id}/export.tcx", withLoggingAndErrorHandling(handlers.ExportTCXHandler))
+	http.HandleFunc("GET /api/activities/{id}/export.fit", withLoggingAndErrorHandling(handlers.ExportFITHandler))
+	http.HandleFunc("GET /api/activities/{id}/export.geojson", withLoggingAndErrorHandling(handlers.ExportGeoJSONHandler))
+	http.HandleFunc("GET /api/activities/{id}/export.kml", withLoggingAndErrorHandling(handlers.ExportKMLHandler))
+	http.HandleFunc("GET /api/activities/{id}/export.csv", withLoggingAndErrorHandling(handlers.ExportCSVHandler))
+	http.HandleFunc("GET /api/export", withLoggingAndErrorHandling(handlers.ExportActivitiesHandler))
+	http.HandleFunc("GET /api/account/export", withLoggingAndErrorHandling(handlers.AccountExportHandler))
+	http.HandleFunc("/api/account/import", withLoggingAndErrorHandling(handlers.AccountImportHandler))
+	http.HandleFunc("/api/admin/backups", withLoggingAndErrorHandling(handlers.BackupsHandler))
+	http.HandleFunc("/api/admin/backups/restore", withLoggingAndErrorHandling(handlers.BackupRestoreHandler))
 	http.HandleFunc("/api/activity", handlers.ActivityHandler) // Ensure this line exists!
+	http.HandleFunc("/api/activity/splits", withLoggingAndErrorHandling(handlers.SplitsHandler))
+	http.HandleFunc("/api/climbs/efforts", withLoggingAndErrorHandling(handlers.ClimbEffortsHandler))
+	http.HandleFunc("GET /tiles/{z}/{x}/{y}", withLoggingAndErrorHandling(handlers.TileHandler))
+	http.HandleFunc("/api/map-config", withLoggingAndErrorHandling(handlers.MapConfigHandler))
+	http.HandleFunc("/api/config", withLoggingAndErrorHandling(handlers.ConfigHandler))
+	http.HandleFunc("/api/activity/streams", withLoggingAndErrorHandling(handlers.StreamsHandler))
+	http.HandleFunc("/api/activity/charts", withLoggingAndErrorHandling(handlers.ActivityChartsHandler))
+	http.HandleFunc("/api/activity/public", withLoggingAndErrorHandling(handlers.PublicActivityHandler))
+	http.HandleFunc("/api/settings", withLoggingAndErrorHandling(handlers.SettingsHandler))
+	http.HandleFunc("/api/hr-profiles", withLoggingAndErrorHandling(handlers.HRProfilesHandler))
+	http.HandleFunc("/api/zones/weekly", withLoggingAndErrorHandling(handlers.WeeklyZonesHandler))
+	http.HandleFunc("/api/ftp", withLoggingAndErrorHandling(handlers.FTPHandler))
+	http.HandleFunc("/api/power-curve", withLoggingAndErrorHandling(handlers.PowerCurveHandler))
+	http.HandleFunc("/api/training-load", withLoggingAndErrorHandling(handlers.TrainingLoadHandler))
+	http.HandleFunc("/api/training-load/chart", withLoggingAndErrorHandling(handlers.TrainingLoadChartHandler))
+	http.HandleFunc("/api/dem", withLoggingAndErrorHandling(handlers.DEMHandler))
+	http.HandleFunc("/api/privacy-zones", withLoggingAndErrorHandling(handlers.PrivacyZonesHandler))
+	http.HandleFunc("/api/personal-records", withLoggingAndErrorHandling(handlers.PersonalRecordsHandler))
 	// http.HandleFunc("/api/sync", withLoggingAndErrorHandling(handlers.SyncHandler))
 	http.HandleFunc("/api/upload", handlers.UploadHandler)
 
+	// Optional features are only routed when switched on
+	if cfg.Features.Segments {
+		http.HandleFunc("/api/segments", withLoggingAndErrorHandling(handlers.SegmentsHandler))
+		http.HandleFunc("/api/segments/backfill", withLoggingAndErrorHandling(handlers.SegmentBackfillHandler))
+		http.HandleFunc("/api/segments/leaderboard", withLoggingAndErrorHandling(handlers.SegmentLeaderboardHandler))
+	}
+	if cfg.Features.Routes {
+		handlers.StartRoutesWorker()
+		http.HandleFunc("/api/routes", withLoggingAndErrorHandling(handlers.RoutesHandler))
+		http.HandleFunc("/api/routes/detail", withLoggingAndErrorHandling(handlers.RouteDetailHandler))
+		http.HandleFunc("/api/routes/merge", withLoggingAndErrorHandling(handlers.RouteMergeHandler))
+		http.HandleFunc("/api/routes/split", withLoggingAndErrorHandling(handlers.RouteSplitHandler))
+		http.HandleFunc("/api/routes/recluster", withLoggingAndErrorHandling(handlers.RouteReclusterHandler))
+	}
+	if cfg.Features.Heatmap {
+		http.HandleFunc("GET /api/heatmap/{z}/{x}/{y}", withLoggingAndErrorHandling(handlers.HeatmapTileHandler))
+		http.HandleFunc("/api/heatmap/rebuild", withLoggingAndErrorHandling(handlers.HeatmapRebuildHandler))
+	}
+
 	// Apply logging middleware to the default mux
 	loggedMux := loggingMiddleware(http.DefaultServeMux)
 
 	// Start the server
-	// port := ":8080" // Default port; can be configured later for Start9
-	// log.Printf("Starting server on %s", port)
-	// if err := http.ListenAndServe(port, nil); err != nil {
-	// 	log.Fatalf("Server failed to start: %v", err)
-	// }
-	log.Println("Server starting on :8080")
-	if err := http.ListenAndServe(":8080", loggedMux); err != nil {
+	log.Printf("Server starting on %s", cfg.Listen)
+	if err := http.ListenAndServe(cfg.Listen, loggedMux); err != nil {
 		log.Fatal(err)
 	}
 
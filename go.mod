@@ -6,4 +6,5 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/mattn/go-sqlite3 v1.14.32
 	github.com/muktihari/fit v0.25.1
+	gopkg.in/yaml.v3 v3.0.1
 )
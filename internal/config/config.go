@@ -0,0 +1,208 @@
+// Package config loads the server configuration from, in increasing precedence, the
+// built-in defaults, an optional YAML file, OWNPATH_* environment variables and
+// command-line flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// Config is the server configuration. The YAML keys are also those of the Start9
+// config spec (assets/compat/config_spec.yaml).
+type Config struct {
+	File string `yaml:"-"` // YAML file the configuration was read from, if any
+
+	DataDir     string `yaml:"data_dir"`        // holds ownpath.db and, by default, the backups
+	Listen      string `yaml:"listen"`          // address the HTTP server listens on
+	BaseURL     string `yaml:"base_url"`        // public URL of the instance, for absolute links
+	UploadLimit int64  `yaml:"upload_limit_mb"` // largest accepted activity file, in MB
+	Units       string `yaml:"units"`           // unit system until the user picks one in the settings
+
+	DEMDir   string `yaml:"dem_dir"`   // SRTM .hgt tiles for elevation correction
+	TileFile string `yaml:"tile_file"` // MBTiles or PMTiles base map
+	WebDir   string `yaml:"web_dir"`   // web assets to serve instead of the embedded copy
+
+	Backup   Backup   `yaml:"backup"`
+	Features Features `yaml:"features"`
+}
+
+// Backup configures the scheduled database snapshots.
+type Backup struct {
+	Dir        string        `yaml:"dir"`      // relative paths are inside the data directory; empty disables backups
+	Interval   time.Duration `yaml:"interval"` // 0 for manual backups only
+	KeepDaily  int           `yaml:"keep_daily"`
+	KeepWeekly int           `yaml:"keep_weekly"`
+}
+
+// Features switches optional parts of OwnPath on and off. A switched-off feature is
+// hidden, but its data is kept current for when it is switched back on.
+type Features struct {
+	Heatmap    bool `yaml:"heatmap" json:"heatmap"`         // personal heatmap tiles
+	Routes     bool `yaml:"routes" json:"routes"`           // grouping activities by the path they follow
+	Segments   bool `yaml:"segments" json:"segments"`       // user-defined segments and leaderboards
+	OnlineMaps bool `yaml:"online_maps" json:"online_maps"` // OpenStreetMap tiles when no local tile file is set
+}
+
+// Default returns the configuration used when nothing is set: the database in the
+// working directory, the server on port 8080 and no backups, as before configuration
+// existed. Setting a backup directory turns on the schedule and retention below.
+func Default() Config {
+	return Config{
+		DataDir:     ".",
+		Listen:      ":8080",
+		UploadLimit: 10,
+		Units:       utils.UnitsMetric,
+		Backup: Backup{
+			Dir:        "",
+			Interval:   24 * time.Hour,
+			KeepDaily:  7,
+			KeepWeekly: 4,
+		},
+		Features: Features{Heatmap: true, Routes: true, Segments: true, OnlineMaps: true},
+	}
+}
+
+// newFlagSet defines the command-line flags, writing into c.
+func newFlagSet(c *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("ownpath", flag.ContinueOnError)
+	fs.StringVar(&c.File, "config", c.File, "YAML configuration file")
+	fs.StringVar(&c.DataDir, "data-dir", c.DataDir, "directory for the database and backups")
+	fs.StringVar(&c.Listen, "listen", c.Listen, "address to listen on")
+	fs.StringVar(&c.BaseURL, "base-url", c.BaseURL, "public URL of this instance, e.g. https://ownpath.example.org (optional)")
+	fs.Int64Var(&c.UploadLimit, "upload-limit-mb", c.UploadLimit, "largest accepted activity file in MB")
+	fs.StringVar(&c.Units, "units", c.Units, "default unit system, metric or imperial")
+	fs.StringVar(&c.DEMDir, "dem-dir", c.DEMDir, "directory of SRTM .hgt tiles for offline elevation correction (optional)")
+	fs.StringVar(&c.TileFile, "tiles", c.TileFile, "MBTiles or PMTiles file to serve as the base map under /tiles (optional)")
+	fs.StringVar(&c.WebDir, "web-dir", c.WebDir, "serve web assets from this directory instead of the embedded copy (for development)")
+	fs.StringVar(&c.Backup.Dir, "backup-dir", c.Backup.Dir, "directory for database snapshots, relative to the data directory (empty disables backups)")
+	fs.DurationVar(&c.Backup.Interval, "backup-interval", c.Backup.Interval, "how often to snapshot the database (0 for manual backups only)")
+	fs.IntVar(&c.Backup.KeepDaily, "backup-keep-daily", c.Backup.KeepDaily, "number of daily snapshots to keep")
+	fs.IntVar(&c.Backup.KeepWeekly, "backup-keep-weekly", c.Backup.KeepWeekly, "number of weekly snapshots to keep")
+	fs.BoolVar(&c.Features.Heatmap, "heatmap", c.Features.Heatmap, "enable the personal heatmap")
+	fs.BoolVar(&c.Features.Routes, "routes", c.Features.Routes, "enable route clustering")
+	fs.BoolVar(&c.Features.Segments, "segments", c.Features.Segments, "enable segments and leaderboards")
+	fs.BoolVar(&c.Features.OnlineMaps, "online-maps", c.Features.OnlineMaps, "load OpenStreetMap tiles when no local tile file is set")
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// envName is the environment variable for a flag: -backup-dir is OWNPATH_BACKUP_DIR.
+func envName(flagName string) string {
+	return "OWNPATH_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// PrintUsage describes the command line, flags and environment variables.
+func PrintUsage(w io.Writer) {
+	c := Default()
+	fs := newFlagSet(&c)
+	fs.SetOutput(w)
+	fmt.Fprintf(w, "Usage: ownpath [flags] [backup | restore SNAPSHOT]\n\n")
+	fmt.Fprintf(w, "Every flag can also be set in the -config YAML file or as an environment variable\n")
+	fmt.Fprintf(w, "named after it (-data-dir as %s).\n\n", envName("data-dir"))
+	fmt.Fprintf(w, "Restart a server running on the same data directory after a restore, or restore\n")
+	fmt.Fprintf(w, "from its admin page instead.\n\nFlags:\n")
+	fs.PrintDefaults()
+}
+
+// Load builds the configuration from the command-line arguments (without the program
+// name), the environment and the YAML file named by -config or OWNPATH_CONFIG. It
+// returns the arguments left after the flags. Asking for -help returns flag.ErrHelp.
+func Load(args []string) (*Config, []string, error) {
+	// A first pass only finds the file; values are applied below in precedence order
+	probe := Default()
+	probe.File = os.Getenv(envName("config"))
+	if err := newFlagSet(&probe).Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	c := Default()
+	if probe.File != "" {
+		if err := c.loadFile(probe.File); err != nil {
+			return nil, nil, err
+		}
+	}
+	fs := newFlagSet(&c)
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if v, ok := os.LookupEnv(envName(f.Name)); ok && f.Name != "config" {
+			if err := fs.Set(f.Name, v); err != nil && envErr == nil {
+				envErr = fmt.Errorf("invalid %s: %w", envName(f.Name), err)
+			}
+		}
+	})
+	if envErr != nil {
+		return nil, nil, envErr
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	c.File = probe.File
+
+	if err := c.validate(); err != nil {
+		return nil, nil, err
+	}
+	return &c, fs.Args(), nil
+}
+
+// loadFile reads a YAML configuration file over c. Unknown keys are errors, so typos
+// don't silently fall back to defaults.
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return nil
+}
+
+// validate checks the values and normalizes the base URL and backup directory.
+func (c *Config) validate() error {
+	if c.DataDir == "" {
+		return fmt.Errorf("data directory must not be empty")
+	}
+	if c.Listen == "" {
+		return fmt.Errorf("listen address must not be empty")
+	}
+	if c.UploadLimit <= 0 {
+		return fmt.Errorf("upload limit must be positive, got %d MB", c.UploadLimit)
+	}
+	if !utils.ValidUnits(c.Units) {
+		return fmt.Errorf("invalid units %q: must be metric or imperial", c.Units)
+	}
+	if c.BaseURL != "" {
+		u, err := url.Parse(c.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid base URL %q: must be an absolute http(s) URL", c.BaseURL)
+		}
+		c.BaseURL = strings.TrimRight(c.BaseURL, "/")
+	}
+	if c.Backup.Interval < 0 || c.Backup.KeepDaily < 0 || c.Backup.KeepWeekly < 0 {
+		return fmt.Errorf("backup interval and retention must not be negative")
+	}
+	if c.Backup.Dir != "" && !filepath.IsAbs(c.Backup.Dir) {
+		c.Backup.Dir = filepath.Join(c.DataDir, c.Backup.Dir)
+	}
+	return nil
+}
+
+// DBPath is the database file inside the data directory.
+func (c *Config) DBPath() string {
+	return filepath.Join(c.DataDir, "ownpath.db")
+}
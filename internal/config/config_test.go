@@ -0,0 +1,142 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets the OWNPATH_* variables for the test, restoring them afterwards.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		if k, _, _ := strings.Cut(kv, "="); strings.HasPrefix(k, "OWNPATH_") {
+			t.Setenv(k, "")
+			os.Unsetenv(k)
+		}
+	}
+}
+
+// writeConfig writes a YAML configuration file and returns its path.
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+	c, args, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Listen != ":8080" || c.DataDir != "." || c.UploadLimit != 10 || c.Units != "metric" {
+		t.Errorf("defaults = %+v", c)
+	}
+	if c.Backup.Dir != "" {
+		t.Errorf("backups are on by default, in %s", c.Backup.Dir)
+	}
+	if len(args) != 0 {
+		t.Errorf("args = %v, want none", args)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	dataDir := t.TempDir()
+	path := writeConfig(t, `
+data_dir: `+dataDir+`
+listen: ":1001"
+upload_limit_mb: 20
+units: imperial
+backup:
+  dir: snapshots
+  interval: 6h
+features:
+  heatmap: false
+  routes: false
+`)
+	t.Setenv("OWNPATH_CONFIG", path)
+	t.Setenv("OWNPATH_LISTEN", ":1002")
+	t.Setenv("OWNPATH_UPLOAD_LIMIT_MB", "30")
+	t.Setenv("OWNPATH_ROUTES", "true")
+
+	c, args, err := Load([]string{"-listen", ":1003", "-backup-keep-daily", "3", "backup"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"config file from the environment", c.File, path},
+		{"flag over environment and file", c.Listen, ":1003"},
+		{"environment over file", c.UploadLimit, int64(30)},
+		{"environment over file (bool)", c.Features.Routes, true},
+		{"file over default", c.Units, "imperial"},
+		{"file over default (bool)", c.Features.Heatmap, false},
+		{"file over default (duration)", c.Backup.Interval, 6 * time.Hour},
+		{"relative backup dir inside the data dir", c.Backup.Dir, filepath.Join(dataDir, "snapshots")},
+		{"flag over default", c.Backup.KeepDaily, 3},
+		{"default", c.Backup.KeepWeekly, 4},
+		{"default (bool)", c.Features.Segments, true},
+		{"arguments after the flags", strings.Join(args, " "), "backup"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigFlagOverEnvironment(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("OWNPATH_CONFIG", writeConfig(t, `listen: ":1001"`))
+	path := writeConfig(t, `listen: ":1002"`)
+	c, _, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.File != path || c.Listen != ":1002" {
+		t.Errorf("read %s, listen %s; want %s, :1002", c.File, c.Listen, path)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "unknown key", yaml: "listen: \":1001\"\nlisten_port: 1001\n", want: "listen_port"},
+		{name: "unknown nested key", yaml: "backup:\n  directory: snapshots\n", want: "directory"},
+		{name: "invalid value in file", yaml: "upload_limit_mb: lots\n", want: "invalid config"},
+		{name: "invalid environment", env: map[string]string{"OWNPATH_BACKUP_INTERVAL": "daily"}, want: "OWNPATH_BACKUP_INTERVAL"},
+		{name: "invalid units", args: []string{"-units", "furlongs"}, want: "invalid units"},
+		{name: "relative base URL", args: []string{"-base-url", "ownpath.example.org"}, want: "invalid base URL"},
+		{name: "unknown flag", args: []string{"-port", "8080"}, want: "port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.yaml != "" {
+				args = append([]string{"-config", writeConfig(t, tt.yaml)}, args...)
+			}
+			_, _, err := Load(args)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
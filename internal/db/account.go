@@ -0,0 +1,201 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// AccountTables are the tables a full account export carries, in restore order (parents
+// before children). The other tables are derived from these and recomputed on restore;
+// original files travel as separate archive entries.
+var AccountTables = []string{
+	"settings", "hr_profiles", "ftp_history", "privacy_zones",
+	"segments", "routes", "route_fingerprints", "activities", "activity_routes", "activity_shares",
+}
+
+// sqliteTimeFormat is how the driver stores time.Time values. Dumps write times in it
+// so restored rows read back exactly as they were.
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// blobKey marks a BLOB value in a dump: {"$base64": "..."}. Text columns stay plain
+// strings, so the two never read back as each other.
+const blobKey = "$base64"
+
+// DumpTable calls fn with every row of one of the AccountTables as a column → value
+// map, so large tables are never held in memory at once.
+func DumpTable(table string, fn func(row map[string]any) error) error {
+	if !isAccountTable(table) {
+		return fmt.Errorf("table %s is not part of the account", table)
+	}
+	rows, err := DB.Query(fmt.Sprintf(`SELECT * FROM %s ORDER BY rowid`, table))
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", table, err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", table, err)
+	}
+
+	values := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("failed to scan %s: %w", table, err)
+		}
+		row := make(map[string]any, len(cols))
+		for i, c := range cols {
+			switch v := values[i].(type) {
+			case time.Time:
+				row[c] = v.Format(sqliteTimeFormat)
+			case []byte:
+				row[c] = map[string]string{blobKey: base64.StdEncoding.EncodeToString(v)}
+			default:
+				row[c] = v
+			}
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// AccountIsEmpty reports whether the instance holds no activities or user data yet,
+// which a restore requires. Settings don't count: they may hold defaults.
+func AccountIsEmpty() (bool, error) {
+	for _, table := range AccountTables {
+		if table == "settings" {
+			continue
+		}
+		var n int
+		if err := DB.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s`, table)).Scan(&n); err != nil {
+			return false, fmt.Errorf("failed to count %s: %w", table, err)
+		}
+		if n > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// AccountRestore inserts the rows of a dump into the AccountTables in one transaction,
+// keeping their IDs. Rows must come in AccountTables order, as DumpTable writes them.
+type AccountRestore struct {
+	tx    *sql.Tx
+	known map[string]map[string]bool
+}
+
+// BeginAccountRestore starts a restore.
+func BeginAccountRestore() (*AccountRestore, error) {
+	known := map[string]map[string]bool{}
+	for _, table := range AccountTables {
+		cols, err := tableColumns(table)
+		if err != nil {
+			return nil, err
+		}
+		known[table] = cols
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return &AccountRestore{tx: tx, known: known}, nil
+}
+
+// Insert restores one row. Tables and columns the current schema doesn't have are
+// skipped, so dumps of other versions restore; numbers are expected as json.Number
+// (a decoder with UseNumber) and BLOBs as DumpTable marks them.
+func (a *AccountRestore) Insert(table string, row map[string]any) error {
+	known, ok := a.known[table]
+	if !ok {
+		return nil
+	}
+	var cols, marks []string
+	var args []any
+	for c, v := range row {
+		if !known[c] {
+			continue
+		}
+		switch x := v.(type) {
+		case json.Number:
+			if i, err := x.Int64(); err == nil {
+				v = i
+			} else if f, err := x.Float64(); err == nil {
+				v = f
+			}
+		case map[string]any:
+			enc, ok := x[blobKey].(string)
+			data, err := base64.StdEncoding.DecodeString(enc)
+			if !ok || len(x) != 1 || err != nil {
+				return fmt.Errorf("invalid binary value for %s.%s", table, c)
+			}
+			v = data
+		}
+		if err := validateRestored(table, c, v); err != nil {
+			return err
+		}
+		cols = append(cols, c)
+		marks = append(marks, "?")
+		args = append(args, v)
+	}
+	if len(cols) == 0 {
+		return nil
+	}
+	stmt := fmt.Sprintf(`INSERT OR REPLACE INTO %s (%s) VALUES (%s)`, table, strings.Join(cols, ", "), strings.Join(marks, ", "))
+	if _, err := a.tx.Exec(stmt, args...); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", table, err)
+	}
+	return nil
+}
+
+// validateRestored checks the values pages put into HTML and URLs unescaped elsewhere
+// or use as file names: activity ids must be UUIDs, as uploads create them, and sports
+// must be ones OwnPath knows.
+func validateRestored(table, col string, v any) error {
+	s, isString := v.(string)
+	switch {
+	case col == "activity_id" || col == "source_activity_id" || (table == "activities" && col == "id"):
+		if v == nil && col == "source_activity_id" {
+			return nil
+		}
+		if _, err := uuid.Parse(s); !isString || err != nil {
+			return fmt.Errorf("invalid activity id in %s", table)
+		}
+	case (table == "activities" && col == "type") || col == "sport":
+		if !isString || utils.SportFromName(s) != s {
+			return fmt.Errorf("invalid sport in %s", table)
+		}
+	}
+	return nil
+}
+
+// Commit finishes the restore.
+func (a *AccountRestore) Commit() error {
+	return a.tx.Commit()
+}
+
+// Rollback abandons the restore; it is a no-op after Commit.
+func (a *AccountRestore) Rollback() error {
+	return a.tx.Rollback()
+}
+
+func isAccountTable(table string) bool {
+	for _, t := range AccountTables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
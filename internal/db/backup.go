@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Snapshot writes a consistent copy of the live database to dest with VACUUM INTO, which
+// reads inside a transaction and so doesn't block requests being served. The copy is
+// written to a temporary file and only moved to dest once it passes CheckIntegrity.
+func Snapshot(dest string) error {
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("snapshot %s already exists", dest)
+	}
+	tmp := dest + ".tmp"
+	os.Remove(tmp) // Left over from an interrupted snapshot; VACUUM INTO won't overwrite it
+	if _, err := DB.Exec(`VACUUM INTO ?`, tmp); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := CheckIntegrity(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to store snapshot: %w", err)
+	}
+	return nil
+}
+
+// openReadOnly opens a database file other than the live one without modifying it.
+func openReadOnly(path string) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	// As a URI, so characters such as ? and # in the path aren't read as its query or fragment
+	uri := url.URL{Scheme: "file", Path: path, RawQuery: "mode=ro"}
+	conn, err := sql.Open("sqlite3", uri.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return conn, nil
+}
+
+// CheckIntegrity runs SQLite's integrity check on a database file, e.g. a snapshot.
+func CheckIntegrity(path string) error {
+	conn, err := openReadOnly(path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// The check reports "ok", or one row per problem found
+	rows, err := conn.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return fmt.Errorf("failed to check %s: %w", path, err)
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("snapshot %s is corrupt: %s", path, problems[0])
+	}
+	return nil
+}
+
+// RestoreSnapshot replaces the contents of the live database with a snapshot using
+// SQLite's online backup API, so the server keeps running: requests in flight wait on
+// the lock and then see the restored data. The snapshot is checked first, and tables
+// and columns added since it was taken are created again afterwards.
+func RestoreSnapshot(src string) error {
+	if err := CheckIntegrity(src); err != nil {
+		return err
+	}
+	srcDB, err := openReadOnly(src)
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+
+	ctx := context.Background()
+	dstConn, err := DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	defer dstConn.Close()
+	srcConn, err := srcDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	defer srcConn.Close()
+
+	err = dstConn.Raw(func(dst any) error {
+		return srcConn.Raw(func(src any) error {
+			backup, err := dst.(*sqlite3.SQLiteConn).Backup("main", src.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	return createSchema()
+}
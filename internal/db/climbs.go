@@ -0,0 +1,105 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// StoredClimb is a detected climb with its row ID and activity.
+type StoredClimb struct {
+	utils.Climb
+	ID         int64
+	ActivityID string
+	Timestamp  time.Time
+}
+
+// climbColumns are the columns scanned by scanClimb, in order.
+const climbColumns = `c.id, c.activity_id, a.timestamp, c.category, c.start_distance, c.end_distance, c.length, c.gain,
+        c.avg_grade, c.max_grade, c.duration, c.start_lat, c.start_lon, c.end_lat, c.end_lon`
+
+// scanClimb reads one row selected with climbColumns.
+func scanClimb(row interface{ Scan(...any) error }) (StoredClimb, error) {
+	var c StoredClimb
+	err := row.Scan(&c.ID, &c.ActivityID, &c.Timestamp, &c.Category, &c.StartDistance, &c.EndDistance, &c.Length, &c.Gain,
+		&c.AvgGrade, &c.MaxGrade, &c.Duration, &c.StartLat, &c.StartLon, &c.EndLat, &c.EndLon)
+	return c, err
+}
+
+// SetActivityClimbs replaces the stored climbs of an activity.
+func SetActivityClimbs(activityID string, climbs []utils.Climb) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM activity_climbs WHERE activity_id = ?`, activityID); err != nil {
+		return fmt.Errorf("failed to clear climbs: %w", err)
+	}
+	for _, c := range climbs {
+		if _, err := tx.Exec(`INSERT INTO activity_climbs (activity_id, category, start_distance, end_distance, length, gain,
+            avg_grade, max_grade, duration, start_lat, start_lon, end_lat, end_lon) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			activityID, c.Category, c.StartDistance, c.EndDistance, c.Length, c.Gain,
+			c.AvgGrade, c.MaxGrade, c.Duration, c.StartLat, c.StartLon, c.EndLat, c.EndLon); err != nil {
+			return fmt.Errorf("failed to insert climb: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetActivityClimbs returns an activity's climbs in the order they were ridden.
+func GetActivityClimbs(activityID string) ([]StoredClimb, error) {
+	rows, err := DB.Query(`SELECT `+climbColumns+` FROM activity_climbs c JOIN activities a ON a.id = c.activity_id
+        WHERE c.activity_id = ? ORDER BY c.start_distance`, activityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query climbs: %w", err)
+	}
+	defer rows.Close()
+
+	var climbs []StoredClimb
+	for rows.Next() {
+		c, err := scanClimb(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan climb: %w", err)
+		}
+		climbs = append(climbs, c)
+	}
+	return climbs, rows.Err()
+}
+
+// GetClimb returns a single stored climb, or nil if it doesn't exist.
+func GetClimb(id int64) (*StoredClimb, error) {
+	c, err := scanClimb(DB.QueryRow(`SELECT `+climbColumns+` FROM activity_climbs c JOIN activities a ON a.id = c.activity_id
+        WHERE c.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get climb: %w", err)
+	}
+	return &c, nil
+}
+
+// GetClimbsStartingNear returns every stored climb whose start lies within delta degrees
+// of (lat, lon), oldest activity first. Callers refine the candidates with utils.SameClimb.
+func GetClimbsStartingNear(lat, lon, delta float64) ([]StoredClimb, error) {
+	rows, err := DB.Query(`SELECT `+climbColumns+` FROM activity_climbs c JOIN activities a ON a.id = c.activity_id
+        WHERE c.start_lat BETWEEN ? AND ? AND c.start_lon BETWEEN ? AND ?
+        ORDER BY a.timestamp`, lat-delta, lat+delta, lon-delta, lon+delta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query climbs: %w", err)
+	}
+	defer rows.Close()
+
+	var climbs []StoredClimb
+	for rows.Next() {
+		c, err := scanClimb(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan climb: %w", err)
+		}
+		climbs = append(climbs, c)
+	}
+	return climbs, rows.Err()
+}
@@ -2,8 +2,10 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/gratten/ownpath/internal/models" // Adjust import path
@@ -17,11 +19,28 @@ var DB *sql.DB
 // It creates the file if it doesn't exist and sets up the schema.
 func InitDB(dbPath string) error {
 	var err error
-	DB, err = sql.Open("sqlite3", dbPath)
+	// Enforce foreign keys so derived rows are removed with their activity (ON DELETE CASCADE),
+	// and wait for locks instead of failing while background jobs write
+	dsn := dbPath
+	if !strings.Contains(dsn, "?") {
+		dsn += "?_foreign_keys=on&_busy_timeout=5000"
+	}
+	DB, err = sql.Open("sqlite3", dsn)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 
+	if err := createSchema(); err != nil {
+		return err
+	}
+
+	log.Println("Database initialized successfully")
+	return nil
+}
+
+// createSchema creates missing tables and columns, bringing older databases (and
+// restored snapshots) up to date in place.
+func createSchema() error {
 	// Create the activities table if it doesn't exist.
 	schema := `
     CREATE TABLE IF NOT EXISTS activities (
@@ -30,13 +49,210 @@ func InitDB(dbPath string) error {
         type TEXT NOT NULL,           -- e.g., 'run', 'hike', 'bike'
         stats_json TEXT NOT NULL,     -- Serialized JSON of stats (distance, elevation, etc.)
         gpx_data TEXT                 -- GPX XML string for map rendering (optional for MVP)
+    );
+    CREATE TABLE IF NOT EXISTS settings (
+        key TEXT PRIMARY KEY,         -- Setting name (e.g., 'units')
+        value TEXT NOT NULL           -- Setting value as text
+    );
+    CREATE TABLE IF NOT EXISTS hr_profiles (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        effective_from DATETIME NOT NULL, -- Profile applies to activities on/after this date
+        max_hr INTEGER NOT NULL,
+        resting_hr INTEGER NOT NULL,
+        lthr INTEGER NOT NULL,            -- Lactate threshold HR (0 if unknown)
+        model TEXT NOT NULL               -- Zone model: 'max', 'hrr' or 'lthr'
+    );
+    CREATE TABLE IF NOT EXISTS activity_hr_zones (
+        activity_id TEXT NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+        zone INTEGER NOT NULL,            -- 0-based zone index
+        seconds REAL NOT NULL,            -- Time spent in the zone
+        PRIMARY KEY (activity_id, zone)
+    );
+    CREATE TABLE IF NOT EXISTS ftp_history (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        effective_from DATETIME NOT NULL, -- FTP applies to activities on/after this date
+        ftp INTEGER NOT NULL              -- Functional threshold power in watts
+    );
+    CREATE TABLE IF NOT EXISTS activity_power_curve (
+        activity_id TEXT NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+        duration INTEGER NOT NULL,        -- Seconds
+        watts REAL NOT NULL,              -- Best average power over the duration
+        PRIMARY KEY (activity_id, duration)
+    );
+    CREATE INDEX IF NOT EXISTS idx_power_curve_duration ON activity_power_curve (duration, watts);
+    CREATE TABLE IF NOT EXISTS activity_load (
+        activity_id TEXT PRIMARY KEY REFERENCES activities(id) ON DELETE CASCADE,
+        load REAL NOT NULL,               -- Training stress of the activity
+        method TEXT NOT NULL              -- 'tss', 'hrtss' or 'trimp'
+    );
+    CREATE TABLE IF NOT EXISTS training_load (
+        date TEXT PRIMARY KEY,            -- YYYY-MM-DD
+        load REAL NOT NULL,               -- Summed activity load of the day
+        ctl REAL NOT NULL,                -- Chronic training load (fitness)
+        atl REAL NOT NULL,                -- Acute training load (fatigue)
+        tsb REAL NOT NULL                 -- Training stress balance (form)
+    );
+    CREATE TABLE IF NOT EXISTS best_efforts (
+        activity_id TEXT NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+        name TEXT NOT NULL,               -- e.g. '5K', '20 min power'
+        metric TEXT NOT NULL,             -- 'time' (lower is better), 'power' or 'speed'
+        value REAL NOT NULL,
+        start_offset REAL NOT NULL,       -- Seconds from activity start
+        end_offset REAL NOT NULL,
+        PRIMARY KEY (activity_id, name)
+    );
+    CREATE INDEX IF NOT EXISTS idx_best_efforts_name ON best_efforts (name, value);
+    CREATE TABLE IF NOT EXISTS activity_climbs (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        activity_id TEXT NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+        category TEXT NOT NULL,           -- 'Cat 4' ... 'HC'
+        start_distance REAL NOT NULL,     -- Meters from activity start
+        end_distance REAL NOT NULL,
+        length REAL NOT NULL,             -- Meters
+        gain REAL NOT NULL,               -- Meters
+        avg_grade REAL NOT NULL,          -- Fraction, e.g. 0.06
+        max_grade REAL NOT NULL,
+        duration REAL NOT NULL,           -- Seconds from foot to top
+        start_lat REAL NOT NULL,
+        start_lon REAL NOT NULL,
+        end_lat REAL NOT NULL,
+        end_lon REAL NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_climbs_activity ON activity_climbs (activity_id);
+    CREATE INDEX IF NOT EXISTS idx_climbs_start ON activity_climbs (start_lat, start_lon);
+    CREATE TABLE IF NOT EXISTS segments (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL,
+        sport TEXT NOT NULL,              -- Sport of the activity it was drawn from
+        points_json TEXT NOT NULL,        -- Serialized []LatLon path
+        length REAL NOT NULL,             -- Meters
+        source_activity_id TEXT,          -- Activity the path was taken from (may be deleted since)
+        created_at DATETIME NOT NULL
+    );
+    CREATE TABLE IF NOT EXISTS segment_efforts (
+        segment_id INTEGER NOT NULL REFERENCES segments(id) ON DELETE CASCADE,
+        activity_id TEXT NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+        start_offset REAL NOT NULL,       -- Seconds from activity start
+        end_offset REAL NOT NULL,
+        elapsed REAL NOT NULL,            -- Seconds
+        PRIMARY KEY (segment_id, activity_id, start_offset)
+    );
+    CREATE INDEX IF NOT EXISTS idx_segment_efforts_activity ON segment_efforts (activity_id);
+    CREATE TABLE IF NOT EXISTS routes (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL DEFAULT '',    -- User-given name; empty until named
+        sport TEXT NOT NULL,
+        start_cell TEXT NOT NULL,         -- Grid cells of the representative fingerprint
+        end_cell TEXT NOT NULL,
+        length REAL NOT NULL,             -- Meters
+        points_json TEXT NOT NULL         -- Serialized simplified polyline
+    );
+    CREATE INDEX IF NOT EXISTS idx_routes_cells ON routes (sport, start_cell, end_cell);
+    CREATE TABLE IF NOT EXISTS route_fingerprints (
+        route_id INTEGER NOT NULL REFERENCES routes(id) ON DELETE CASCADE,
+        start_cell TEXT NOT NULL,         -- Fingerprint of a route merged into route_id
+        end_cell TEXT NOT NULL,
+        length REAL NOT NULL,
+        points_json TEXT NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_route_fingerprints_cells ON route_fingerprints (start_cell, end_cell);
+    CREATE TABLE IF NOT EXISTS activity_routes (
+        activity_id TEXT PRIMARY KEY REFERENCES activities(id) ON DELETE CASCADE,
+        route_id INTEGER NOT NULL REFERENCES routes(id) ON DELETE CASCADE,
+        manual INTEGER NOT NULL DEFAULT 0, -- 1 if the user merged/split it; never reclustered
+        fingerprint_json TEXT NOT NULL     -- Serialized fingerprint of the activity itself
+    );
+    CREATE INDEX IF NOT EXISTS idx_activity_routes_route ON activity_routes (route_id);
+    CREATE TABLE IF NOT EXISTS heatmap_cells (
+        activity_id TEXT NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+        sport TEXT NOT NULL,              -- Copied from the activity for filtering
+        day TEXT NOT NULL,                -- YYYY-MM-DD of the activity, for date filters
+        px INTEGER NOT NULL,              -- Web-mercator pixel at the heatmap grid zoom
+        py INTEGER NOT NULL,
+        PRIMARY KEY (activity_id, px, py)
+    );
+    CREATE INDEX IF NOT EXISTS idx_heatmap_cells_pixel ON heatmap_cells (px, py);
+    CREATE TABLE IF NOT EXISTS activity_tracks (
+        activity_id TEXT NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+        level INTEGER NOT NULL,           -- Index into utils.SimplifyLevels
+        tolerance REAL NOT NULL,          -- Meters; a changed tolerance invalidates the row
+        points INTEGER NOT NULL,
+        polyline TEXT NOT NULL,           -- Encoded polyline of the simplified track
+        PRIMARY KEY (activity_id, level)
+    );
+    CREATE TABLE IF NOT EXISTS privacy_zones (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL,
+        lat REAL NOT NULL,                -- Center
+        lon REAL NOT NULL,
+        radius REAL NOT NULL,             -- Meters
+        created_at DATETIME NOT NULL
+    );
+    CREATE TABLE IF NOT EXISTS activity_shares (
+        token TEXT PRIMARY KEY,           -- Unguessable id used in share links instead of the activity's
+        activity_id TEXT NOT NULL UNIQUE REFERENCES activities(id) ON DELETE CASCADE,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE TABLE IF NOT EXISTS activity_thumbnails (
+        activity_id TEXT PRIMARY KEY REFERENCES activities(id) ON DELETE CASCADE,
+        png BLOB NOT NULL,                -- Route preview rendered at ingestion
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE TABLE IF NOT EXISTS activity_files (
+        activity_id TEXT PRIMARY KEY REFERENCES activities(id) ON DELETE CASCADE,
+        filename TEXT NOT NULL,           -- Name of the uploaded file
+        format TEXT NOT NULL,             -- 'fit', 'gpx' or 'tcx'
+        data BLOB NOT NULL,               -- The file as uploaded, kept for full exports
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
     );`
-	_, err = DB.Exec(schema)
-	if err != nil {
+	if _, err := DB.Exec(schema); err != nil {
 		return fmt.Errorf("failed to create schema: %w", err)
 	}
 
-	log.Println("Database initialized successfully")
+	// Columns added after the initial schema; existing databases are migrated in place.
+	if err := ensureColumn("activities", "records_json", "TEXT"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// tableColumns returns the set of columns of a table.
+func tableColumns(table string) (map[string]bool, error) {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	cols := map[string]bool{}
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return nil, fmt.Errorf("failed to scan table info for %s: %w", table, err)
+		}
+		cols[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read table info for %s: %w", table, err)
+	}
+	return cols, nil
+}
+
+// ensureColumn adds a column to an existing table if it is not already present.
+func ensureColumn(table, column, decl string) error {
+	cols, err := tableColumns(table)
+	if err != nil {
+		return err
+	}
+	if cols[column] {
+		return nil
+	}
+	if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	log.Printf("Migrated table %s: added column %s", table, column)
 	return nil
 }
 
@@ -49,8 +265,8 @@ func CloseDB() {
 
 // InsertActivity inserts a new activity into the database.
 func InsertActivity(act models.Activity) error {
-	stmt := `INSERT INTO activities (id, timestamp, type, stats_json, gpx_data) VALUES (?, ?, ?, ?, ?)`
-	_, err := DB.Exec(stmt, act.ID, act.Timestamp, act.Type, act.StatsJSON, act.GPXData)
+	stmt := `INSERT INTO activities (id, timestamp, type, stats_json, gpx_data, records_json) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := DB.Exec(stmt, act.ID, act.Timestamp, act.Type, act.StatsJSON, act.GPXData, act.RecordsJSON)
 	if err != nil {
 		return fmt.Errorf("failed to insert activity: %w", err)
 	}
@@ -78,6 +294,59 @@ func GetActivities() ([]models.Activity, error) {
 	return activities, nil
 }
 
+// ActivityFilter selects activities for bulk operations. Zero values don't filter.
+type ActivityFilter struct {
+	Sport string
+	From  time.Time // inclusive
+	To    time.Time // exclusive
+}
+
+// FindActivities returns the activities matching f, oldest first.
+func FindActivities(f ActivityFilter) ([]models.Activity, error) {
+	query := `SELECT id, timestamp, type, stats_json FROM activities WHERE 1 = 1`
+	var args []any
+	if f.Sport != "" {
+		query += ` AND type = ?`
+		args = append(args, f.Sport)
+	}
+	if !f.From.IsZero() {
+		query += ` AND datetime(timestamp) >= datetime(?)`
+		args = append(args, f.From.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if !f.To.IsZero() {
+		query += ` AND datetime(timestamp) < datetime(?)`
+		args = append(args, f.To.UTC().Format("2006-01-02 15:04:05"))
+	}
+	rows, err := DB.Query(query+` ORDER BY timestamp`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query activities: %w", err)
+	}
+	defer rows.Close()
+
+	var activities []models.Activity
+	for rows.Next() {
+		var act models.Activity
+		var ts string
+		if err := rows.Scan(&act.ID, &ts, &act.Type, &act.StatsJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan activity: %w", err)
+		}
+		act.Timestamp, _ = parseTimestamp(ts)
+		activities = append(activities, act)
+	}
+	return activities, rows.Err()
+}
+
+// parseTimestamp parses a timestamp SQLite hands back as text (from an aggregate, or a
+// column scanned into a string) in the driver's storage format or the older layouts.
+func parseTimestamp(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999-07:00", "2006-01-02T15:04:05.999999999-07:00", "2006-01-02 15:04:05", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", s)
+}
+
 // GetActivityByID returns a single activity by ID (for detail view).
 func GetActivityByID(id string) (*models.Activity, error) {
 	row := DB.QueryRow(`SELECT id, timestamp, type, stats_json, gpx_data FROM activities WHERE id = ?`, id)
@@ -90,6 +359,125 @@ func GetActivityByID(id string) (*models.Activity, error) {
 	} else if err != nil {
 		return nil, fmt.Errorf("failed to get activity: %w", err)
 	}
-	act.Timestamp, _ = time.Parse("2006-01-02 15:04:05", ts)
+	act.Timestamp, _ = parseTimestamp(ts)
 	return &act, nil
 }
+
+// GetActivityRecords returns the decoded record stream of an activity.
+// Activities imported before records were stored return an empty slice.
+func GetActivityRecords(id string) ([]models.Record, error) {
+	var recordsJSON sql.NullString
+	err := DB.QueryRow(`SELECT records_json FROM activities WHERE id = ?`, id).Scan(&recordsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get records: %w", err)
+	}
+	if !recordsJSON.Valid || recordsJSON.String == "" {
+		return nil, nil
+	}
+
+	var records []models.Record
+	if err := json.Unmarshal([]byte(recordsJSON.String), &records); err != nil {
+		return nil, fmt.Errorf("failed to decode records: %w", err)
+	}
+	return records, nil
+}
+
+// SetActivityRecords replaces the stored record stream of an activity.
+func SetActivityRecords(id string, records []models.Record) error {
+	recordsJSON, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode records: %w", err)
+	}
+	if _, err := DB.Exec(`UPDATE activities SET records_json = ? WHERE id = ?`, string(recordsJSON), id); err != nil {
+		return fmt.Errorf("failed to update records: %w", err)
+	}
+	return nil
+}
+
+// GetSetting returns the stored value for key, or fallback if it was never set.
+func GetSetting(key, fallback string) (string, error) {
+	var value string
+	err := DB.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return fallback, nil
+	} else if err != nil {
+		return fallback, fmt.Errorf("failed to get setting %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// SetSetting stores value under key, replacing any previous value.
+func SetSetting(key, value string) error {
+	_, err := DB.Exec(`INSERT INTO settings (key, value) VALUES (?, ?)
+        ON CONFLICT(key) DO UPDATE SET value = excluded.value`, key, value)
+	if err != nil {
+		return fmt.Errorf("failed to set setting %s: %w", key, err)
+	}
+	return nil
+}
+
+// ListActivities returns the ID, timestamp and type of every activity, oldest first,
+// for batch jobs that load the heavier columns one activity at a time.
+func ListActivities() ([]models.Activity, error) {
+	rows, err := DB.Query(`SELECT id, timestamp, type FROM activities ORDER BY timestamp ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query activities: %w", err)
+	}
+	defer rows.Close()
+
+	var activities []models.Activity
+	for rows.Next() {
+		var act models.Activity
+		if err := rows.Scan(&act.ID, &act.Timestamp, &act.Type); err != nil {
+			return nil, fmt.Errorf("failed to scan activity: %w", err)
+		}
+		activities = append(activities, act)
+	}
+	return activities, rows.Err()
+}
+
+// MergeActivityStats updates individual keys of an activity's stats_json, leaving the
+// others untouched. A nil value removes the key. The merge is a single json_patch
+// UPDATE, so analyses writing different keys of one activity concurrently don't
+// overwrite each other.
+func MergeActivityStats(id string, values map[string]any) error {
+	patch, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to encode stats: %w", err)
+	}
+	res, err := DB.Exec(`UPDATE activities SET stats_json = json_patch(stats_json, ?) WHERE id = ?`, string(patch), id)
+	if err != nil {
+		return fmt.Errorf("failed to update stats: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("failed to update stats: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// GetActivityStats returns the decoded stats_json of an activity.
+func GetActivityStats(id string) (map[string]any, error) {
+	var statsJSON string
+	if err := DB.QueryRow(`SELECT stats_json FROM activities WHERE id = ?`, id).Scan(&statsJSON); err != nil {
+		return nil, fmt.Errorf("failed to get stats: %w", err)
+	}
+	stats := map[string]any{}
+	if err := json.Unmarshal([]byte(statsJSON), &stats); err != nil {
+		return nil, fmt.Errorf("failed to decode stats: %w", err)
+	}
+	return stats, nil
+}
+
+// DeleteActivity removes an activity; derived rows go with it through ON DELETE CASCADE.
+// It reports whether the activity existed.
+func DeleteActivity(id string) (bool, error) {
+	res, err := DB.Exec(`DELETE FROM activities WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete activity: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete activity: %w", err)
+	}
+	return n > 0, nil
+}
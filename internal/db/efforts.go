@@ -0,0 +1,96 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// RankedEffort is a stored best effort with its standing among all activities.
+type RankedEffort struct {
+	utils.Effort
+	ActivityID  string
+	Timestamp   time.Time
+	AllTimeRank int // 1 = personal record
+	YearRank    int // rank within the activity's calendar year
+}
+
+// betterEffortSQL is true when row o beats row e for e's metric.
+const betterEffortSQL = `CASE WHEN e.metric = 'time' THEN o.value < e.value ELSE o.value > e.value END`
+
+// SetActivityEfforts replaces the stored best efforts of an activity.
+func SetActivityEfforts(activityID string, efforts []utils.Effort) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM best_efforts WHERE activity_id = ?`, activityID); err != nil {
+		return fmt.Errorf("failed to clear efforts: %w", err)
+	}
+	for _, e := range efforts {
+		if _, err := tx.Exec(`INSERT INTO best_efforts (activity_id, name, metric, value, start_offset, end_offset) VALUES (?, ?, ?, ?, ?, ?)`,
+			activityID, e.Name, e.Metric, e.Value, e.Start, e.End); err != nil {
+			return fmt.Errorf("failed to insert effort: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetActivityEfforts returns an activity's best efforts ranked against every other
+// activity, all-time and within the same year. Ties keep the earlier activity (then the
+// earlier upload) ahead.
+func GetActivityEfforts(activityID string) ([]RankedEffort, error) {
+	rows, err := DB.Query(`SELECT e.name, e.metric, e.value, e.start_offset, e.end_offset, a.timestamp,
+            1 + (SELECT COUNT(*) FROM best_efforts o JOIN activities oa ON oa.id = o.activity_id
+                 WHERE o.name = e.name AND o.activity_id != e.activity_id
+                   AND (`+betterEffortSQL+` OR (o.value = e.value AND (oa.timestamp < a.timestamp OR (oa.timestamp = a.timestamp AND o.rowid < e.rowid))))),
+            1 + (SELECT COUNT(*) FROM best_efforts o JOIN activities oa ON oa.id = o.activity_id
+                 WHERE o.name = e.name AND o.activity_id != e.activity_id
+                   AND strftime('%Y', oa.timestamp) = strftime('%Y', a.timestamp)
+                   AND (`+betterEffortSQL+` OR (o.value = e.value AND (oa.timestamp < a.timestamp OR (oa.timestamp = a.timestamp AND o.rowid < e.rowid)))))
+        FROM best_efforts e JOIN activities a ON a.id = e.activity_id
+        WHERE e.activity_id = ?`, activityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query efforts: %w", err)
+	}
+	defer rows.Close()
+
+	var efforts []RankedEffort
+	for rows.Next() {
+		e := RankedEffort{ActivityID: activityID}
+		if err := rows.Scan(&e.Name, &e.Metric, &e.Value, &e.Start, &e.End, &e.Timestamp, &e.AllTimeRank, &e.YearRank); err != nil {
+			return nil, fmt.Errorf("failed to scan effort: %w", err)
+		}
+		efforts = append(efforts, e)
+	}
+	return efforts, rows.Err()
+}
+
+// GetPersonalRecords returns the best effort for every effort name, all-time when year
+// is 0, otherwise within that calendar year.
+func GetPersonalRecords(year int) ([]RankedEffort, error) {
+	rows, err := DB.Query(`SELECT name, metric, value, start_offset, end_offset, activity_id, timestamp FROM (
+            SELECT e.*, a.timestamp,
+                ROW_NUMBER() OVER (PARTITION BY e.name
+                    ORDER BY CASE WHEN e.metric = 'time' THEN e.value ELSE -e.value END, a.timestamp, e.rowid) AS rn
+            FROM best_efforts e JOIN activities a ON a.id = e.activity_id
+            WHERE ? = 0 OR CAST(strftime('%Y', a.timestamp) AS INTEGER) = ?)
+        WHERE rn = 1`, year, year)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query personal records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []RankedEffort
+	for rows.Next() {
+		e := RankedEffort{AllTimeRank: 1, YearRank: 1}
+		if err := rows.Scan(&e.Name, &e.Metric, &e.Value, &e.Start, &e.End, &e.ActivityID, &e.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan personal record: %w", err)
+		}
+		records = append(records, e)
+	}
+	return records, rows.Err()
+}
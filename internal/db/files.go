@@ -0,0 +1,38 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ActivityFile is the original file an activity was imported from.
+type ActivityFile struct {
+	Filename string
+	Format   string
+	Data     []byte
+}
+
+// SetActivityFile stores the original file of an activity.
+func SetActivityFile(activityID string, f ActivityFile) error {
+	_, err := DB.Exec(`INSERT INTO activity_files (activity_id, filename, format, data) VALUES (?, ?, ?, ?)
+        ON CONFLICT(activity_id) DO UPDATE SET filename = excluded.filename, format = excluded.format,
+            data = excluded.data, created_at = CURRENT_TIMESTAMP`, activityID, f.Filename, f.Format, f.Data)
+	if err != nil {
+		return fmt.Errorf("failed to store original file: %w", err)
+	}
+	return nil
+}
+
+// GetActivityFile returns the original file of an activity, or nil for activities
+// imported before originals were kept.
+func GetActivityFile(activityID string) (*ActivityFile, error) {
+	var f ActivityFile
+	err := DB.QueryRow(`SELECT filename, format, data FROM activity_files WHERE activity_id = ?`, activityID).
+		Scan(&f.Filename, &f.Format, &f.Data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get original file: %w", err)
+	}
+	return &f, nil
+}
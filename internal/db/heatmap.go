@@ -0,0 +1,89 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// HeatmapFilter limits the activities drawn on the heatmap. Zero values don't filter.
+type HeatmapFilter struct {
+	Sport string
+	From  time.Time // inclusive
+	To    time.Time // exclusive
+}
+
+// SetActivityHeatmap replaces the density-grid cells of an activity.
+func SetActivityHeatmap(activityID, sport string, timestamp time.Time, cells []utils.HeatCell) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM heatmap_cells WHERE activity_id = ?`, activityID); err != nil {
+		return fmt.Errorf("failed to clear heatmap cells: %w", err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO heatmap_cells (activity_id, sport, day, px, py) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare heatmap insert: %w", err)
+	}
+	defer stmt.Close()
+	day := timestamp.UTC().Format("2006-01-02")
+	for _, c := range cells {
+		if _, err := stmt.Exec(activityID, sport, day, c.X, c.Y); err != nil {
+			return fmt.Errorf("failed to insert heatmap cell: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetHeatmapTile returns, for every pixel of tile z/x/y with any heat, the number of
+// matching activities that crossed it, and the pixel size of each returned cell.
+func GetHeatmapTile(z, x, y int, f HeatmapFilter) ([]utils.TileHeat, int, error) {
+	// Tile bounds in grid pixels, and how grid pixels map to tile pixels
+	var minX, minY, span, shift, cellSize int
+	if z <= utils.HeatmapZoom {
+		shift = utils.HeatmapZoom - z
+		span = utils.TileSize << shift
+		cellSize = 1
+	} else {
+		span = utils.TileSize >> (z - utils.HeatmapZoom)
+		cellSize = 1 << (z - utils.HeatmapZoom)
+	}
+	if span == 0 {
+		return nil, 0, fmt.Errorf("zoom %d is too deep", z)
+	}
+	minX, minY = x*span, y*span
+
+	from, to := "", "9999-12-31"
+	if !f.From.IsZero() {
+		from = f.From.Format("2006-01-02")
+	}
+	if !f.To.IsZero() {
+		to = f.To.Format("2006-01-02")
+	}
+	rows, err := DB.Query(`SELECT (px - ?) >> ?, (py - ?) >> ?, COUNT(DISTINCT activity_id)
+        FROM heatmap_cells
+        WHERE px >= ? AND px < ? AND py >= ? AND py < ?
+          AND (? = '' OR sport = ?) AND day >= ? AND day < ?
+        GROUP BY 1, 2`,
+		minX, shift, minY, shift,
+		minX, minX+span, minY, minY+span,
+		f.Sport, f.Sport, from, to)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query heatmap: %w", err)
+	}
+	defer rows.Close()
+
+	var heat []utils.TileHeat
+	for rows.Next() {
+		var h utils.TileHeat
+		if err := rows.Scan(&h.X, &h.Y, &h.Count); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan heatmap cell: %w", err)
+		}
+		heat = append(heat, h)
+	}
+	return heat, cellSize, rows.Err()
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// InsertHRProfile stores a new heart-rate profile version.
+func InsertHRProfile(p models.HRProfile) (int64, error) {
+	res, err := DB.Exec(`INSERT INTO hr_profiles (effective_from, max_hr, resting_hr, lthr, model) VALUES (?, ?, ?, ?, ?)`,
+		p.EffectiveFrom.UTC(), p.MaxHR, p.RestingHR, p.LTHR, p.Model)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert hr profile: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetHRProfiles returns every heart-rate profile version, newest first.
+func GetHRProfiles() ([]models.HRProfile, error) {
+	rows, err := DB.Query(`SELECT id, effective_from, max_hr, resting_hr, lthr, model FROM hr_profiles`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hr profiles: %w", err)
+	}
+	defer rows.Close()
+
+	var profiles []models.HRProfile
+	for rows.Next() {
+		var p models.HRProfile
+		if err := rows.Scan(&p.ID, &p.EffectiveFrom, &p.MaxHR, &p.RestingHR, &p.LTHR, &p.Model); err != nil {
+			return nil, fmt.Errorf("failed to scan hr profile: %w", err)
+		}
+		profiles = append(profiles, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Sorted as times: the stored text only orders correctly when every offset is the same
+	sort.Slice(profiles, func(i, j int) bool {
+		if !profiles[i].EffectiveFrom.Equal(profiles[j].EffectiveFrom) {
+			return profiles[i].EffectiveFrom.After(profiles[j].EffectiveFrom)
+		}
+		return profiles[i].ID > profiles[j].ID
+	})
+	return profiles, nil
+}
+
+// GetHRProfileAt returns the profile in effect at t, the newest one starting on or
+// before it; nil means none was, so activities older than the first profile get no zones.
+func GetHRProfileAt(t time.Time) (*models.HRProfile, error) {
+	profiles, err := GetHRProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range profiles {
+		if !p.EffectiveFrom.After(t) {
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+// SetActivityZones replaces the stored time-in-zone (seconds per zone) of an activity.
+func SetActivityZones(activityID string, seconds []float64) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM activity_hr_zones WHERE activity_id = ?`, activityID); err != nil {
+		return fmt.Errorf("failed to clear zones: %w", err)
+	}
+	for zone, secs := range seconds {
+		if _, err := tx.Exec(`INSERT INTO activity_hr_zones (activity_id, zone, seconds) VALUES (?, ?, ?)`, activityID, zone, secs); err != nil {
+			return fmt.Errorf("failed to insert zone: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetActivityZones returns the stored time-in-zone of an activity, indexed by zone.
+func GetActivityZones(activityID string) ([]float64, error) {
+	rows, err := DB.Query(`SELECT zone, seconds FROM activity_hr_zones WHERE activity_id = ? ORDER BY zone`, activityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query zones: %w", err)
+	}
+	defer rows.Close()
+
+	var seconds []float64
+	for rows.Next() {
+		var zone int
+		var secs float64
+		if err := rows.Scan(&zone, &secs); err != nil {
+			return nil, fmt.Errorf("failed to scan zone: %w", err)
+		}
+		for len(seconds) <= zone {
+			seconds = append(seconds, 0)
+		}
+		seconds[zone] = secs
+	}
+	return seconds, rows.Err()
+}
+
+// WeeklyZones is the time-in-zone summed over all activities of one week.
+type WeeklyZones struct {
+	WeekStart string    // Monday, YYYY-MM-DD
+	Seconds   []float64 // indexed by zone
+}
+
+// GetWeeklyZones sums time-in-zone per calendar week (Monday start), newest first.
+func GetWeeklyZones(weeks int) ([]WeeklyZones, error) {
+	rows, err := DB.Query(`SELECT date(a.timestamp, 'weekday 0', '-6 days') AS week, z.zone, SUM(z.seconds)
+        FROM activity_hr_zones z JOIN activities a ON a.id = z.activity_id
+        GROUP BY week, z.zone
+        ORDER BY week DESC, z.zone`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query weekly zones: %w", err)
+	}
+	defer rows.Close()
+
+	var result []WeeklyZones
+	for rows.Next() {
+		var week string
+		var zone int
+		var secs float64
+		if err := rows.Scan(&week, &zone, &secs); err != nil {
+			return nil, fmt.Errorf("failed to scan weekly zones: %w", err)
+		}
+		if len(result) == 0 || result[len(result)-1].WeekStart != week {
+			if len(result) == weeks {
+				break
+			}
+			result = append(result, WeeklyZones{WeekStart: week})
+		}
+		wz := &result[len(result)-1]
+		for len(wz.Seconds) <= zone {
+			wz.Seconds = append(wz.Seconds, 0)
+		}
+		wz.Seconds[zone] = secs
+	}
+	return result, rows.Err()
+}
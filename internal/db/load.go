@@ -0,0 +1,107 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// SetActivityLoad stores the training load of an activity; a zero load with no method
+// removes it.
+func SetActivityLoad(activityID string, load float64, method string) error {
+	if method == "" {
+		if _, err := DB.Exec(`DELETE FROM activity_load WHERE activity_id = ?`, activityID); err != nil {
+			return fmt.Errorf("failed to clear activity load: %w", err)
+		}
+		return nil
+	}
+	_, err := DB.Exec(`INSERT INTO activity_load (activity_id, load, method) VALUES (?, ?, ?)
+        ON CONFLICT(activity_id) DO UPDATE SET load = excluded.load, method = excluded.method`,
+		activityID, load, method)
+	if err != nil {
+		return fmt.Errorf("failed to set activity load: %w", err)
+	}
+	return nil
+}
+
+// GetActivityLoad returns the stored load and method of an activity ("" if none).
+func GetActivityLoad(activityID string) (float64, string, error) {
+	var load float64
+	var method string
+	err := DB.QueryRow(`SELECT load, method FROM activity_load WHERE activity_id = ?`, activityID).Scan(&load, &method)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	} else if err != nil {
+		return 0, "", fmt.Errorf("failed to get activity load: %w", err)
+	}
+	return load, method, nil
+}
+
+// GetDailyLoads sums activity load per calendar day (YYYY-MM-DD).
+func GetDailyLoads() (map[string]float64, error) {
+	rows, err := DB.Query(`SELECT date(a.timestamp), SUM(l.load)
+        FROM activity_load l JOIN activities a ON a.id = l.activity_id
+        GROUP BY date(a.timestamp)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query daily loads: %w", err)
+	}
+	defer rows.Close()
+
+	daily := map[string]float64{}
+	for rows.Next() {
+		var date string
+		var load float64
+		if err := rows.Scan(&date, &load); err != nil {
+			return nil, fmt.Errorf("failed to scan daily load: %w", err)
+		}
+		daily[date] = load
+	}
+	return daily, rows.Err()
+}
+
+// ReplaceTrainingLoad swaps the stored training-load series for a freshly computed one.
+func ReplaceTrainingLoad(series []utils.LoadDay) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM training_load`); err != nil {
+		return fmt.Errorf("failed to clear training load: %w", err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO training_load (date, load, ctl, atl, tsb) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare training load insert: %w", err)
+	}
+	defer stmt.Close()
+	for _, d := range series {
+		if _, err := stmt.Exec(d.Date, d.Load, d.CTL, d.ATL, d.TSB); err != nil {
+			return fmt.Errorf("failed to insert training load: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTrainingLoad returns the stored series between from and to (YYYY-MM-DD, inclusive;
+// empty strings leave that side open).
+func GetTrainingLoad(from, to string) ([]utils.LoadDay, error) {
+	rows, err := DB.Query(`SELECT date, load, ctl, atl, tsb FROM training_load
+        WHERE (? = '' OR date >= ?) AND (? = '' OR date <= ?)
+        ORDER BY date`, from, from, to, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query training load: %w", err)
+	}
+	defer rows.Close()
+
+	var series []utils.LoadDay
+	for rows.Next() {
+		var d utils.LoadDay
+		if err := rows.Scan(&d.Date, &d.Load, &d.CTL, &d.ATL, &d.TSB); err != nil {
+			return nil, fmt.Errorf("failed to scan training load: %w", err)
+		}
+		series = append(series, d)
+	}
+	return series, rows.Err()
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// MBTiles reads tiles from an MBTiles file (a SQLite database of tiles in TMS order).
+type MBTiles struct {
+	db   *sql.DB
+	info utils.TileInfo
+}
+
+// OpenMBTiles opens an MBTiles file read-only and reads its metadata.
+func OpenMBTiles(path string) (*MBTiles, error) {
+	conn, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&immutable=1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mbtiles: %w", err)
+	}
+	m := &MBTiles{db: conn, info: utils.TileInfo{Format: "png", MaxZoom: 22}}
+
+	rows, err := conn.Query(`SELECT name, value FROM metadata`)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read mbtiles metadata: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to read mbtiles metadata: %w", err)
+		}
+		switch name {
+		case "format":
+			m.info.Format = value
+		case "name":
+			m.info.Name = value
+		case "attribution":
+			m.info.Attribution = value
+		case "minzoom":
+			m.info.MinZoom, _ = strconv.Atoi(value)
+		case "maxzoom":
+			m.info.MaxZoom, _ = strconv.Atoi(value)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if m.info.Format == "jpeg" {
+		m.info.Format = "jpg"
+	}
+	// Vector MBTiles store gzip-compressed protobuf by convention
+	m.info.Gzipped = m.info.Format == "pbf"
+	return m, nil
+}
+
+// Info returns the tile format and zoom range from the metadata table.
+func (m *MBTiles) Info() utils.TileInfo { return m.info }
+
+// Close closes the MBTiles database.
+func (m *MBTiles) Close() error { return m.db.Close() }
+
+// Tile returns the tile at z/x/y (XYZ addressing), or nil if the file doesn't have it.
+func (m *MBTiles) Tile(z, x, y int) ([]byte, error) {
+	var data []byte
+	// MBTiles rows count from the south (TMS), XYZ from the north
+	row := (1 << z) - 1 - y
+	err := m.db.QueryRow(`SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?`, z, x, row).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read tile: %w", err)
+	}
+	return data, nil
+}
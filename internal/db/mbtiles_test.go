@@ -0,0 +1,54 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestMBTilesTile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tiles.mbtiles")
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec(`CREATE TABLE metadata (name TEXT, value TEXT);
+        CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB);
+        INSERT INTO metadata VALUES ('format', 'jpeg'), ('minzoom', '0'), ('maxzoom', '3');
+        INSERT INTO tiles VALUES (0, 0, 0, 'z0'), (1, 0, 1, 'north-west'), (1, 0, 0, 'south-west'),
+            (3, 5, 0, 'southernmost'), (3, 5, 7, 'northernmost');`)
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := OpenMBTiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if info := m.Info(); info.Format != "jpg" || info.MinZoom != 0 || info.MaxZoom != 3 {
+		t.Errorf("Info = %+v, want jpg tiles from zoom 0 to 3", info)
+	}
+
+	// Rows count from the south in MBTiles and from the north in XYZ
+	tests := []struct {
+		z, x, y int
+		want    string
+	}{
+		{0, 0, 0, "z0"},
+		{1, 0, 0, "north-west"},
+		{1, 0, 1, "south-west"},
+		{3, 5, 7, "southernmost"},
+		{3, 5, 0, "northernmost"},
+		{3, 5, 3, ""}, // missing
+	}
+	for _, tt := range tests {
+		data, err := m.Tile(tt.z, tt.x, tt.y)
+		if err != nil {
+			t.Errorf("Tile(%d, %d, %d): %v", tt.z, tt.x, tt.y, err)
+		} else if string(data) != tt.want {
+			t.Errorf("Tile(%d, %d, %d) = %q, want %q", tt.z, tt.x, tt.y, data, tt.want)
+		}
+	}
+}
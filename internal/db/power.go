@@ -0,0 +1,128 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// InsertFTP stores a new FTP history entry.
+func InsertFTP(e models.FTPEntry) (int64, error) {
+	res, err := DB.Exec(`INSERT INTO ftp_history (effective_from, ftp) VALUES (?, ?)`, e.EffectiveFrom.UTC(), e.FTP)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert ftp: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetFTPHistory returns every FTP entry, newest first.
+func GetFTPHistory() ([]models.FTPEntry, error) {
+	rows, err := DB.Query(`SELECT id, effective_from, ftp FROM ftp_history`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ftp history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.FTPEntry
+	for rows.Next() {
+		var e models.FTPEntry
+		if err := rows.Scan(&e.ID, &e.EffectiveFrom, &e.FTP); err != nil {
+			return nil, fmt.Errorf("failed to scan ftp: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Sorted as times: the stored text only orders correctly when every offset is the same
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].EffectiveFrom.Equal(entries[j].EffectiveFrom) {
+			return entries[i].EffectiveFrom.After(entries[j].EffectiveFrom)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+	return entries, nil
+}
+
+// GetFTPAt returns the FTP in effect at t, the newest entry starting on or before it,
+// or 0 if none was, so rides older than the first entry get no IF or TSS.
+func GetFTPAt(t time.Time) (int, error) {
+	entries, err := GetFTPHistory()
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if !e.EffectiveFrom.After(t) {
+			return e.FTP, nil
+		}
+	}
+	return 0, nil
+}
+
+// SetActivityPowerCurve replaces the stored mean-maximal power curve of an activity.
+func SetActivityPowerCurve(activityID string, curve []utils.PowerCurvePoint) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM activity_power_curve WHERE activity_id = ?`, activityID); err != nil {
+		return fmt.Errorf("failed to clear power curve: %w", err)
+	}
+	for _, p := range curve {
+		if _, err := tx.Exec(`INSERT INTO activity_power_curve (activity_id, duration, watts) VALUES (?, ?, ?)`,
+			activityID, p.Duration, p.Watts); err != nil {
+			return fmt.Errorf("failed to insert power curve point: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetActivityPowerCurve returns the stored power curve of one activity.
+func GetActivityPowerCurve(activityID string) ([]utils.PowerCurvePoint, error) {
+	rows, err := DB.Query(`SELECT duration, watts FROM activity_power_curve WHERE activity_id = ? ORDER BY duration`, activityID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query power curve: %w", err)
+	}
+	defer rows.Close()
+
+	var curve []utils.PowerCurvePoint
+	for rows.Next() {
+		var p utils.PowerCurvePoint
+		if err := rows.Scan(&p.Duration, &p.Watts); err != nil {
+			return nil, fmt.Errorf("failed to scan power curve: %w", err)
+		}
+		curve = append(curve, p)
+	}
+	return curve, rows.Err()
+}
+
+// GetBestPowerCurve returns, for every duration, the best power of any activity between
+// from and to (zero times leave that side open), with the activity that set it.
+func GetBestPowerCurve(from, to time.Time) ([]utils.PowerCurvePoint, error) {
+	// SQLite fills the bare activity_id column from the row holding MAX(watts)
+	query := `SELECT c.duration, MAX(c.watts), c.activity_id
+        FROM activity_power_curve c JOIN activities a ON a.id = c.activity_id
+        WHERE (? OR a.timestamp >= ?) AND (? OR a.timestamp < ?)
+        GROUP BY c.duration
+        ORDER BY c.duration`
+	rows, err := DB.Query(query, from.IsZero(), from, to.IsZero(), to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query best power curve: %w", err)
+	}
+	defer rows.Close()
+
+	var curve []utils.PowerCurvePoint
+	for rows.Next() {
+		var p utils.PowerCurvePoint
+		if err := rows.Scan(&p.Duration, &p.Watts, &p.ActivityID); err != nil {
+			return nil, fmt.Errorf("failed to scan best power curve: %w", err)
+		}
+		curve = append(curve, p)
+	}
+	return curve, rows.Err()
+}
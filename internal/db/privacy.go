@@ -0,0 +1,44 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// InsertPrivacyZone stores a new privacy zone and returns its ID.
+func InsertPrivacyZone(z models.PrivacyZone) (int64, error) {
+	res, err := DB.Exec(`INSERT INTO privacy_zones (name, lat, lon, radius, created_at) VALUES (?, ?, ?, ?, ?)`,
+		z.Name, z.Lat, z.Lon, z.Radius, z.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert privacy zone: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetPrivacyZones returns every privacy zone, oldest first.
+func GetPrivacyZones() ([]models.PrivacyZone, error) {
+	rows, err := DB.Query(`SELECT id, name, lat, lon, radius, created_at FROM privacy_zones ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query privacy zones: %w", err)
+	}
+	defer rows.Close()
+
+	var zones []models.PrivacyZone
+	for rows.Next() {
+		var z models.PrivacyZone
+		if err := rows.Scan(&z.ID, &z.Name, &z.Lat, &z.Lon, &z.Radius, &z.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan privacy zone: %w", err)
+		}
+		zones = append(zones, z)
+	}
+	return zones, rows.Err()
+}
+
+// DeletePrivacyZone removes a privacy zone.
+func DeletePrivacyZone(id int64) error {
+	if _, err := DB.Exec(`DELETE FROM privacy_zones WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete privacy zone: %w", err)
+	}
+	return nil
+}
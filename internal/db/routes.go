@@ -0,0 +1,260 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// Route is a cluster of activities that follow the same path, with the fingerprint of
+// the activity that founded it or of a route merged into it.
+type Route struct {
+	ID          int64
+	Name        string
+	Sport       string
+	Fingerprint utils.RouteFingerprint
+}
+
+// RouteSummary is a route with statistics over its activities.
+type RouteSummary struct {
+	ID      int64
+	Name    string
+	Sport   string
+	Length  float64 // meters
+	Count   int
+	Best    float64 // fastest moving time, seconds
+	Average float64 // mean moving time, seconds
+	Last    time.Time
+}
+
+// RouteActivity is one activity of a route.
+type RouteActivity struct {
+	ActivityID string
+	Timestamp  time.Time
+	MovingTime float64 // seconds
+	Manual     bool
+}
+
+// InsertRoute creates a route founded on a fingerprint and returns its ID.
+func InsertRoute(sport string, fp utils.RouteFingerprint) (int64, error) {
+	points, err := json.Marshal(fp.Points)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode route points: %w", err)
+	}
+	res, err := DB.Exec(`INSERT INTO routes (sport, start_cell, end_cell, length, points_json) VALUES (?, ?, ?, ?, ?)`,
+		sport, fp.StartCell, fp.EndCell, fp.Length, string(points))
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert route: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// FindRoutes returns the routes of a sport starting and ending in any of the given cells.
+// A route that absorbed others in a merge is returned once for each of their fingerprints
+// too, so activities on any of the merged paths keep joining it.
+func FindRoutes(sport string, startCells, endCells []string) ([]Route, error) {
+	if len(startCells) == 0 || len(endCells) == 0 {
+		return nil, nil
+	}
+	args := []any{sport}
+	for _, c := range startCells {
+		args = append(args, c)
+	}
+	for _, c := range endCells {
+		args = append(args, c)
+	}
+	rows, err := DB.Query(`SELECT id, name, sport, start_cell, end_cell, length, points_json FROM (
+            SELECT id, name, sport, start_cell, end_cell, length, points_json, 0 AS merged FROM routes
+            UNION ALL
+            SELECT r.id, r.name, r.sport, f.start_cell, f.end_cell, f.length, f.points_json, 1
+            FROM route_fingerprints f JOIN routes r ON r.id = f.route_id)
+        WHERE sport = ? AND start_cell IN (?`+strings.Repeat(", ?", len(startCells)-1)+`)
+          AND end_cell IN (?`+strings.Repeat(", ?", len(endCells)-1)+`)
+        ORDER BY id, merged`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query routes: %w", err)
+	}
+	defer rows.Close()
+
+	var routes []Route
+	for rows.Next() {
+		var r Route
+		var points string
+		if err := rows.Scan(&r.ID, &r.Name, &r.Sport, &r.Fingerprint.StartCell, &r.Fingerprint.EndCell, &r.Fingerprint.Length, &points); err != nil {
+			return nil, fmt.Errorf("failed to scan route: %w", err)
+		}
+		if err := json.Unmarshal([]byte(points), &r.Fingerprint.Points); err != nil {
+			return nil, fmt.Errorf("failed to decode route points: %w", err)
+		}
+		routes = append(routes, r)
+	}
+	return routes, rows.Err()
+}
+
+// SetActivityRoute assigns an activity to a route and stores its fingerprint.
+func SetActivityRoute(activityID string, routeID int64, fp utils.RouteFingerprint, manual bool) error {
+	data, err := json.Marshal(fp)
+	if err != nil {
+		return fmt.Errorf("failed to encode fingerprint: %w", err)
+	}
+	_, err = DB.Exec(`INSERT INTO activity_routes (activity_id, route_id, manual, fingerprint_json) VALUES (?, ?, ?, ?)
+        ON CONFLICT(activity_id) DO UPDATE SET route_id = excluded.route_id, manual = excluded.manual,
+            fingerprint_json = excluded.fingerprint_json`, activityID, routeID, manual, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to set activity route: %w", err)
+	}
+	return pruneRoutes()
+}
+
+// GetActivityRoute returns the route of an activity and whether it was assigned by the
+// user; routeID is 0 when the activity has none.
+func GetActivityRoute(activityID string) (routeID int64, manual bool, err error) {
+	err = DB.QueryRow(`SELECT route_id, manual FROM activity_routes WHERE activity_id = ?`, activityID).Scan(&routeID, &manual)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, fmt.Errorf("failed to get activity route: %w", err)
+	}
+	return routeID, manual, nil
+}
+
+// GetActivityFingerprint returns the stored fingerprint of an activity, or nil.
+func GetActivityFingerprint(activityID string) (*utils.RouteFingerprint, error) {
+	var data string
+	err := DB.QueryRow(`SELECT fingerprint_json FROM activity_routes WHERE activity_id = ?`, activityID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get fingerprint: %w", err)
+	}
+	var fp utils.RouteFingerprint
+	if err := json.Unmarshal([]byte(data), &fp); err != nil {
+		return nil, fmt.Errorf("failed to decode fingerprint: %w", err)
+	}
+	return &fp, nil
+}
+
+// ClearActivityRoute removes an activity from its route.
+func ClearActivityRoute(activityID string) error {
+	if _, err := DB.Exec(`DELETE FROM activity_routes WHERE activity_id = ?`, activityID); err != nil {
+		return fmt.Errorf("failed to clear activity route: %w", err)
+	}
+	return pruneRoutes()
+}
+
+// pruneRoutes deletes routes that no longer have any activity.
+func pruneRoutes() error {
+	if _, err := DB.Exec(`DELETE FROM routes WHERE id NOT IN (SELECT route_id FROM activity_routes)`); err != nil {
+		return fmt.Errorf("failed to prune routes: %w", err)
+	}
+	return nil
+}
+
+// routeSummarySQL aggregates each route's activities; moving time comes from stats_json.
+const routeSummarySQL = `SELECT r.id, r.name, r.sport, r.length, COUNT(*),
+        MIN(json_extract(a.stats_json, '$.movingTime')), AVG(json_extract(a.stats_json, '$.movingTime')), MAX(a.timestamp)
+    FROM routes r
+    JOIN activity_routes ar ON ar.route_id = r.id
+    JOIN activities a ON a.id = ar.activity_id`
+
+// scanRouteSummary reads one row of routeSummarySQL.
+func scanRouteSummary(row interface{ Scan(...any) error }) (RouteSummary, error) {
+	var s RouteSummary
+	var best, avg sql.NullFloat64
+	var last string
+	if err := row.Scan(&s.ID, &s.Name, &s.Sport, &s.Length, &s.Count, &best, &avg, &last); err != nil {
+		return s, err
+	}
+	s.Best, s.Average = best.Float64, avg.Float64
+	s.Last, _ = parseTimestamp(last)
+	return s, nil
+}
+
+// GetRoutes returns every route that was done at least minCount times, most frequent first.
+func GetRoutes(minCount int) ([]RouteSummary, error) {
+	rows, err := DB.Query(routeSummarySQL+` GROUP BY r.id HAVING COUNT(*) >= ? ORDER BY COUNT(*) DESC, MAX(a.timestamp) DESC`, minCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query routes: %w", err)
+	}
+	defer rows.Close()
+
+	var routes []RouteSummary
+	for rows.Next() {
+		s, err := scanRouteSummary(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan route: %w", err)
+		}
+		routes = append(routes, s)
+	}
+	return routes, rows.Err()
+}
+
+// GetRoute returns the summary of one route, or nil if it doesn't exist.
+func GetRoute(id int64) (*RouteSummary, error) {
+	s, err := scanRouteSummary(DB.QueryRow(routeSummarySQL+` WHERE r.id = ? GROUP BY r.id`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get route: %w", err)
+	}
+	return &s, nil
+}
+
+// GetRouteActivities returns the activities of a route, oldest first.
+func GetRouteActivities(routeID int64) ([]RouteActivity, error) {
+	rows, err := DB.Query(`SELECT a.id, a.timestamp, COALESCE(json_extract(a.stats_json, '$.movingTime'), 0), ar.manual
+        FROM activity_routes ar JOIN activities a ON a.id = ar.activity_id
+        WHERE ar.route_id = ? ORDER BY a.timestamp`, routeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query route activities: %w", err)
+	}
+	defer rows.Close()
+
+	var activities []RouteActivity
+	for rows.Next() {
+		var ra RouteActivity
+		if err := rows.Scan(&ra.ActivityID, &ra.Timestamp, &ra.MovingTime, &ra.Manual); err != nil {
+			return nil, fmt.Errorf("failed to scan route activity: %w", err)
+		}
+		activities = append(activities, ra)
+	}
+	return activities, rows.Err()
+}
+
+// RenameRoute sets the name of a route.
+func RenameRoute(id int64, name string) error {
+	if _, err := DB.Exec(`UPDATE routes SET name = ? WHERE id = ?`, name, id); err != nil {
+		return fmt.Errorf("failed to rename route: %w", err)
+	}
+	return nil
+}
+
+// MergeRoutes moves every activity of route from into route into and deletes from. The
+// moved activities are marked manual so reclustering leaves them there, and into keeps
+// the fingerprints of from so later activities on its path join into as well.
+func MergeRoutes(into, from int64) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO route_fingerprints (route_id, start_cell, end_cell, length, points_json)
+        SELECT ?, start_cell, end_cell, length, points_json FROM routes WHERE id = ?`, into, from); err != nil {
+		return fmt.Errorf("failed to keep merged fingerprint: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE route_fingerprints SET route_id = ? WHERE route_id = ?`, into, from); err != nil {
+		return fmt.Errorf("failed to keep merged fingerprints: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE activity_routes SET route_id = ?, manual = 1 WHERE route_id = ?`, into, from); err != nil {
+		return fmt.Errorf("failed to merge routes: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return pruneRoutes()
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// SegmentSummary is a segment with its effort count and best time.
+type SegmentSummary struct {
+	models.Segment
+	Efforts int
+	Best    float64 // seconds, 0 without efforts
+}
+
+// RankedSegmentEffort is a stored segment effort with its place on the leaderboard.
+type RankedSegmentEffort struct {
+	utils.SegmentEffort
+	SegmentID   int64
+	SegmentName string
+	ActivityID  string
+	Timestamp   time.Time
+	Rank        int // 1 = fastest
+}
+
+// rankedSegmentEffortsSQL ranks every segment effort by time; ties keep the earlier
+// activity (then the earlier match) ahead.
+const rankedSegmentEffortsSQL = `SELECT e.segment_id, s.name, e.activity_id, a.timestamp, e.start_offset, e.end_offset, e.elapsed,
+        ROW_NUMBER() OVER (PARTITION BY e.segment_id ORDER BY e.elapsed, a.timestamp, e.rowid) AS rank
+    FROM segment_efforts e
+    JOIN segments s ON s.id = e.segment_id
+    JOIN activities a ON a.id = e.activity_id`
+
+// InsertSegment stores a new segment and returns its ID.
+func InsertSegment(seg models.Segment) (int64, error) {
+	points, err := json.Marshal(seg.Points)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode segment points: %w", err)
+	}
+	res, err := DB.Exec(`INSERT INTO segments (name, sport, points_json, length, source_activity_id, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		seg.Name, seg.Sport, string(points), seg.Length, seg.SourceActivityID, seg.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert segment: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// scanSegment reads the segment columns id, name, sport, points_json, length,
+// source_activity_id, created_at.
+func scanSegment(row interface{ Scan(...any) error }, extra ...any) (models.Segment, error) {
+	var seg models.Segment
+	var points string
+	var source sql.NullString
+	dest := append([]any{&seg.ID, &seg.Name, &seg.Sport, &points, &seg.Length, &source, &seg.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return seg, err
+	}
+	seg.SourceActivityID = source.String
+	if err := json.Unmarshal([]byte(points), &seg.Points); err != nil {
+		return seg, fmt.Errorf("failed to decode segment points: %w", err)
+	}
+	return seg, nil
+}
+
+// GetSegment returns a segment by ID, or nil if it doesn't exist.
+func GetSegment(id int64) (*models.Segment, error) {
+	seg, err := scanSegment(DB.QueryRow(`SELECT id, name, sport, points_json, length, source_activity_id, created_at
+        FROM segments WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get segment: %w", err)
+	}
+	return &seg, nil
+}
+
+// GetSegments returns every segment with its effort count and best time, by name.
+func GetSegments() ([]SegmentSummary, error) {
+	rows, err := DB.Query(`SELECT s.id, s.name, s.sport, s.points_json, s.length, s.source_activity_id, s.created_at,
+            COUNT(e.segment_id), COALESCE(MIN(e.elapsed), 0)
+        FROM segments s LEFT JOIN segment_efforts e ON e.segment_id = s.id
+        GROUP BY s.id ORDER BY s.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segments: %w", err)
+	}
+	defer rows.Close()
+
+	var segments []SegmentSummary
+	for rows.Next() {
+		var sum SegmentSummary
+		seg, err := scanSegment(rows, &sum.Efforts, &sum.Best)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan segment: %w", err)
+		}
+		sum.Segment = seg
+		segments = append(segments, sum)
+	}
+	return segments, rows.Err()
+}
+
+// DeleteSegment removes a segment and its efforts. It reports whether the segment existed.
+func DeleteSegment(id int64) (bool, error) {
+	res, err := DB.Exec(`DELETE FROM segments WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete segment: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete segment: %w", err)
+	}
+	return n > 0, nil
+}
+
+// SetSegmentEfforts replaces the efforts of one activity on one segment.
+func SetSegmentEfforts(segmentID int64, activityID string, efforts []utils.SegmentEffort) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM segment_efforts WHERE segment_id = ? AND activity_id = ?`, segmentID, activityID); err != nil {
+		return fmt.Errorf("failed to clear segment efforts: %w", err)
+	}
+	for _, e := range efforts {
+		if _, err := tx.Exec(`INSERT INTO segment_efforts (segment_id, activity_id, start_offset, end_offset, elapsed) VALUES (?, ?, ?, ?, ?)`,
+			segmentID, activityID, e.Start, e.End, e.Elapsed); err != nil {
+			return fmt.Errorf("failed to insert segment effort: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// queryRankedSegmentEfforts runs a filter over the ranked efforts.
+func queryRankedSegmentEfforts(where string, args ...any) ([]RankedSegmentEffort, error) {
+	rows, err := DB.Query(`SELECT * FROM (`+rankedSegmentEffortsSQL+`) WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segment efforts: %w", err)
+	}
+	defer rows.Close()
+
+	var efforts []RankedSegmentEffort
+	for rows.Next() {
+		var e RankedSegmentEffort
+		if err := rows.Scan(&e.SegmentID, &e.SegmentName, &e.ActivityID, &e.Timestamp, &e.Start, &e.End, &e.Elapsed, &e.Rank); err != nil {
+			return nil, fmt.Errorf("failed to scan segment effort: %w", err)
+		}
+		efforts = append(efforts, e)
+	}
+	return efforts, rows.Err()
+}
+
+// GetSegmentLeaderboard returns all efforts on a segment, fastest first.
+func GetSegmentLeaderboard(segmentID int64) ([]RankedSegmentEffort, error) {
+	return queryRankedSegmentEfforts(`segment_id = ? ORDER BY rank`, segmentID)
+}
+
+// GetActivitySegmentEfforts returns an activity's segment efforts with their leaderboard
+// rank, in the order they were ridden.
+func GetActivitySegmentEfforts(activityID string) ([]RankedSegmentEffort, error) {
+	return queryRankedSegmentEfforts(`activity_id = ? ORDER BY start_offset`, activityID)
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// GetShareToken returns the share token of an activity, or "" when it was never shared.
+func GetShareToken(activityID string) (string, error) {
+	var token string
+	err := DB.QueryRow(`SELECT token FROM activity_shares WHERE activity_id = ?`, activityID).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get share token: %w", err)
+	}
+	return token, nil
+}
+
+// SetShareToken stores the share token of an activity; an existing one is kept.
+func SetShareToken(activityID, token string) error {
+	_, err := DB.Exec(`INSERT INTO activity_shares (token, activity_id) VALUES (?, ?)
+        ON CONFLICT(activity_id) DO NOTHING`, token, activityID)
+	if err != nil {
+		return fmt.Errorf("failed to store share token: %w", err)
+	}
+	return nil
+}
+
+// GetSharedActivityID returns the activity a share token stands for, or "" for
+// unknown tokens.
+func GetSharedActivityID(token string) (string, error) {
+	var id string
+	err := DB.QueryRow(`SELECT activity_id FROM activity_shares WHERE token = ?`, token).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to look up share token: %w", err)
+	}
+	return id, nil
+}
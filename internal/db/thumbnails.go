@@ -0,0 +1,62 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SetActivityThumbnail stores the route thumbnail PNG of an activity. An empty png
+// records that the activity has no track to draw.
+func SetActivityThumbnail(activityID string, png []byte) error {
+	if png == nil {
+		png = []byte{}
+	}
+	_, err := DB.Exec(`INSERT INTO activity_thumbnails (activity_id, png) VALUES (?, ?)
+        ON CONFLICT(activity_id) DO UPDATE SET png = excluded.png, created_at = CURRENT_TIMESTAMP`, activityID, png)
+	if err != nil {
+		return fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+	return nil
+}
+
+// ClearAllThumbnails removes every stored thumbnail, so they are rendered again on
+// request, e.g. after the privacy zones changed.
+func ClearAllThumbnails() error {
+	if _, err := DB.Exec(`DELETE FROM activity_thumbnails`); err != nil {
+		return fmt.Errorf("failed to clear thumbnails: %w", err)
+	}
+	return nil
+}
+
+// GetActivityThumbnail returns the stored thumbnail PNG of an activity and whether one
+// was stored; the PNG is empty for an activity without a track.
+func GetActivityThumbnail(activityID string) ([]byte, bool, error) {
+	var data []byte
+	err := DB.QueryRow(`SELECT png FROM activity_thumbnails WHERE activity_id = ?`, activityID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to get thumbnail: %w", err)
+	}
+	return data, true, nil
+}
+
+// GetActivitiesWithoutThumbnail returns the IDs of the activities known to have no
+// track to draw.
+func GetActivitiesWithoutThumbnail() (map[string]bool, error) {
+	rows, err := DB.Query(`SELECT activity_id FROM activity_thumbnails WHERE length(png) = 0`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query thumbnails: %w", err)
+	}
+	defer rows.Close()
+
+	ids := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan thumbnail: %w", err)
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
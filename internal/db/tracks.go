@@ -0,0 +1,47 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SimplifiedTrack is one stored simplification of an activity's track.
+type SimplifiedTrack struct {
+	Level     int
+	Tolerance float64 // meters
+	Points    int
+	Polyline  string // encoded polyline
+}
+
+// SetActivityTracks replaces the simplified tracks of an activity.
+func SetActivityTracks(activityID string, tracks []SimplifiedTrack) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM activity_tracks WHERE activity_id = ?`, activityID); err != nil {
+		return fmt.Errorf("failed to clear tracks: %w", err)
+	}
+	for _, t := range tracks {
+		if _, err := tx.Exec(`INSERT INTO activity_tracks (activity_id, level, tolerance, points, polyline) VALUES (?, ?, ?, ?, ?)`,
+			activityID, t.Level, t.Tolerance, t.Points, t.Polyline); err != nil {
+			return fmt.Errorf("failed to insert track: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetActivityTrack returns one simplification level of an activity's track, or nil.
+func GetActivityTrack(activityID string, level int) (*SimplifiedTrack, error) {
+	t := SimplifiedTrack{Level: level}
+	err := DB.QueryRow(`SELECT tolerance, points, polyline FROM activity_tracks WHERE activity_id = ? AND level = ?`,
+		activityID, level).Scan(&t.Tolerance, &t.Points, &t.Polyline)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get track: %w", err)
+	}
+	return &t, nil
+}
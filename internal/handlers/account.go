@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// Full account archives: manifest.json, the database dump in ownpath.json, the uploaded
+// files under originals/{id}/ and every activity as gpx/{id}.gpx.
+const (
+	accountFormat   = "ownpath-account"
+	accountVersion  = 1
+	accountDumpName = "ownpath.json"
+	maxRestoreSize  = 4 << 30 // 4 GB
+)
+
+type accountManifest struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Activities int       `json:"activities"`
+	Tables     []string  `json:"tables"`
+}
+
+// writeAccountDump writes the account tables as {"tables": {"name": [rows]}}, a row at
+// a time.
+func writeAccountDump(w io.Writer) error {
+	if _, err := io.WriteString(w, `{"tables":{`); err != nil {
+		return err
+	}
+	for i, table := range db.AccountTables {
+		sep := ","
+		if i == 0 {
+			sep = ""
+		}
+		if _, err := fmt.Fprintf(w, "%s%q:[", sep, table); err != nil {
+			return err
+		}
+		n := 0
+		err := db.DumpTable(table, func(row map[string]any) error {
+			if n > 0 {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			n++
+			b, err := json.Marshal(row)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s row: %w", table, err)
+			}
+			_, err = w.Write(b)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "]"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "}}\n")
+	return err
+}
+
+// writeAccountArchive writes the full account export as a ZIP archive.
+func writeAccountArchive(w io.Writer, activities []models.Activity) error {
+	zw := zip.NewWriter(w)
+	now := time.Now()
+	create := func(name string) (io.Writer, error) {
+		return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+	}
+	f, err := create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(accountManifest{
+		Format:     accountFormat,
+		Version:    accountVersion,
+		ExportedAt: now.UTC(),
+		Activities: len(activities),
+		Tables:     db.AccountTables,
+	})
+	if err != nil {
+		return err
+	}
+
+	if f, err = create(accountDumpName); err != nil {
+		return err
+	}
+	if err := writeAccountDump(f); err != nil {
+		return err
+	}
+
+	for _, act := range activities {
+		original, err := db.GetActivityFile(act.ID)
+		if err != nil {
+			return err
+		}
+		if original != nil {
+			if f, err = create("originals/" + act.ID + "/" + original.Filename); err != nil {
+				return err
+			}
+			if _, err := f.Write(original.Data); err != nil {
+				return err
+			}
+		}
+
+		records, err := db.GetActivityRecords(act.ID)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			continue
+		}
+		utils.EnsureDistance(records)
+		if f, err = create("gpx/" + act.ID + ".gpx"); err != nil {
+			return err
+		}
+		if err := utils.WriteGPX(f, exportName(act), act.Type, act.Timestamp, utils.SplitAtPauses(records)); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// AccountExportHandler serves GET /api/account/export: everything needed to move to
+// another instance as a ZIP archive. Privacy zones are not trimmed: this is the owner's
+// copy.
+func AccountExportHandler(w http.ResponseWriter, r *http.Request) {
+	activities, err := db.ListActivities()
+	if err != nil {
+		log.Printf("Error loading activities for account export: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="ownpath-account-%s.zip"`, time.Now().Format("2006-01-02")))
+	// The archive is streamed, so errors past this point can only be logged
+	if err := writeAccountArchive(w, activities); err != nil {
+		log.Printf("Error writing account export: %v", err)
+	}
+}
+
+// expectDelim reads the next JSON token and checks that it is the delimiter d.
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != d {
+		return fmt.Errorf("expected %q, found %v", d, tok)
+	}
+	return nil
+}
+
+// restoreAccountDump inserts the rows of a dump written by writeAccountDump, streaming
+// them from r. Returns the number of activities restored.
+func restoreAccountDump(r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	restore, err := db.BeginAccountRestore()
+	if err != nil {
+		return 0, err
+	}
+	defer restore.Rollback()
+
+	activities := 0
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, err
+	}
+	for dec.More() {
+		var key string
+		if err := dec.Decode(&key); err != nil {
+			return 0, err
+		}
+		if key != "tables" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err := expectDelim(dec, '{'); err != nil {
+			return 0, err
+		}
+		for dec.More() {
+			var table string
+			if err := dec.Decode(&table); err != nil {
+				return 0, err
+			}
+			if err := expectDelim(dec, '['); err != nil {
+				return 0, err
+			}
+			for dec.More() {
+				var row map[string]any
+				if err := dec.Decode(&row); err != nil {
+					return 0, fmt.Errorf("invalid %s row: %w", table, err)
+				}
+				if err := restore.Insert(table, row); err != nil {
+					return 0, err
+				}
+				if table == "activities" {
+					activities++
+				}
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return 0, err
+			}
+		}
+		if err := expectDelim(dec, '}'); err != nil {
+			return 0, err
+		}
+	}
+	return activities, restore.Commit()
+}
+
+// restoreAccount restores an account archive into this instance: the database dump,
+// then the original files. The analyses derived from them are left to restoreJob.
+func restoreAccount(zr *zip.Reader) (int, error) {
+	var manifest accountManifest
+	f, err := zr.Open("manifest.json")
+	if err != nil {
+		return 0, fmt.Errorf("not an OwnPath account export: %w", err)
+	}
+	err = json.NewDecoder(f).Decode(&manifest)
+	f.Close()
+	if err != nil || manifest.Format != accountFormat {
+		return 0, fmt.Errorf("not an OwnPath account export")
+	}
+	if manifest.Version > accountVersion {
+		return 0, fmt.Errorf("account export version %d is newer than this instance supports", manifest.Version)
+	}
+
+	if f, err = zr.Open(accountDumpName); err != nil {
+		return 0, fmt.Errorf("archive has no %s: %w", accountDumpName, err)
+	}
+	n, err := restoreAccountDump(f)
+	f.Close()
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", accountDumpName, err)
+	}
+
+	for _, zf := range zr.File {
+		id, name, ok := strings.Cut(strings.TrimPrefix(zf.Name, "originals/"), "/")
+		if !strings.HasPrefix(zf.Name, "originals/") || !ok || name == "" || strings.Contains(name, "/") {
+			continue
+		}
+		if act, err := db.GetActivityByID(id); err != nil || act == nil {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return n, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return n, fmt.Errorf("failed to read %s: %w", zf.Name, err)
+		}
+		format := strings.TrimPrefix(strings.ToLower(path.Ext(name)), ".")
+		if err := db.SetActivityFile(id, db.ActivityFile{Filename: name, Format: format, Data: data}); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// restoreJob rebuilds the derived data of a restored account rather than restoring it,
+// oldest first so personal records are ranked as they were set.
+var restoreJob = newBackgroundJob("analyzing restored activities", func() error {
+	activities, err := db.ListActivities()
+	if err != nil {
+		return err
+	}
+	for _, act := range activities {
+		records, err := db.GetActivityRecords(act.ID)
+		if err != nil {
+			log.Printf("Error loading records of %s after restore: %v", act.ID, err)
+			continue
+		}
+		if len(records) > 0 {
+			analyzeActivity(act, records)
+		}
+	}
+	TriggerTrainingLoadRecompute()
+	return nil
+})
+
+// StartRestoreWorker runs the analyses an account restore queues.
+func StartRestoreWorker() {
+	restoreJob.Start()
+}
+
+// AccountImportHandler restores an archive written by AccountExportHandler, uploaded as
+// the "archive" form field (POST), with activity and other IDs preserved. The instance
+// must not hold any activities or user data yet. The response follows the analysis of
+// the restored activities (GET) and reloads the page once it is done.
+func AccountImportHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		accountImportProgress(w, r, "")
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	empty, err := db.AccountIsEmpty()
+	if err != nil {
+		log.Printf("Error checking instance before restore: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !empty {
+		http.Error(w, "Restore needs an empty instance: this one already has data", http.StatusConflict)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRestoreSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("archive")
+	if err != nil {
+		http.Error(w, "Failed to get file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	zr, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		http.Error(w, "Invalid ZIP archive: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n, err := restoreAccount(zr)
+	if err != nil {
+		log.Printf("Error restoring account from %s: %v", header.Filename, err)
+		http.Error(w, "Failed to restore account: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Restored account from %s: %d activities", header.Filename, n)
+	restoreJob.Trigger()
+	accountImportProgress(w, r, fmt.Sprintf("<p>Restored %d activities.</p>", n))
+}
+
+// accountImportProgress writes msg and, while the restored activities are analyzed, a
+// note that polls for the end; every section of the page changed by then, so it reloads.
+func accountImportProgress(w http.ResponseWriter, r *http.Request, msg string) {
+	progress := jobProgress(w, r, restoreJob, "/api/account/import", "#account-status", "Analyzing the restored activities…", "")
+	if progress == "" && r.URL.Query().Get("wait") == "1" {
+		w.Header().Set("HX-Refresh", "true")
+	}
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, msg+progress)
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// Where database snapshots go and how many are kept; backups are off while backupDir is empty.
+var (
+	backupDir        string
+	backupKeepDaily  int
+	backupKeepWeekly int
+)
+
+// backupMu serializes snapshots, rotation and restores, which may be started by the
+// schedule and the admin endpoints at the same time.
+var backupMu sync.Mutex
+
+// snapshot is a database snapshot in the backup directory.
+type snapshot struct {
+	Name  string
+	Taken time.Time
+	Size  int64
+}
+
+// SetBackupDir enables snapshots into dir, created if needed, keeping the newest
+// snapshot of each of the last keepDaily days and keepWeekly weeks.
+func SetBackupDir(dir string, keepDaily, keepWeekly int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	backupDir, backupKeepDaily, backupKeepWeekly = dir, keepDaily, keepWeekly
+	return nil
+}
+
+// StartBackupWorker takes a snapshot whenever the newest one is older than interval,
+// checking at startup and then periodically.
+func StartBackupWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(min(interval, time.Hour))
+		defer ticker.Stop()
+		for {
+			if err := backupIfDue(interval); err != nil {
+				log.Printf("Error taking scheduled backup: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// backupIfDue takes a snapshot if none was taken within interval.
+func backupIfDue(interval time.Duration) error {
+	snapshots, err := listSnapshots()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) > 0 && time.Since(snapshots[0].Taken) < interval {
+		return nil
+	}
+	_, err = CreateBackup()
+	return err
+}
+
+// listSnapshots returns the snapshots in the backup directory, newest first.
+func listSnapshots() ([]snapshot, error) {
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	var snapshots []snapshot
+	for _, e := range entries {
+		taken, ok := utils.ParseSnapshotName(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, snapshot{Name: e.Name(), Taken: taken, Size: info.Size()})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Taken.After(snapshots[j].Taken) })
+	return snapshots, nil
+}
+
+// CreateBackup snapshots the database into the backup directory, verifies it and
+// deletes the snapshots the rotation no longer keeps. It returns the snapshot's path.
+func CreateBackup() (string, error) {
+	if backupDir == "" {
+		return "", fmt.Errorf("backups are not configured")
+	}
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	path := filepath.Join(backupDir, utils.SnapshotName(time.Now()))
+	if err := db.Snapshot(path); err != nil {
+		return "", err
+	}
+	log.Printf("Database snapshot written to %s", path)
+	if err := rotateBackups(); err != nil {
+		log.Printf("Error rotating backups: %v", err)
+	}
+	return path, nil
+}
+
+// rotateBackups deletes the snapshots outside the retention policy.
+func rotateBackups() error {
+	snapshots, err := listSnapshots()
+	if err != nil {
+		return err
+	}
+	times := make([]time.Time, len(snapshots))
+	for i, s := range snapshots {
+		times[i] = s.Taken
+	}
+	keep := utils.SnapshotsToKeep(times, backupKeepDaily, backupKeepWeekly)
+	for _, s := range snapshots {
+		if keep[s.Taken] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(backupDir, s.Name)); err != nil {
+			return fmt.Errorf("failed to delete old backup: %w", err)
+		}
+		log.Printf("Deleted old snapshot %s", s.Name)
+	}
+	return nil
+}
+
+// RestoreBackup replaces the database contents with the snapshot at path while the
+// server keeps running. When backups are configured, the current data is snapshotted
+// first so the restore can itself be undone; no rotation runs then, as it could delete
+// the snapshot being restored.
+func RestoreBackup(path string) error {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+	if backupDir != "" {
+		if err := db.Snapshot(filepath.Join(backupDir, utils.SnapshotName(time.Now()))); err != nil {
+			return fmt.Errorf("failed to back up current data before restoring: %w", err)
+		}
+	}
+	if err := db.RestoreSnapshot(path); err != nil {
+		return err
+	}
+	log.Printf("Database restored from %s", path)
+	TriggerTrainingLoadRecompute()
+	return nil
+}
+
+// backupsHTML renders the backup list with a restore button per snapshot.
+func backupsHTML(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "text/html")
+	if backupDir == "" {
+		fmt.Fprint(w, `<p>Backups are off. Start OwnPath with <code>-backup-dir</code> to enable them.</p>`)
+		return
+	}
+	snapshots, err := listSnapshots()
+	if err != nil {
+		log.Printf("Error listing backups: %v", err)
+		http.Error(w, "Failed to list backups", http.StatusInternalServerError)
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<p>Snapshots in <code>%s</code>, keeping %d daily and %d weekly.</p>
+	<button hx-post="/api/admin/backups" hx-target="#backups" hx-swap="innerHTML">Back up now</button>`,
+		html.EscapeString(backupDir), backupKeepDaily, backupKeepWeekly)
+	b.WriteString(msg)
+	if len(snapshots) == 0 {
+		b.WriteString("<p>No snapshots yet.</p>")
+	} else {
+		b.WriteString("<table><thead><tr><th>Taken</th><th>Size</th><th></th></tr></thead><tbody>")
+		for _, s := range snapshots {
+			name := html.EscapeString(s.Name)
+			fmt.Fprintf(&b, `<tr><td>%s</td><td>%.1f MB</td><td><button hx-post="/api/admin/backups/restore" hx-vals='{"name": "%s"}' hx-target="#backups" hx-swap="innerHTML" hx-confirm="Replace all data with the snapshot of %s?">Restore</button></td></tr>`,
+				s.Taken.Local().Format("2006-01-02 15:04"), float64(s.Size)/(1<<20), name, s.Taken.Local().Format("2006-01-02 15:04"))
+		}
+		b.WriteString("</tbody></table>")
+	}
+	fmt.Fprint(w, b.String())
+}
+
+// BackupsHandler lists the database snapshots (GET) and takes one now (POST), as an
+// HTML partial for HTMX.
+func BackupsHandler(w http.ResponseWriter, r *http.Request) {
+	var msg string
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if backupDir == "" {
+			http.Error(w, "Backups are not configured", http.StatusBadRequest)
+			return
+		}
+		path, err := CreateBackup()
+		if err != nil {
+			log.Printf("Error taking backup: %v", err)
+			http.Error(w, "Failed to back up database", http.StatusInternalServerError)
+			return
+		}
+		msg = fmt.Sprintf("<p>Saved %s.</p>", html.EscapeString(filepath.Base(path)))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	backupsHTML(w, msg)
+}
+
+// BackupRestoreHandler restores the snapshot named by the "name" form field (POST).
+func BackupRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if backupDir == "" {
+		http.Error(w, "Backups are not configured", http.StatusBadRequest)
+		return
+	}
+	// Only snapshot names are accepted, so no other file can be restored from
+	name := r.FormValue("name")
+	if _, ok := utils.ParseSnapshotName(name); !ok || filepath.Base(name) != name {
+		http.Error(w, "Invalid snapshot name", http.StatusBadRequest)
+		return
+	}
+	if err := RestoreBackup(filepath.Join(backupDir, name)); err != nil {
+		log.Printf("Error restoring %s: %v", name, err)
+		http.Error(w, "Failed to restore backup: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Every section of the page changed
+	w.Header().Set("HX-Refresh", "true")
+	backupsHTML(w, fmt.Sprintf("<p>Restored %s.</p>", html.EscapeString(name)))
+}
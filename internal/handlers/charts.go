@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// chartMaxPoints is the default number of points a stream chart is downsampled to.
+const chartMaxPoints = 600
+
+// chartSmoothing is the moving-average window (samples) applied to the noisy speed and
+// power streams before charting.
+const chartSmoothing = 5
+
+// Chart x axes.
+const (
+	chartAxisDistance = "distance"
+	chartAxisTime     = "time"
+)
+
+// timeAtDistance returns the elapsed seconds at which the activity reached a distance.
+func timeAtDistance(records []models.Record, distance float64) float64 {
+	i := sort.Search(len(records), func(i int) bool { return records[i].Distance >= distance })
+	if i >= len(records) {
+		i = len(records) - 1
+	}
+	return records[i].Time.Sub(records[0].Time).Seconds()
+}
+
+// renderActivityCharts builds the stream charts of the activity detail partial:
+// elevation (with climbs shaded), pace or speed, heart rate, cadence and power, each
+// against distance or elapsed time and downsampled to maxPoints (0 for every sample).
+// Sensor channels the activity never recorded are left out.
+func renderActivityCharts(act models.Activity, records []models.Record, units, axis string, maxPoints int) string {
+	if len(records) < 2 {
+		return ""
+	}
+	unitLength := utils.UnitLength(units)
+	xs := make([]float64, len(records))
+	opts := utils.ChartOptions{Width: 800, Height: 160}
+	if axis == chartAxisTime {
+		for i, r := range records {
+			xs[i] = r.Time.Sub(records[0].Time).Seconds()
+		}
+		opts.XFormat = utils.FormatDuration
+	} else {
+		axis = chartAxisDistance
+		for i, r := range records {
+			xs[i] = r.Distance / unitLength
+		}
+		opts.XFormat = func(v float64) string { return fmt.Sprintf("%.1f %s", v, utils.DistanceLabel(units)) }
+	}
+
+	chart := func(title string, opts utils.ChartOptions, series utils.ChartSeries) string {
+		series.X, series.Y = utils.Downsample(series.X, series.Y, maxPoints)
+		return `<h3>` + title + `</h3>` + utils.LineChartSVG(opts, series)
+	}
+	out := fmt.Sprintf(`<div id="activity-charts"><p>Charts against
+		<button hx-get="/api/activity/charts?id=%[1]s&x=distance&points=%[2]d" hx-target="#activity-charts" hx-swap="outerHTML"%[3]s>Distance</button>
+		<button hx-get="/api/activity/charts?id=%[1]s&x=time&points=%[2]d" hx-target="#activity-charts" hx-swap="outerHTML"%[4]s>Time</button>`,
+		html.EscapeString(act.ID), maxPoints, disabledIf(axis == chartAxisDistance), disabledIf(axis == chartAxisTime))
+	if maxPoints > 0 {
+		out += fmt.Sprintf(` <button hx-get="/api/activity/charts?id=%s&x=%s&points=0" hx-target="#activity-charts" hx-swap="outerHTML">Full resolution</button>`, html.EscapeString(act.ID), axis)
+	} else {
+		out += fmt.Sprintf(` <button hx-get="/api/activity/charts?id=%s&x=%s&points=%d" hx-target="#activity-charts" hx-swap="outerHTML">Downsampled</button>`, html.EscapeString(act.ID), axis, chartMaxPoints)
+	}
+	out += `</p>`
+
+	if alt := utils.SmoothAltitude(records); alt != nil {
+		climbs, err := db.GetActivityClimbs(act.ID)
+		if err != nil {
+			log.Printf("Warning: Failed to load climbs for %s: %v", act.ID, err)
+		}
+		elevOpts := opts
+		elevOpts.YFormat = func(v float64) string { return fmt.Sprintf("%.0f m", v) }
+		for _, c := range climbs {
+			band := utils.ChartBand{Label: c.Category, Color: climbColors[c.Category]}
+			if axis == chartAxisTime {
+				band.From, band.To = timeAtDistance(records, c.StartDistance), timeAtDistance(records, c.EndDistance)
+			} else {
+				band.From, band.To = c.StartDistance/unitLength, c.EndDistance/unitLength
+			}
+			elevOpts.Bands = append(elevOpts.Bands, band)
+		}
+		out += chart("Elevation", elevOpts, utils.ChartSeries{Name: "Elevation", Color: "#795548", X: xs, Y: alt, Fill: true})
+	}
+
+	speed := utils.MovingAverage(utils.SpeedStream(records), chartSmoothing)
+	speedOpts := opts
+	if utils.IsPaceSport(act.Type) {
+		// Stops would send the pace to infinity; cap it at the moving threshold
+		threshold := utils.MovingSpeedThreshold(act.Type)
+		pace := make([]float64, len(speed))
+		for i, s := range speed {
+			pace[i] = unitLength / max(s, threshold)
+		}
+		speedOpts.YFormat = func(v float64) string { return utils.FormatPace(v) + " /" + utils.DistanceLabel(units) }
+		out += chart("Pace", speedOpts, utils.ChartSeries{Name: "Pace", Color: "#1976d2", X: xs, Y: pace})
+	} else {
+		perHour := make([]float64, len(speed))
+		for i, s := range speed {
+			perHour[i] = s * 3600 / unitLength
+		}
+		label := "km/h"
+		if units == utils.UnitsImperial {
+			label = "mph"
+		}
+		speedOpts.YFormat = func(v float64) string { return fmt.Sprintf("%.0f %s", v, label) }
+		speedOpts.NonNeg = true
+		out += chart("Speed", speedOpts, utils.ChartSeries{Name: "Speed", Color: "#1976d2", X: xs, Y: perHour})
+	}
+
+	// Zero heart rate is a strap dropout, not a reading
+	var hrX, hrY []float64
+	for i, r := range records {
+		if r.HeartRate > 0 {
+			hrX, hrY = append(hrX, xs[i]), append(hrY, float64(r.HeartRate))
+		}
+	}
+	if len(hrX) > 0 {
+		hrOpts := opts
+		hrOpts.YFormat = func(v float64) string { return fmt.Sprintf("%.0f bpm", v) }
+		out += chart("Heart rate", hrOpts, utils.ChartSeries{Name: "Heart rate", Color: "#e53935", X: hrX, Y: hrY})
+	}
+
+	// Zero cadence and power are real (coasting), so those charts keep every sample
+	cadence := make([]float64, len(records))
+	power := make([]float64, len(records))
+	var hasCadence bool
+	for i, r := range records {
+		cadence[i], power[i] = float64(r.Cadence), float64(r.Power)
+		hasCadence = hasCadence || r.Cadence > 0
+	}
+	opts.NonNeg = true
+	if hasCadence {
+		out += chart("Cadence", opts, utils.ChartSeries{Name: "Cadence", Color: "#8e24aa", X: xs, Y: cadence})
+	}
+	if utils.HasPower(records) {
+		powerOpts := opts
+		powerOpts.YFormat = func(v float64) string { return fmt.Sprintf("%.0f W", v) }
+		out += chart("Power", powerOpts, utils.ChartSeries{Name: "Power", Color: "#fb8c00", X: xs, Y: utils.MovingAverage(power, chartSmoothing), Fill: true})
+	}
+	return out + `</div>`
+}
+
+// disabledIf returns the disabled attribute when cond holds, for toggle buttons.
+func disabledIf(cond bool) string {
+	if cond {
+		return " disabled"
+	}
+	return ""
+}
+
+// ActivityChartsHandler returns the stream charts partial of the activity ?id= against
+// ?x=distance (default) or ?x=time, downsampled to ?points= samples (0 for all).
+func ActivityChartsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	act, err := db.GetActivityByID(q.Get("id"))
+	if err != nil {
+		log.Printf("Error loading activity %s: %v", q.Get("id"), err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if act == nil {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return
+	}
+	maxPoints := chartMaxPoints
+	if v := q.Get("points"); v != "" {
+		if maxPoints, err = strconv.Atoi(v); err != nil || maxPoints < 0 {
+			http.Error(w, "Invalid points parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	records, err := db.GetActivityRecords(act.ID)
+	if err != nil {
+		log.Printf("Error loading records for %s: %v", act.ID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	utils.EnsureDistance(records)
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, renderActivityCharts(*act, records, getUnits(), q.Get("x"), maxPoints))
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// climbSearchDelta is the lat/lon box (degrees, roughly 1 km) searched for repeats of a
+// climb before the exact utils.SameClimb comparison.
+const climbSearchDelta = 0.01
+
+// climbColors shade climbs on the elevation chart by category.
+var climbColors = map[string]string{
+	"Cat 4": "#4caf50",
+	"Cat 3": "#ffc107",
+	"Cat 2": "#ff9800",
+	"Cat 1": "#f44336",
+	"HC":    "#7b1fa2",
+}
+
+// updateActivityClimbs detects and stores the climbs of a ride or hike.
+func updateActivityClimbs(act models.Activity, records []models.Record) error {
+	if !utils.ClimbSport(act.Type) {
+		return db.SetActivityClimbs(act.ID, nil)
+	}
+	return db.SetActivityClimbs(act.ID, utils.DetectClimbs(records))
+}
+
+// formatGrade formats a grade fraction as a percentage.
+func formatGrade(g float64) string {
+	return fmt.Sprintf("%.1f%%", g*100)
+}
+
+// renderActivityClimbs builds the climbs table of the activity detail partial; the
+// climbs are shaded on the elevation chart by renderActivityCharts.
+func renderActivityClimbs(act models.Activity, units string) string {
+	climbs, err := db.GetActivityClimbs(act.ID)
+	if err != nil {
+		log.Printf("Warning: Failed to load climbs for %s: %v", act.ID, err)
+	}
+	if len(climbs) == 0 {
+		return ""
+	}
+	out := `<h3>Climbs</h3><table class="climbs"><thead><tr><th>Category</th><th>Starts at</th><th>Length</th><th>Gain (m)</th><th>Avg grade</th><th>Max grade</th><th>Time</th><th></th></tr></thead><tbody>`
+	for _, c := range climbs {
+		out += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%.0f</td><td>%s</td><td>%s</td><td>%s</td>
+			<td><button hx-get="/api/climbs/efforts?climb=%d" hx-target="#climb-efforts" hx-swap="innerHTML">All efforts</button></td></tr>`,
+			c.Category, utils.FormatDistance(c.StartDistance, units), utils.FormatDistance(c.Length, units), c.Gain,
+			formatGrade(c.AvgGrade), formatGrade(c.MaxGrade), utils.FormatDuration(c.Duration), c.ID)
+	}
+	return out + `</tbody></table><div id="climb-efforts"></div>`
+}
+
+// ClimbEffortsHandler returns an HTML partial listing every time the climb ?climb=<id>
+// was ridden or hiked, matched geographically across all activities.
+func ClimbEffortsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("climb"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid climb parameter", http.StatusBadRequest)
+		return
+	}
+	climb, err := db.GetClimb(id)
+	if err != nil {
+		log.Printf("Error loading climb %d: %v", id, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if climb == nil {
+		http.Error(w, "Climb not found", http.StatusNotFound)
+		return
+	}
+	candidates, err := db.GetClimbsStartingNear(climb.StartLat, climb.StartLon, climbSearchDelta)
+	if err != nil {
+		log.Printf("Error matching climb %d: %v", id, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	var efforts []db.StoredClimb
+	best := -1
+	for _, c := range candidates {
+		if c.ID != climb.ID && !utils.SameClimb(climb.Climb, c.Climb) {
+			continue
+		}
+		efforts = append(efforts, c)
+		if best == -1 || c.Duration < efforts[best].Duration {
+			best = len(efforts) - 1
+		}
+	}
+
+	units := getUnits()
+	out := fmt.Sprintf(`<h4>%s climb, %s at %s: %d efforts</h4>
+		<table class="climb-efforts"><thead><tr><th>Date</th><th>Time</th><th>VAM (m/h)</th><th></th></tr></thead><tbody>`,
+		climb.Category, utils.FormatDistance(climb.Length, units), formatGrade(climb.AvgGrade), len(efforts))
+	for i, c := range efforts {
+		vam := 0.0
+		if c.Duration > 0 {
+			vam = c.Gain / c.Duration * 3600
+		}
+		badge := ""
+		if i == best {
+			badge = `<span class="badge">Fastest</span>`
+		}
+		out += fmt.Sprintf(`<tr><td><a href="/detail.html?id=%s">%s</a></td><td>%s</td><td>%.0f</td><td>%s</td></tr>`,
+			html.EscapeString(c.ActivityID), c.Timestamp.Format("2006-01-02"), utils.FormatDuration(c.Duration), vam, badge)
+	}
+	out += `</tbody></table>`
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, out)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gratten/ownpath/internal/config"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// Server settings from the configuration; the defaults apply until Configure runs.
+var (
+	uploadLimit  int64 = 10 << 20 // bytes
+	defaultUnits       = utils.UnitsMetric
+	baseURL      string
+	features     = config.Default().Features
+)
+
+// Configure applies the parts of the server configuration the handlers use.
+func Configure(cfg *config.Config) {
+	uploadLimit = cfg.UploadLimit << 20
+	defaultUnits = cfg.Units
+	baseURL = cfg.BaseURL
+	features = cfg.Features
+}
+
+// absoluteURL prefixes a path with the configured base URL, so links can be copied
+// and shared; without one the path stays relative.
+func absoluteURL(path string) string {
+	return baseURL + path
+}
+
+// ConfigHandler returns the configuration the frontend needs as JSON: the enabled
+// features, so pages can hide what is switched off, and the base URL.
+func ConfigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"baseURL":  baseURL,
+		"features": features,
+	})
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// dem is the terrain model used to correct track altitudes; nil when not configured.
+var dem *utils.DEM
+
+// SetDEMDir enables offline elevation correction from the SRTM .hgt tiles in dir.
+func SetDEMDir(dir string) error {
+	d, err := utils.NewDEM(dir)
+	if err != nil {
+		return err
+	}
+	dem = d
+	return nil
+}
+
+// correctElevation adds DEM altitudes to the records when a terrain model is configured.
+// It reports whether any record was corrected.
+func correctElevation(records []models.Record) bool {
+	if dem == nil {
+		return false
+	}
+	return utils.CorrectAltitude(records, dem) > 0
+}
+
+// demJob corrects every stored activity when asked to, outside the request that asked,
+// since it rewrites every activity's records.
+var demJob = newBackgroundJob("correcting elevation", func() error {
+	n, err := correctAllElevation()
+	demResultMu.Lock()
+	defer demResultMu.Unlock()
+	if err != nil {
+		demResult = "Correcting elevation failed: " + err.Error()
+		return err
+	}
+	demResult = fmt.Sprintf("Corrected %d activities at %s.", n, time.Now().Format("15:04"))
+	return nil
+})
+
+// demResult describes the outcome of the last correction, for the settings page.
+var (
+	demResultMu sync.Mutex
+	demResult   string
+)
+
+// StartDEMWorker runs the corrections the settings page queues.
+func StartDEMWorker() {
+	demJob.Start()
+}
+
+// correctAllElevation applies the terrain model to every stored activity and refreshes
+// the altitude-dependent stats and analyses. It returns how many activities changed.
+func correctAllElevation() (int, error) {
+	activities, err := db.ListActivities()
+	if err != nil {
+		return 0, err
+	}
+	corrected := 0
+	for _, act := range activities {
+		records, err := db.GetActivityRecords(act.ID)
+		if err != nil {
+			log.Printf("Error loading records for %s: %v", act.ID, err)
+			continue
+		}
+		if !correctElevation(records) {
+			continue
+		}
+		if err := db.SetActivityRecords(act.ID, records); err != nil {
+			log.Printf("Error saving corrected records for %s: %v", act.ID, err)
+			continue
+		}
+		stats, err := db.GetActivityStats(act.ID)
+		if err != nil {
+			log.Printf("Error loading stats for %s: %v", act.ID, err)
+			continue
+		}
+		var deviceAscent *float64
+		if v, ok := stats["deviceAscent"].(float64); ok {
+			deviceAscent = &v
+		}
+		if err := db.MergeActivityStats(act.ID, elevationStats(records, act.Type, deviceAscent)); err != nil {
+			log.Printf("Error updating elevation stats for %s: %v", act.ID, err)
+		}
+		// Rerun the derived analyses so anything built on altitude picks up the new stream
+		analyzeActivity(act, records)
+		corrected++
+	}
+	TriggerTrainingLoadRecompute()
+	return corrected, nil
+}
+
+// DEMHandler shows (GET) whether elevation correction is available and queues it for
+// all stored activities (POST), as an HTML partial for HTMX.
+func DEMHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if dem == nil {
+			http.Error(w, "Elevation correction is not configured", http.StatusBadRequest)
+			return
+		}
+		demJob.Trigger()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var out string
+	if dem == nil {
+		out = `<p>Elevation correction is off. Start OwnPath with <code>-dem-dir</code> pointing at a directory of SRTM .hgt tiles to enable it.</p>`
+	} else {
+		out = fmt.Sprintf(`<p>Correcting new uploads with terrain tiles from <code>%s</code>.</p>
+		<button hx-post="/api/dem" hx-target="#dem" hx-swap="innerHTML" hx-confirm="Recompute elevation for all activities?">Correct existing activities</button>`,
+			html.EscapeString(dem.Dir()))
+	}
+	if progress := jobProgress(w, r, demJob, "/api/dem", "#dem", "Correcting existing activities…", "settingsChanged"); progress != "" {
+		out += progress
+	} else {
+		demResultMu.Lock()
+		if demResult != "" {
+			out += "<p>" + html.EscapeString(demResult) + "</p>"
+		}
+		demResultMu.Unlock()
+	}
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, out)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// newRecord describes a personal record set by a freshly uploaded activity.
+type newRecord struct {
+	Name   string  `json:"name"`
+	Value  float64 `json:"value"`
+	Metric string  `json:"metric"`
+	Scope  string  `json:"scope"` // "all-time" or the year, e.g. "2025"
+}
+
+// updateActivityEfforts finds and stores an activity's best efforts and returns the
+// personal records it set.
+func updateActivityEfforts(act models.Activity, records []models.Record) ([]newRecord, error) {
+	if err := db.SetActivityEfforts(act.ID, utils.BestEfforts(records, act.Type)); err != nil {
+		return nil, err
+	}
+	ranked, err := db.GetActivityEfforts(act.ID)
+	if err != nil {
+		return nil, err
+	}
+	sortEfforts(ranked)
+	var prs []newRecord
+	for _, e := range ranked {
+		switch {
+		case e.AllTimeRank == 1:
+			prs = append(prs, newRecord{Name: e.Name, Value: e.Value, Metric: e.Metric, Scope: "all-time"})
+		case e.YearRank == 1:
+			prs = append(prs, newRecord{Name: e.Name, Value: e.Value, Metric: e.Metric, Scope: strconv.Itoa(e.Timestamp.Year())})
+		}
+	}
+	return prs, nil
+}
+
+// formatEffort renders an effort value in its metric's natural unit.
+func formatEffort(metric string, value float64, units string) string {
+	switch metric {
+	case utils.EffortTime:
+		return utils.FormatDuration(value)
+	case utils.EffortPower:
+		return fmt.Sprintf("%.0f W", value)
+	default:
+		return utils.FormatSpeed(value, units)
+	}
+}
+
+// sortEfforts orders efforts from the shortest distance/duration to the longest.
+func sortEfforts(efforts []db.RankedEffort) {
+	sort.SliceStable(efforts, func(i, j int) bool {
+		return utils.EffortOrder(efforts[i].Name) < utils.EffortOrder(efforts[j].Name)
+	})
+}
+
+// rankBadge labels top-3 placements, e.g. "PR" or "2nd 2025".
+func rankBadge(e db.RankedEffort) string {
+	place := func(rank int) string {
+		switch rank {
+		case 1:
+			return "PR"
+		case 2:
+			return "2nd"
+		case 3:
+			return "3rd"
+		}
+		return ""
+	}
+	if b := place(e.AllTimeRank); b != "" {
+		return `<span class="badge">` + b + `</span>`
+	}
+	if b := place(e.YearRank); b != "" {
+		return fmt.Sprintf(`<span class="badge badge-year">%s %d</span>`, b, e.Timestamp.Year())
+	}
+	return ""
+}
+
+// renderActivityEfforts builds the best-efforts section of the activity detail partial.
+func renderActivityEfforts(act models.Activity, units string) string {
+	efforts, err := db.GetActivityEfforts(act.ID)
+	if err != nil {
+		log.Printf("Warning: Failed to load efforts for %s: %v", act.ID, err)
+		return ""
+	}
+	if len(efforts) == 0 {
+		return ""
+	}
+	sortEfforts(efforts)
+	out := `<h3>Best Efforts</h3><table class="efforts"><thead><tr><th>Effort</th><th>Result</th><th>Starts at</th><th></th></tr></thead><tbody>`
+	for _, e := range efforts {
+		out += fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>",
+			html.EscapeString(e.Name), formatEffort(e.Metric, e.Value, units), utils.FormatDuration(e.Start), rankBadge(e))
+	}
+	return out + `</tbody></table>`
+}
+
+// PersonalRecordsHandler returns an HTML partial (table rows) of personal records,
+// all-time or for ?year=YYYY.
+func PersonalRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	year := 0
+	if v := r.URL.Query().Get("year"); v != "" {
+		y, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid year", http.StatusBadRequest)
+			return
+		}
+		year = y
+	}
+	records, err := db.GetPersonalRecords(year)
+	if err != nil {
+		log.Printf("Error loading personal records: %v", err)
+		http.Error(w, "<tr><td colspan='3'>Error loading records</td></tr>", http.StatusInternalServerError)
+		return
+	}
+	sortEfforts(records)
+
+	units := getUnits()
+	out := ""
+	if len(records) == 0 {
+		out = "<tr><td colspan='3'>No best efforts yet</td></tr>"
+	}
+	for _, e := range records {
+		out += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td><a href="/detail.html?id=%s">%s</a></td></tr>`,
+			html.EscapeString(e.Name), formatEffort(e.Metric, e.Value, units), html.EscapeString(e.ActivityID), e.Timestamp.Format("2006-01-02"))
+	}
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, out)
+}
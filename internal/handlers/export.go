@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+	"github.com/muktihari/fit/encoder"
+	"github.com/muktihari/fit/profile/filedef"
+	"github.com/muktihari/fit/profile/mesgdef"
+	"github.com/muktihari/fit/profile/typedef"
+)
+
+// exportName is the track name written into exported files.
+func exportName(act models.Activity) string {
+	return fmt.Sprintf("%s %s", act.Type, act.Timestamp.Format("2006-01-02"))
+}
+
+// setExportHeaders marks a response as a file download named after the activity.
+func setExportHeaders(w http.ResponseWriter, act models.Activity, ext, contentType string) {
+	id := act.ID
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="ownpath-%s-%s.%s"`, act.Timestamp.Format("2006-01-02"), id, ext))
+}
+
+// loadExport loads the activity {id} and its records for an export handler, writing
+// the error response and returning ok=false when that fails.
+func loadExport(w http.ResponseWriter, r *http.Request) (act *models.Activity, records []models.Record, ok bool) {
+	id := r.PathValue("id")
+	act, err := db.GetActivityByID(id)
+	if err == nil && act == nil {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if err == nil {
+		records, err = db.GetActivityRecords(id)
+	}
+	if err != nil {
+		log.Printf("Error loading %s for export: %v", id, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if len(records) == 0 {
+		http.Error(w, "Activity has no recorded data to export", http.StatusNotFound)
+		return nil, nil, false
+	}
+	utils.EnsureDistance(records)
+	return act, records, true
+}
+
+// exportParts splits a track at pauses and, unless ?private=1 asks for the owner's full
+// copy, trims the privacy zones. The distance stream of a trimmed track is counted
+// from its first visible point, so it gives away neither the hidden start nor the
+// hidden stretches.
+func exportParts(r *http.Request, records []models.Record) ([][]models.Record, error) {
+	parts := utils.SplitAtPauses(records)
+	if r.URL.Query().Get("private") == "1" {
+		return parts, nil
+	}
+	var visible [][]models.Record
+	var total float64
+	for _, part := range parts {
+		trimmed, err := publicTrack(part)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range trimmed {
+			t = append([]models.Record(nil), t...)
+			offset := t[0].Distance
+			for i := range t {
+				t[i].Distance = total + t[i].Distance - offset
+			}
+			total = t[len(t)-1].Distance
+			visible = append(visible, t)
+		}
+	}
+	return visible, nil
+}
+
+// ExportGPXHandler serves GET /api/activities/{id}/export.gpx: the activity as GPX 1.1
+// with timestamps, sensor extensions and a track segment per recording stretch.
+func ExportGPXHandler(w http.ResponseWriter, r *http.Request) {
+	act, records, ok := loadExport(w, r)
+	if !ok {
+		return
+	}
+	parts, err := exportParts(r, records)
+	if err != nil {
+		log.Printf("Error trimming privacy zones for %s: %v", act.ID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	setExportHeaders(w, *act, "gpx", "application/gpx+xml")
+	if err := utils.WriteGPX(w, exportName(*act), act.Type, act.Timestamp, parts); err != nil {
+		log.Printf("Error writing GPX for %s: %v", act.ID, err)
+	}
+}
+
+// ExportTCXHandler serves GET /api/activities/{id}/export.tcx: the activity as a TCX
+// activity with a lap per recording stretch and every record as a trackpoint.
+func ExportTCXHandler(w http.ResponseWriter, r *http.Request) {
+	act, records, ok := loadExport(w, r)
+	if !ok {
+		return
+	}
+	parts, err := exportParts(r, records)
+	if err != nil {
+		log.Printf("Error trimming privacy zones for %s: %v", act.ID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	setExportHeaders(w, *act, "tcx", "application/vnd.garmin.tcx+xml")
+	if err := utils.WriteTCX(w, exportName(*act), act.Type, act.Timestamp, parts); err != nil {
+		log.Printf("Error writing TCX for %s: %v", act.ID, err)
+	}
+}
+
+// fitSport is the inverse of getSportFormatted.
+func fitSport(sport string) typedef.Sport {
+	switch sport {
+	case "Running":
+		return typedef.SportRunning
+	case "Cycling":
+		return typedef.SportCycling
+	case "Walking":
+		return typedef.SportWalking
+	case "Hiking":
+		return typedef.SportHiking
+	case "Swimming":
+		return typedef.SportSwimming
+	default:
+		return typedef.SportGeneric
+	}
+}
+
+// fitEvent returns a FIT event message at t.
+func fitEvent(t time.Time, event typedef.Event, eventType typedef.EventType) *mesgdef.Event {
+	return mesgdef.NewEvent(nil).SetTimestamp(t).SetEvent(event).SetEventType(eventType)
+}
+
+// encodeFIT writes an activity as a FIT activity file: the records, a timer start/stop
+// pair and a lap per part, and one session. The session totals are taken from stats
+// when given (the owner's full copy, so a re-import matches the original) and
+// computed from the parts otherwise.
+func encodeFIT(w io.Writer, act models.Activity, parts [][]models.Record, stats map[string]float64) error {
+	if len(parts) == 0 {
+		return fmt.Errorf("no records to encode")
+	}
+	first, last := parts[0][0], parts[len(parts)-1][len(parts[len(parts)-1])-1]
+	sport := fitSport(act.Type)
+
+	file := filedef.NewActivity()
+	file.FileId = *mesgdef.NewFileId(nil).
+		SetType(typedef.FileActivity).
+		SetManufacturer(typedef.ManufacturerDevelopment).
+		SetProduct(0).
+		SetSerialNumber(1).
+		SetTimeCreated(act.Timestamp)
+
+	var timer float64
+	var hrSum, hrCount int
+	var hrMax uint8
+	for _, part := range parts {
+		start, end := part[0], part[len(part)-1]
+		file.Events = append(file.Events,
+			fitEvent(start.Time, typedef.EventTimer, typedef.EventTypeStart),
+			fitEvent(end.Time, typedef.EventTimer, typedef.EventTypeStopAll))
+		for _, r := range part {
+			rec := mesgdef.NewRecord(nil).SetTimestamp(r.Time).SetDistanceScaled(r.Distance)
+			if r.HasPosition() {
+				rec.SetPositionLatDegrees(r.Lat).SetPositionLongDegrees(r.Lon)
+			}
+			if r.Altitude != nil {
+				rec.SetEnhancedAltitudeScaled(*r.Altitude)
+			}
+			if r.Speed > 0 {
+				rec.SetEnhancedSpeedScaled(r.Speed)
+			}
+			if r.HeartRate > 0 {
+				rec.SetHeartRate(r.HeartRate)
+				hrSum += int(r.HeartRate)
+				hrCount++
+				hrMax = max(hrMax, r.HeartRate)
+			}
+			if r.Cadence > 0 {
+				rec.SetCadence(r.Cadence)
+			}
+			if r.Power > 0 {
+				rec.SetPower(r.Power)
+			}
+			if r.Temperature != nil {
+				rec.SetTemperature(*r.Temperature)
+			}
+			file.Records = append(file.Records, rec)
+		}
+		duration := end.Time.Sub(start.Time).Seconds()
+		timer += duration
+		file.Laps = append(file.Laps, mesgdef.NewLap(nil).
+			SetTimestamp(end.Time).
+			SetStartTime(start.Time).
+			SetEvent(typedef.EventLap).
+			SetEventType(typedef.EventTypeStop).
+			SetSport(sport).
+			SetTotalElapsedTimeScaled(duration).
+			SetTotalTimerTimeScaled(duration).
+			SetTotalDistanceScaled(end.Distance-start.Distance))
+	}
+
+	elapsed := last.Time.Sub(first.Time).Seconds()
+	distance := last.Distance - first.Distance
+	if v := stats["elapsedTime"]; v > 0 {
+		elapsed = v
+	}
+	if v := stats["timerTime"]; v > 0 {
+		timer = v
+	}
+	if v := stats["distance"]; v > 0 {
+		distance = v
+	}
+	session := mesgdef.NewSession(nil).
+		SetTimestamp(last.Time).
+		SetStartTime(first.Time).
+		SetEvent(typedef.EventSession).
+		SetEventType(typedef.EventTypeStop).
+		SetSport(sport).
+		SetTotalElapsedTimeScaled(elapsed).
+		SetTotalTimerTimeScaled(timer).
+		SetTotalDistanceScaled(distance).
+		SetFirstLapIndex(0).
+		SetNumLaps(uint16(len(file.Laps)))
+	if v, ok := stats["deviceAscent"]; ok {
+		session.SetTotalAscent(uint16(math.Round(v)))
+	}
+	if v, ok := stats["deviceDescent"]; ok {
+		session.SetTotalDescent(uint16(math.Round(v)))
+	}
+	if hrCount > 0 {
+		session.SetAvgHeartRate(uint8(math.Round(float64(hrSum) / float64(hrCount)))).SetMaxHeartRate(hrMax)
+	}
+	file.Sessions = append(file.Sessions, session)
+	file.Activity = mesgdef.NewActivity(nil).
+		SetTimestamp(last.Time).
+		SetTotalTimerTimeScaled(timer).
+		SetNumSessions(1).
+		SetType(typedef.ActivityManual).
+		SetEvent(typedef.EventActivity).
+		SetEventType(typedef.EventTypeStop)
+
+	fit := file.ToFIT(nil)
+	if err := encoder.New(w).Encode(&fit); err != nil {
+		return fmt.Errorf("failed to encode fit: %w", err)
+	}
+	return nil
+}
+
+// ExportFITHandler serves GET /api/activities/{id}/export.fit: the activity re-encoded
+// as a FIT activity file, whatever format it was imported from.
+func ExportFITHandler(w http.ResponseWriter, r *http.Request) {
+	act, records, ok := loadExport(w, r)
+	if !ok {
+		return
+	}
+	parts, err := exportParts(r, records)
+	if err != nil {
+		log.Printf("Error trimming privacy zones for %s: %v", act.ID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if len(parts) == 0 {
+		http.Error(w, "Activity lies entirely within privacy zones", http.StatusNotFound)
+		return
+	}
+	var stats map[string]float64
+	if r.URL.Query().Get("private") == "1" {
+		if err := json.Unmarshal([]byte(act.StatsJSON), &stats); err != nil {
+			log.Printf("Warning: Failed to unmarshal stats for %s: %v", act.ID, err)
+		}
+	}
+	// Encode to memory first: a failure must not leave a truncated download behind
+	var buf bytes.Buffer
+	if err := encodeFIT(&buf, *act, parts, stats); err != nil {
+		log.Printf("Error writing FIT for %s: %v", act.ID, err)
+		http.Error(w, "Failed to encode FIT file", http.StatusInternalServerError)
+		return
+	}
+	setExportHeaders(w, *act, "fit", "application/vnd.ant.fit")
+	w.Write(buf.Bytes())
+}
+
+// trackFormats are the formats written by utils.TrackWriter, by file extension.
+var trackFormats = map[string]string{
+	"geojson": "application/geo+json",
+	"kml":     "application/vnd.google-earth.kml+xml",
+	"csv":     "text/csv",
+}
+
+// newTrackWriter returns the writer of a track format; collection asks for a document
+// that holds several activities.
+func newTrackWriter(format string, w io.Writer, name string, collection bool) utils.TrackWriter {
+	switch format {
+	case "kml":
+		return utils.NewKMLWriter(w, name)
+	case "csv":
+		return utils.NewCSVWriter(w)
+	default:
+		return utils.NewGeoJSONWriter(w, collection)
+	}
+}
+
+// exportTrack writes the activity {id} in one of the trackFormats.
+func exportTrack(w http.ResponseWriter, r *http.Request, format string) {
+	act, records, ok := loadExport(w, r)
+	if !ok {
+		return
+	}
+	parts, err := exportParts(r, records)
+	if err != nil {
+		log.Printf("Error trimming privacy zones for %s: %v", act.ID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	setExportHeaders(w, *act, format, trackFormats[format])
+	name := exportName(*act)
+	tw := newTrackWriter(format, w, name, false)
+	err = tw.WriteTrack(utils.ExportTrack{ID: act.ID, Name: name, Sport: act.Type, Start: act.Timestamp, Parts: parts})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err != nil {
+		log.Printf("Error writing %s for %s: %v", format, act.ID, err)
+	}
+}
+
+// ExportGeoJSONHandler serves GET /api/activities/{id}/export.geojson: the activity as a
+// GeoJSON Feature with per-point times and sensor data in coordinateProperties.
+func ExportGeoJSONHandler(w http.ResponseWriter, r *http.Request) {
+	exportTrack(w, r, "geojson")
+}
+
+// ExportKMLHandler serves GET /api/activities/{id}/export.kml: the activity as a KML
+// placemark with timed tracks for Google Earth.
+func ExportKMLHandler(w http.ResponseWriter, r *http.Request) {
+	exportTrack(w, r, "kml")
+}
+
+// ExportCSVHandler serves GET /api/activities/{id}/export.csv: the full record stream
+// of the activity, one row per record.
+func ExportCSVHandler(w http.ResponseWriter, r *http.Request) {
+	exportTrack(w, r, "csv")
+}
+
+// ExportActivitiesHandler serves GET /api/export?format=geojson|kml|csv: every activity
+// matching ?sport=, ?year=YYYY or ?from=YYYY-MM-DD&to=YYYY-MM-DD (to is exclusive) as
+// one document, e.g. a GeoJSON FeatureCollection. Privacy zones are trimmed unless
+// ?private=1.
+func ExportActivitiesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "geojson"
+	}
+	contentType, ok := trackFormats[format]
+	if !ok {
+		http.Error(w, "Invalid format: must be geojson, kml or csv", http.StatusBadRequest)
+		return
+	}
+
+	filter := db.ActivityFilter{Sport: q.Get("sport")}
+	label := []string{"ownpath"}
+	if filter.Sport != "" {
+		label = append(label, strings.ToLower(filter.Sport))
+	}
+	if v := q.Get("year"); v != "" {
+		year, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid year", http.StatusBadRequest)
+			return
+		}
+		filter.From = time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+		filter.To = filter.From.AddDate(1, 0, 0)
+		label = append(label, v)
+	}
+	var err error
+	if v := q.Get("from"); v != "" {
+		if filter.From, err = time.Parse("2006-01-02", v); err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+		label = append(label, "from-"+v)
+	}
+	if v := q.Get("to"); v != "" {
+		if filter.To, err = time.Parse("2006-01-02", v); err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+		label = append(label, "to-"+v)
+	}
+
+	activities, err := db.FindActivities(filter)
+	if err != nil {
+		log.Printf("Error loading activities for export: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	name := strings.Join(label, "-")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	// The response is streamed, so errors past this point can only be logged
+	tw := newTrackWriter(format, w, name, true)
+	for _, act := range activities {
+		records, err := db.GetActivityRecords(act.ID)
+		if err != nil {
+			log.Printf("Error loading records of %s for export: %v", act.ID, err)
+			return
+		}
+		if len(records) == 0 {
+			continue
+		}
+		utils.EnsureDistance(records)
+		parts, err := exportParts(r, records)
+		if err != nil {
+			log.Printf("Error trimming privacy zones for %s: %v", act.ID, err)
+			return
+		}
+		t := utils.ExportTrack{ID: act.ID, Name: exportName(act), Sport: act.Type, Start: act.Timestamp, Parts: parts}
+		if err := tw.WriteTrack(t); err != nil {
+			log.Printf("Error writing %s export: %v", format, err)
+			return
+		}
+	}
+	if err := tw.Close(); err != nil {
+		log.Printf("Error writing %s export: %v", format, err)
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// syntheticTrack returns a track heading east at speed m/s, one record per second: n
+// records, a stop of 30 s in the middle of the first half, and a recording gap of
+// 5 minutes before the second half.
+func syntheticTrack(start time.Time, n int, speed float64) []models.Record {
+	const metersPerDegree = 111320.0
+	var records []models.Record
+	t := start
+	var dist float64
+	for i := 0; i < n; i++ {
+		if i == n/2 {
+			t = t.Add(5 * time.Minute)
+		}
+		stopped := i >= n/4 && i < n/4+30
+		if i > 0 && !stopped && i != n/2 {
+			dist += speed
+		}
+		alt := 400 + 20*math.Sin(float64(i)/60)
+		records = append(records, models.Record{
+			Time:      t,
+			Lat:       47,
+			Lon:       8 + dist/(metersPerDegree*math.Cos(47*math.Pi/180)),
+			Altitude:  &alt,
+			Distance:  dist,
+			HeartRate: 120 + uint8(i%20),
+			Power:     uint16(150 + i%50),
+		})
+		t = t.Add(time.Second)
+	}
+	return records
+}
+
+// importStats runs an imported file through the same steps as an upload and returns
+// its stats, with the records as stored.
+func importStats(t *testing.T, imp *importedActivity) (map[string]float64, []models.Record) {
+	t.Helper()
+	utils.EnsureDistance(imp.Records)
+	data, err := json.Marshal(buildStats(imp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats map[string]float64
+	if err := json.Unmarshal(data, &stats); err != nil {
+		t.Fatal(err)
+	}
+	return stats, imp.Records
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	start := time.Date(2024, 5, 4, 8, 0, 0, 0, time.UTC)
+
+	// A ride recorded as FIT and a hike recorded as GPX, as the device would upload them
+	var ride bytes.Buffer
+	rideTrack := syntheticTrack(start, 1200, 8)
+	if err := encodeFIT(&ride, models.Activity{Type: "Cycling", Timestamp: start}, utils.SplitAtPauses(rideTrack), nil); err != nil {
+		t.Fatalf("encoding ride: %v", err)
+	}
+	var hike bytes.Buffer
+	if err := utils.WriteGPX(&hike, "Hike", "Hiking", start, utils.SplitAtPauses(syntheticTrack(start, 1800, 1.2))); err != nil {
+		t.Fatalf("encoding hike: %v", err)
+	}
+
+	sources := []struct {
+		name  string
+		data  []byte
+		parse func([]byte) (*importedActivity, error)
+	}{
+		{"FIT ride", ride.Bytes(), parseFIT},
+		{"GPX hike", hike.Bytes(), parseGPX},
+	}
+	for _, src := range sources {
+		imp, err := src.parse(src.data)
+		if err != nil {
+			t.Fatalf("%s: import: %v", src.name, err)
+		}
+		want, records := importStats(t, imp)
+		act := models.Activity{Type: imp.Sport, Timestamp: imp.StartTime}
+		parts := utils.SplitAtPauses(records)
+
+		var fit bytes.Buffer
+		if err := encodeFIT(&fit, act, parts, want); err != nil {
+			t.Fatalf("%s: export FIT: %v", src.name, err)
+		}
+		var tcx bytes.Buffer
+		if err := utils.WriteTCX(&tcx, exportName(act), act.Type, act.Timestamp, parts); err != nil {
+			t.Fatalf("%s: export TCX: %v", src.name, err)
+		}
+
+		exports := []struct {
+			format string
+			data   []byte
+			parse  func([]byte) (*importedActivity, error)
+		}{
+			{"FIT", fit.Bytes(), parseFIT},
+			{"TCX", tcx.Bytes(), parseTCX},
+		}
+		for _, exp := range exports {
+			reimp, err := exp.parse(exp.data)
+			if err != nil {
+				t.Fatalf("%s as %s: re-import: %v", src.name, exp.format, err)
+			}
+			if reimp.Sport != imp.Sport {
+				t.Errorf("%s as %s: sport = %s, want %s", src.name, exp.format, reimp.Sport, imp.Sport)
+			}
+			got, _ := importStats(t, reimp)
+			for _, tc := range []struct {
+				key string
+				tol float64
+			}{
+				{"distance", 1},    // meters
+				{"elapsedTime", 1}, // seconds
+				{"timerTime", 1},
+				{"movingTime", 1},
+			} {
+				if math.Abs(got[tc.key]-want[tc.key]) > tc.tol {
+					t.Errorf("%s as %s: %s = %.2f, want %.2f", src.name, exp.format, tc.key, got[tc.key], want[tc.key])
+				}
+			}
+		}
+	}
+}
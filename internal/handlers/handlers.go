@@ -3,25 +3,28 @@ package handlers // Assuming this is internal/handlers; adjust if needed
 import (
 	"bytes"
 	"database/sql"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/google/uuid" // For unique IDs
 	"github.com/gratten/ownpath/internal/db"
 	"github.com/gratten/ownpath/internal/models" // Adjust import path
 	"github.com/gratten/ownpath/internal/utils"
 	"github.com/muktihari/fit/decoder"                 // For decoding FIT files
+	"github.com/muktihari/fit/profile/basetype"        // For FIT invalid-value markers
 	"github.com/muktihari/fit/profile/mesgdef"         // For typed messages (e.g., NewFileId, NewSession)
+	"github.com/muktihari/fit/profile/typedef"         // For enums (e.g., Sport, Event)
 	"github.com/muktihari/fit/profile/untyped/mesgnum" // For message numbers (e.g., MesgNumFileId)
 )
 
-// ActivityHandler handles GET requests to /api/activity?id=<uuid>
+// ActivityHandler handles GET and DELETE requests to /api/activity?id=<uuid>
 func ActivityHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract ID from query params
 	id := r.URL.Query().Get("id")
@@ -32,6 +35,11 @@ func ActivityHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.Method == http.MethodDelete {
+		deleteActivity(w, id)
+		return
+	}
+
 	// // Optional: Validate UUID format
 	// if _, err := uuid.Parse(id); err != nil {
 	// 	http.Error(w, "Invalid ID format", http.StatusBadRequest)
@@ -41,8 +49,8 @@ func ActivityHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Query the DB for the activity
 	var activity models.Activity
-	row := db.DB.QueryRow("SELECT id, timestamp, type, stats_json, gpx_data FROM activities WHERE id = ?", id)
-	err := row.Scan(&activity.ID, &activity.Timestamp, &activity.Type, &activity.StatsJSON, &activity.GPXData)
+	row := db.DB.QueryRow("SELECT id, timestamp, type, stats_json FROM activities WHERE id = ?", id)
+	err := row.Scan(&activity.ID, &activity.Timestamp, &activity.Type, &activity.StatsJSON)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Activity not found", http.StatusNotFound)
@@ -62,31 +70,54 @@ func ActivityHandler(w http.ResponseWriter, r *http.Request) {
 		stats = map[string]interface{}{"raw": activity.StatsJSON}
 	}
 
-	// ... other code in ActivityHandler ...
-
-	// After querying DB
-	log.Printf("Queried GPX length from DB: %d for ID %s", len(activity.GPXData), id)
-
-	// Base64 encode GPX for safe HTML embedding (avoids escaping issues)
-	gpxEncoded := base64.StdEncoding.EncodeToString([]byte(activity.GPXData))
-	log.Printf("Encoded GPX length: %d", len(gpxEncoded))
-
-	// Build HTML partial
-	html := `<div id="activity-details">
-		<h2>Activity: ` + activity.Type + ` on ` + activity.Timestamp.Format("2006-01-02 15:04:05") + `</h2>
+	// Build HTML partial; stored strings are escaped, as a restored archive may contain anything
+	activityID := html.EscapeString(activity.ID)
+	out := `<div id="activity-details">
+		<h2>Activity: ` + html.EscapeString(activity.Type) + ` on ` + activity.Timestamp.Format("2006-01-02 15:04:05") + `</h2>
 		<ul>`
 	for key, val := range stats {
-		html += fmt.Sprintf("<li><strong>%s:</strong> %v</li>", key, val)
+		out += fmt.Sprintf("<li><strong>%s:</strong> %s</li>", html.EscapeString(key), html.EscapeString(fmt.Sprint(val)))
 	}
-	html += `</ul>
-		<div id="map" style="height: 400px; width: 100%;"></div>
-		<div id="gpx-data" style="display: none;" data-encoded="true">` + gpxEncoded + `</div> <!-- Base64 encoded -->
+	out += `</ul>`
+	if token, err := shareToken(activity.ID); err != nil {
+		log.Printf("Warning: Failed to get share token for %s: %v", id, err)
+	} else {
+		out += `<p><a href="` + absoluteURL("/share.html?token="+token) + `">Public view</a> (privacy zones hidden, for sharing)</p>`
+	}
+	out += `<p>Export: <a href="/api/activities/` + activityID + `/export.gpx">GPX</a>
+		· <a href="/api/activities/` + activityID + `/export.tcx">TCX</a>
+		· <a href="/api/activities/` + activityID + `/export.fit">FIT</a>
+		· <a href="/api/activities/` + activityID + `/export.geojson">GeoJSON</a>
+		· <a href="/api/activities/` + activityID + `/export.kml">KML</a>
+		· <a href="/api/activities/` + activityID + `/export.csv">CSV</a>
+		(including privacy zones: <a href="/api/activities/` + activityID + `/export.gpx?private=1">GPX</a>
+		· <a href="/api/activities/` + activityID + `/export.tcx?private=1">TCX</a>
+		· <a href="/api/activities/` + activityID + `/export.fit?private=1">FIT</a>)</p>`
+	out += renderActivityRoute(activity)
+
+	// Automatic splits from the stored record stream (empty for activities imported before records were kept)
+	records, err := db.GetActivityRecords(id)
+	if err != nil {
+		log.Printf("Warning: Failed to load records for %s: %v", id, err)
+	}
+	units := getUnits()
+	utils.EnsureDistance(records)
+	out += renderActivityCharts(activity, records, units, chartAxisDistance, chartMaxPoints)
+	out += renderActivityClimbs(activity, units)
+	out += renderSplitTable(utils.ComputeSplits(records, activity.Type, utils.UnitLength(units)), units)
+	out += renderActivityZones(activity)
+	out += renderActivityPower(activity, stats)
+	out += renderActivityEfforts(activity, units)
+	out += renderActivitySegments(activity, units)
+
+	out += `
+		<div id="map" style="height: 400px; width: 100%;" data-track="/api/activities/` + activityID + `/track"></div> <!-- Simplified track, loaded per zoom -->
 	</div>`
 
-	log.Printf("Returning HTML length: %d (with encoded GPX length: %d)", len(html), len(gpxEncoded))
+	log.Printf("Returning HTML length: %d", len(out))
 
 	w.Header().Set("Content-Type", "text/html")
-	fmt.Fprint(w, html)
+	fmt.Fprint(w, out)
 	log.Printf("Successfully served activity %s", id)
 
 	// // Build HTML partial for HTMX
@@ -107,6 +138,24 @@ func ActivityHandler(w http.ResponseWriter, r *http.Request) {
 	// log.Printf("Successfully served activity %s", id)
 }
 
+// deleteActivity removes an activity and its derived data. The empty 200 response lets
+// HTMX swap the dashboard row out.
+func deleteActivity(w http.ResponseWriter, id string) {
+	found, err := db.DeleteActivity(id)
+	if err != nil {
+		http.Error(w, "Failed to delete activity", http.StatusInternalServerError)
+		log.Printf("Error deleting activity %s: %v", id, err)
+		return
+	}
+	if !found {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return
+	}
+	TriggerTrainingLoadRecompute()
+	log.Printf("Deleted activity %s", id)
+	w.WriteHeader(http.StatusOK)
+}
+
 // ActivitiesHandler returns an HTML partial (table rows) for HTMX
 func ActivitiesHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("ActivitiesHandler called")
@@ -115,7 +164,7 @@ func ActivitiesHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Printf("Error querying activities: %v", err)
 		w.Header().Set("Content-Type", "text/html")
-		http.Error(w, "<tr><td colspan='5'>Error loading activities</td></tr>", http.StatusInternalServerError)
+		http.Error(w, "<tr><td colspan='8'>Error loading activities</td></tr>", http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
@@ -148,9 +197,15 @@ func ActivitiesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build HTML table rows
-	var html string
+	units := getUnits()
+	elevationSource := getElevationSource()
+	noThumbnail, err := db.GetActivitiesWithoutThumbnail()
+	if err != nil {
+		log.Printf("Warning: Failed to load activities without thumbnails: %v", err)
+	}
+	var out string
 	if len(activities) == 0 {
-		html = "<tr><td colspan='5'>No activities yet</td></tr>"
+		out = "<tr><td colspan='8'>No activities yet</td></tr>"
 	} else {
 		for _, act := range activities {
 			// Unmarshal StatsJSON on the fly for display
@@ -162,95 +217,122 @@ func ActivitiesHandler(w http.ResponseWriter, r *http.Request) {
 
 			distance := stats["distance"] // Default to 0 if missing
 			elevation := stats["elevation"]
+			if v, ok := stats["ascent"]; ok && elevationSource == ElevationComputed {
+				elevation = v
+			}
+			movingTime := stats["movingTime"]
+
+			// Runs and hikes read as pace, everything else as speed
+			avg := utils.FormatSpeedOrPace(stats["avgSpeed"], act.Type, units)
 
 			// Format Timestamp for display (e.g., "2006-01-02T15:04:05Z")
 			timestampFormatted := act.Timestamp.Format(time.RFC3339)
+			actID := html.EscapeString(act.ID)
 
-			html += fmt.Sprintf(
+			// Activities without a track have no thumbnail to ask for
+			thumbnail := ""
+			if !noThumbnail[act.ID] {
+				thumbnail = fmt.Sprintf(`<a href="/detail.html?id=%s"><img class="thumbnail" src="/api/activities/%s/thumbnail.png" alt="" loading="lazy" width="80" height="60" onerror="this.remove()"></a>`, actID, actID)
+			}
+
+			out += fmt.Sprintf(
 				`<tr>
                     <td>%s</td>
                     <td>%s</td>
-                    <td>%.1f</td>
+                    <td>%s</td>
+                    <td>%s</td>
                     <td>%.0f</td>
-                    <td><a href="/detail.html?id=%s">View</a></td>
+                    <td>%s</td>
+                    <td>%s</td>
+                    <td><a href="/detail.html?id=%s">View</a>
+                        <button hx-delete="/api/activity?id=%s" hx-confirm="Delete this activity?" hx-target="closest tr" hx-swap="outerHTML">Delete</button></td>
                 </tr>`,
-				timestampFormatted, act.Type, distance, elevation, act.ID,
+				thumbnail, timestampFormatted, html.EscapeString(act.Type), utils.FormatDistance(distance, units), elevation, utils.FormatDuration(movingTime), avg, actID, actID,
 			)
 		}
 	}
 
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprint(w, html)
+	fmt.Fprint(w, out)
 }
 
 // getSportFormatted is a helper to convert FIT sport ID to a string.
 func getSportFormatted(sport byte) string {
-	switch sport {
-	case 1:
+	switch typedef.Sport(sport) {
+	case typedef.SportRunning:
 		return "Running"
-	case 2:
+	case typedef.SportCycling:
 		return "Cycling"
-	case 5:
-		return "Walking" // Or Hiking; adjust based on your needs
-	case 17:
+	case typedef.SportWalking:
+		return "Walking"
+	case typedef.SportHiking:
+		return "Hiking"
+	case typedef.SportSwimming:
 		return "Swimming"
-		// Add more from FIT Profile (e.g., 0=Generic, 11=Hiking if needed)
 	default:
 		return "Unknown"
 	}
 }
 
-// UploadHandler handles FIT file uploads, parsing, and basic processing.
-func UploadHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// fitSeconds converts a FIT time field (scale 1000, units s) to seconds, treating the
+// invalid marker as unknown.
+func fitSeconds(v uint32) float64 {
+	if v == basetype.Uint32Invalid {
+		return 0
 	}
-	// Limit upload size to 10MB
-	r.Body = http.MaxBytesReader(w, r.Body, 10<<20) // 10 MB
-	err := r.ParseMultipartForm(10 << 20)           // Parse form with same limit
-	if err != nil {
-		http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
-		return
+	return float64(v) / 1000.0
+}
+
+// recordFromFIT converts a FIT Record message into the stored record format,
+// preferring the enhanced (32-bit) altitude and speed fields when present.
+func recordFromFIT(record *mesgdef.Record) models.Record {
+	rec := models.Record{Time: record.Timestamp}
+	if record.PositionLat != basetype.Sint32Invalid && record.PositionLong != basetype.Sint32Invalid {
+		rec.Lat = record.PositionLatDegrees()
+		rec.Lon = record.PositionLongDegrees()
 	}
-	// Get the uploaded file (assuming form field name "fit_file")
-	file, header, err := r.FormFile("fit_file")
-	if err != nil {
-		http.Error(w, "Failed to get file: "+err.Error(), http.StatusBadRequest)
-		return
+	if alt := record.EnhancedAltitudeScaled(); !math.IsNaN(alt) {
+		rec.Altitude = &alt
+	} else if alt := record.AltitudeScaled(); !math.IsNaN(alt) {
+		rec.Altitude = &alt
 	}
-	defer file.Close()
-	// Use header for validation and logging
-	if !strings.HasSuffix(header.Filename, ".fit") {
-		http.Error(w, "Only .fit files are allowed", http.StatusBadRequest)
-		return
+	if dist := record.DistanceScaled(); !math.IsNaN(dist) {
+		rec.Distance = dist
 	}
-	log.Printf("Uploaded file: %s (size: %d bytes)", header.Filename, header.Size)
-	// Read the file into a buffer for parsing
-	buf := bytes.NewBuffer(nil)
-	if _, err := io.Copy(buf, file); err != nil {
-		http.Error(w, "Failed to read file: "+err.Error(), http.StatusInternalServerError)
-		return
+	if speed := record.EnhancedSpeedScaled(); !math.IsNaN(speed) {
+		rec.Speed = speed
+	} else if speed := record.SpeedScaled(); !math.IsNaN(speed) {
+		rec.Speed = speed
+	}
+	if record.HeartRate != basetype.Uint8Invalid {
+		rec.HeartRate = record.HeartRate
+	}
+	if record.Cadence != basetype.Uint8Invalid {
+		rec.Cadence = record.Cadence
+	}
+	if record.Power != basetype.Uint16Invalid {
+		rec.Power = record.Power
+	}
+	if record.Temperature != basetype.Sint8Invalid {
+		temp := record.Temperature
+		rec.Temperature = &temp
 	}
+	return rec
+}
+
+// parseFIT decodes a FIT activity file into the common import format.
+func parseFIT(data []byte) (*importedActivity, error) {
 	// Parse the FIT file
-	dec := decoder.New(buf)
+	dec := decoder.New(bytes.NewReader(data))
 	fit, err := dec.Decode()
 	if err != nil {
-		http.Error(w, "Failed to decode FIT file: "+err.Error(), http.StatusBadRequest)
-		return
+		return nil, fmt.Errorf("Failed to decode FIT file: %w", err)
 	}
 	// Extract key messages (loop through all messages)
 	var fileID *mesgdef.FileId
 	var session *mesgdef.Session
-	var recordCount int
-	// NEW: Slice to hold track points for GPX generation
-	var points []struct {
-		Lat  float64
-		Long float64
-		Ele  float64
-		Time int64
-	}
+	imp := &importedActivity{Format: "fit"}
 	for i := range fit.Messages {
 		mesg := &fit.Messages[i] // Reference to the message
 		switch mesg.Num {
@@ -258,97 +340,116 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 			fileID = mesgdef.NewFileId(mesg)
 		case mesgnum.Session:
 			session = mesgdef.NewSession(mesg)
-		case mesgnum.Record:
-			record := mesgdef.NewRecord(mesg)
-			// Check for invalid position values (per FIT spec: 0x7FFFFFFF for signed int32)
-			if record.PositionLat == 0x7FFFFFFF || record.PositionLong == 0x7FFFFFFF {
-				continue // Skip invalid points
+		case mesgnum.Event:
+			event := mesgdef.NewEvent(mesg)
+			if event.Event != typedef.EventTimer {
+				continue
 			}
-			// Convert semicircles to degrees (standard FIT conversion)
-			lat := float64(record.PositionLat) / 11930465.0
-			long := float64(record.PositionLong) / 11930465.0
-			var ele float64
-			// Check for invalid altitude (per FIT spec: 0xFFFF for uint16)
-			if record.Altitude != 0xFFFF {
-				ele = (float64(record.Altitude) / 5.0) - 500.0 // FIT altitude encoding
+			switch event.EventType {
+			case typedef.EventTypeStart:
+				imp.TimerEvents = append(imp.TimerEvents, utils.TimerEvent{Time: event.Timestamp, Start: true})
+			case typedef.EventTypeStop, typedef.EventTypeStopAll, typedef.EventTypeStopDisable, typedef.EventTypeStopDisableAll:
+				imp.TimerEvents = append(imp.TimerEvents, utils.TimerEvent{Time: event.Timestamp, Start: false})
 			}
-			// Timestamp is time.Time; convert to Unix int64
-			ts := record.Timestamp.Unix()
-			points = append(points, struct {
-				Lat  float64
-				Long float64
-				Ele  float64
-				Time int64
-			}{lat, long, ele, ts})
-			recordCount++
+		case mesgnum.Record:
+			imp.Records = append(imp.Records, recordFromFIT(mesgdef.NewRecord(mesg)))
 		}
 		// Note: If developer fields are present (e.g., in mesg.DeveloperFields), you can handle them here for future expansion.
 	}
 	// Validate required messages
 	if fileID == nil {
-		http.Error(w, "No FileId message found in activity", http.StatusBadRequest)
-		return
+		return nil, fmt.Errorf("No FileId message found in activity")
 	}
 	if session == nil {
-		http.Error(w, "No Session message found in activity", http.StatusBadRequest)
+		return nil, fmt.Errorf("No Session message found in activity")
+	}
+
+	imp.Sport = getSportFormatted(byte(session.Sport))
+	imp.StartTime = fileID.TimeCreated
+	imp.SessionElapsed = fitSeconds(session.TotalElapsedTime)
+	imp.SessionTimer = fitSeconds(session.TotalTimerTime)
+	if session.TotalDistance != basetype.Uint32Invalid {
+		imp.DeviceDistance = float64(session.TotalDistance) / 100.0 // FIT scale: uint32 value / 100 = meters
+	}
+	if session.TotalAscent != basetype.Uint16Invalid {
+		ascent := float64(session.TotalAscent) // uint16 value is already in meters
+		imp.DeviceAscent = &ascent
+	}
+	if session.TotalDescent != basetype.Uint16Invalid {
+		descent := float64(session.TotalDescent)
+		imp.DeviceDescent = &descent
+	}
+	return imp, nil
+}
+
+// UploadHandler handles FIT, GPX and TCX file uploads, parsing, and basic processing.
+func UploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	// Generate a unique ID (e.g., UUID)
-	activityID := uuid.New().String()
-	// Extract key data (customize this based on what you need)
-	parsedData := struct {
-		ID          string
-		Type        string // e.g., "running", "hiking"
-		Timestamp   int64
-		Distance    float64 // in meters
-		Elevation   float64 // total ascent in meters
-		RecordCount int     // Number of data points (for GPX-like tracks)
-		Points      []struct {
-			Lat  float64
-			Long float64
-			Ele  float64
-			Time int64
-		} // NEW: Added for track points
-	}{
-		ID:          activityID,
-		Type:        getSportFormatted(byte(session.Sport)),
-		Timestamp:   fileID.TimeCreated.Unix(),              // FIT timestamp (uint32); convert to int64 for Unix time if needed
-		Distance:    float64(session.TotalDistance) / 100.0, // FIT scale: uint32 value / 100 = meters
-		Elevation:   float64(session.TotalAscent),           // uint16 value is already in meters
-		RecordCount: recordCount,
-		Points:      points, // NEW: Assign extracted points
-	}
-	// TODO: Store in DB (Stub for now - replace with Step 4 implementation)
-	// For MVP testing, just log it
-	log.Printf("Parsed Activity: %+v", parsedData)
-	// Example stub: Save to a simple in-memory map or file if you want to test without DB
-	// In Step 4, you'll insert into SQLite, e.g., serialize to JSON for the `stats_json` column
-	// Example stats serialization (adjust based on your actual parsedData fields)
-	statsMap := map[string]any{
-		"distance":    parsedData.Distance,
-		"elevation":   parsedData.Elevation,
-		"recordCount": parsedData.RecordCount,
-		// Add more fields as needed
-	}
-	stats, err := json.Marshal(statsMap)
+	// Limit upload size to the configured maximum
+	r.Body = http.MaxBytesReader(w, r.Body, uploadLimit)
+	err := r.ParseMultipartForm(uploadLimit) // Parse form with same limit
 	if err != nil {
-		// Handle error (e.g., log and return HTTP 500)
-		http.Error(w, "Failed to serialize stats", http.StatusInternalServerError)
+		http.Error(w, "Failed to parse form: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	activity := models.Activity{
-		ID:        parsedData.ID,                      // Or generate a new one if needed: uuid.New().String()
-		Timestamp: time.Unix(parsedData.Timestamp, 0), // Convert int64 Unix timestamp to time.Time
-		Type:      parsedData.Type,
-		StatsJSON: string(stats),
-		GPXData:   utils.GenerateGPXFromFIT(parsedData), // This now works with the updated parsedData
+	// Get the uploaded file (form field name "fit_file" is kept for GPX and TCX too)
+	file, header, err := r.FormFile("fit_file")
+	if err != nil {
+		http.Error(w, "Failed to get file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	// Use header for validation and logging
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if ext != ".fit" && ext != ".gpx" && ext != ".tcx" {
+		http.Error(w, "Only .fit, .gpx and .tcx files are allowed", http.StatusBadRequest)
+		return
+	}
+	log.Printf("Uploaded file: %s (size: %d bytes)", header.Filename, header.Size)
+	// Read the file into a buffer for parsing
+	buf := bytes.NewBuffer(nil)
+	if _, err := io.Copy(buf, file); err != nil {
+		http.Error(w, "Failed to read file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var imp *importedActivity
+	switch ext {
+	case ".fit":
+		imp, err = parseFIT(buf.Bytes())
+	case ".gpx":
+		imp, err = parseGPX(buf.Bytes())
+	case ".tcx":
+		imp, err = parseTCX(buf.Bytes())
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	if err := db.InsertActivity(activity); err != nil {
-		// Handle error (e.g., log and return HTTP 500)
+
+	activityID, prs, err := ingestActivity(imp)
+	if err != nil {
+		log.Printf("Error ingesting %s: %v", header.Filename, err)
 		http.Error(w, "Failed to store activity", http.StatusInternalServerError)
 		return
 	}
+	// Keep the upload itself so full account exports carry the original
+	original := db.ActivityFile{Filename: filepath.Base(header.Filename), Format: imp.Format, Data: buf.Bytes()}
+	if err := db.SetActivityFile(activityID, original); err != nil {
+		log.Printf("Warning: Failed to store original of %s: %v", activityID, err)
+	}
 	// Respond with success (e.g., JSON with ID for frontend to use)
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"status": "success", "activity_id": "%s", "message": "Activity uploaded and parsed"}`, activityID)
+	if prs == nil {
+		prs = []newRecord{}
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":           "success",
+		"activity_id":      activityID,
+		"message":          "Activity uploaded and parsed",
+		"personal_records": prs,
+	})
 }
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// heatmapMaxZoom is the deepest zoom heatmap tiles are rendered at.
+const heatmapMaxZoom = 20
+
+// updateActivityHeatmap stores the density-grid cells of an activity's track.
+func updateActivityHeatmap(act models.Activity, records []models.Record) error {
+	return db.SetActivityHeatmap(act.ID, act.Type, act.Timestamp, utils.HeatmapCells(records))
+}
+
+// rebuildHeatmap recomputes the density grid of every activity, e.g. for activities
+// imported before the heatmap existed.
+func rebuildHeatmap() (int, error) {
+	activities, err := db.ListActivities()
+	if err != nil {
+		return 0, err
+	}
+	for _, act := range activities {
+		records, err := db.GetActivityRecords(act.ID)
+		if err != nil {
+			log.Printf("Error loading records for %s: %v", act.ID, err)
+			continue
+		}
+		if err := updateActivityHeatmap(act, records); err != nil {
+			log.Printf("Error updating heatmap for %s: %v", act.ID, err)
+		}
+	}
+	return len(activities), nil
+}
+
+// HeatmapTileHandler serves GET /api/heatmap/{z}/{x}/{y}.png: a transparent PNG tile of
+// how many activities crossed each pixel, optionally filtered by ?sport= and
+// ?from=YYYY-MM-DD&to=YYYY-MM-DD (to is exclusive).
+func HeatmapTileHandler(w http.ResponseWriter, r *http.Request) {
+	z, errZ := strconv.Atoi(r.PathValue("z"))
+	x, errX := strconv.Atoi(r.PathValue("x"))
+	y, errY := strconv.Atoi(strings.TrimSuffix(r.PathValue("y"), ".png"))
+	if errZ != nil || errX != nil || errY != nil || z < 0 || z > heatmapMaxZoom || x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+		http.Error(w, "Invalid tile coordinates", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := db.HeatmapFilter{Sport: q.Get("sport")}
+	var err error
+	if v := q.Get("from"); v != "" {
+		if filter.From, err = time.Parse("2006-01-02", v); err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if filter.To, err = time.Parse("2006-01-02", v); err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+	}
+
+	heat, cellSize, err := db.GetHeatmapTile(z, x, y, filter)
+	if err != nil {
+		log.Printf("Error loading heatmap tile %d/%d/%d: %v", z, x, y, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	img, err := utils.RenderHeatmapTile(heat, cellSize)
+	if err != nil {
+		log.Printf("Error rendering heatmap tile %d/%d/%d: %v", z, x, y, err)
+		http.Error(w, "Failed to render tile", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	// Tiles change as activities are added, so only cache briefly
+	w.Header().Set("Cache-Control", "max-age=300")
+	w.Write(img)
+}
+
+// HeatmapRebuildHandler recomputes the heatmap density grid of all activities (POST).
+func HeatmapRebuildHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n, err := rebuildHeatmap()
+	if err != nil {
+		log.Printf("Error rebuilding heatmap: %v", err)
+		http.Error(w, "Failed to rebuild heatmap", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("HX-Trigger", "heatmapChanged")
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, "<p>Heatmap rebuilt from %d activities.</p>", n)
+}
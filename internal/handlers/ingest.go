@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid" // For unique IDs
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// importedActivity is the format-independent result of parsing an uploaded file.
+// Every importer fills it so the same processing applies to FIT and GPX alike.
+type importedActivity struct {
+	Format         string // "fit", "gpx" or "tcx"
+	Sport          string
+	StartTime      time.Time
+	Records        []models.Record
+	TimerEvents    []utils.TimerEvent
+	SessionElapsed float64  // device-reported seconds, 0 if unknown
+	SessionTimer   float64  // device-reported seconds, 0 if unknown
+	DeviceDistance float64  // device-reported meters, 0 if unknown
+	DeviceAscent   *float64 // device-reported meters, nil if unknown
+	DeviceDescent  *float64 // device-reported meters, nil if unknown
+}
+
+// parseGPX reads a GPX track into the common import format.
+func parseGPX(data []byte) (*importedActivity, error) {
+	gpx, err := utils.ParseGPX(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &importedActivity{
+		Format:      "gpx",
+		Sport:       gpx.Sport,
+		StartTime:   gpx.StartTime,
+		Records:     gpx.Records,
+		TimerEvents: gpx.TimerEvents,
+	}, nil
+}
+
+// parseTCX reads a TCX activity into the common import format.
+func parseTCX(data []byte) (*importedActivity, error) {
+	tcx, err := utils.ParseTCX(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &importedActivity{
+		Format:       "tcx",
+		Sport:        tcx.Sport,
+		StartTime:    tcx.StartTime,
+		Records:      tcx.Records,
+		TimerEvents:  tcx.TimerEvents,
+		SessionTimer: tcx.TimerTime,
+	}, nil
+}
+
+// buildStats computes the stats_json summary of an imported activity. Elevation is
+// recomputed from the altitude stream for every format; device totals are kept next to
+// it when the file has them.
+func buildStats(imp *importedActivity) map[string]any {
+	records := imp.Records
+	durations := utils.ComputeDurations(records, imp.TimerEvents, imp.SessionElapsed, imp.SessionTimer, imp.Sport)
+
+	distance := imp.DeviceDistance
+	if distance == 0 && len(records) > 0 {
+		distance = records[len(records)-1].Distance
+	}
+	recordCount := 0
+	for _, r := range records {
+		if r.HasPosition() {
+			recordCount++
+		}
+	}
+
+	statsMap := map[string]any{
+		"distance":    distance,
+		"recordCount": recordCount,
+		"elapsedTime": durations.Elapsed, // seconds
+		"timerTime":   durations.Timer,   // seconds
+		"movingTime":  durations.Moving,  // seconds
+		"pauses":      len(durations.Pauses),
+		// Add more fields as needed
+	}
+
+	if imp.DeviceAscent != nil {
+		statsMap["deviceAscent"] = *imp.DeviceAscent
+	}
+	if imp.DeviceDescent != nil {
+		statsMap["deviceDescent"] = *imp.DeviceDescent
+	}
+	for k, v := range elevationStats(records, imp.Sport, imp.DeviceAscent) {
+		if v != nil {
+			statsMap[k] = v
+		}
+	}
+
+	// Averages are based on moving time so stops at lights or summits don't drag them down
+	if durations.Moving > 0 && distance > 0 {
+		statsMap["avgSpeed"] = distance / durations.Moving         // m/s
+		statsMap["avgPace"] = durations.Moving / (distance / 1000) // s/km
+	}
+	return statsMap
+}
+
+// elevationStats returns the stats that depend on the altitude stream, with nil for the
+// ones that don't apply so the map can also be passed to db.MergeActivityStats when the
+// stream changes (e.g. after DEM correction).
+func elevationStats(records []models.Record, sport string, deviceAscent *float64) map[string]any {
+	stats := map[string]any{
+		"ascent": nil, "descent": nil, "minAltitude": nil, "maxAltitude": nil,
+		"demCorrected": nil, "avgGapSpeed": nil, "avgGapPace": nil,
+	}
+	// "elevation" stays the headline ascent: the device total when reported, else ours
+	stats["elevation"] = 0.0
+	if elev, ok := utils.ComputeElevation(records); ok {
+		stats["ascent"] = elev.Ascent
+		stats["descent"] = elev.Descent
+		stats["minAltitude"] = elev.MinAltitude
+		stats["maxAltitude"] = elev.MaxAltitude
+		stats["elevation"] = elev.Ascent
+	}
+	if deviceAscent != nil {
+		stats["elevation"] = *deviceAscent
+	}
+	if utils.HasDEMAltitude(records) {
+		stats["demCorrected"] = 1
+	}
+	// Grade-adjusted pace only means something on foot
+	if utils.IsPaceSport(sport) {
+		if gap := utils.AverageGAP(records, sport); gap > 0 {
+			stats["avgGapSpeed"] = gap       // m/s
+			stats["avgGapPace"] = 1000 / gap // s/km
+		}
+	}
+	return stats
+}
+
+// ingestActivity stores an imported activity with its stats, GPX track and record
+// stream, then runs the derived analyses. It returns the new ID and any personal
+// records set.
+func ingestActivity(imp *importedActivity) (string, []newRecord, error) {
+	// Generate a unique ID (e.g., UUID)
+	activityID := uuid.New().String()
+	utils.EnsureDistance(imp.Records)
+	correctElevation(imp.Records)
+	statsMap := buildStats(imp)
+
+	// Track points with a GPS fix for the GPX map layer
+	var points []struct {
+		Lat  float64
+		Long float64
+		Ele  float64
+		Time int64
+	}
+	for _, rec := range imp.Records {
+		if !rec.HasPosition() {
+			continue
+		}
+		var ele float64
+		if rec.Altitude != nil {
+			ele = *rec.Altitude
+		}
+		points = append(points, struct {
+			Lat  float64
+			Long float64
+			Ele  float64
+			Time int64
+		}{rec.Lat, rec.Lon, ele, rec.Time.Unix()})
+	}
+	parsedData := struct {
+		ID          string
+		Type        string
+		Timestamp   int64
+		Distance    float64
+		Elevation   float64
+		RecordCount int
+		Points      []struct {
+			Lat  float64
+			Long float64
+			Ele  float64
+			Time int64
+		}
+	}{
+		ID:          activityID,
+		Type:        imp.Sport,
+		Timestamp:   imp.StartTime.Unix(),
+		Distance:    statsMap["distance"].(float64),
+		Elevation:   statsMap["elevation"].(float64),
+		RecordCount: len(points),
+		Points:      points,
+	}
+	log.Printf("Parsed %s activity %s: %s, %d records", imp.Format, activityID, imp.Sport, len(imp.Records))
+
+	stats, err := json.Marshal(statsMap)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to serialize stats: %w", err)
+	}
+	recordsJSON, err := json.Marshal(imp.Records)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to serialize records: %w", err)
+	}
+	activity := models.Activity{
+		ID:          activityID,
+		Timestamp:   imp.StartTime,
+		Type:        imp.Sport,
+		StatsJSON:   string(stats),
+		GPXData:     utils.GenerateGPXFromFIT(parsedData),
+		RecordsJSON: string(recordsJSON),
+	}
+	if err := db.InsertActivity(activity); err != nil {
+		return "", nil, err
+	}
+	prs := analyzeActivity(activity, imp.Records)
+	TriggerTrainingLoadRecompute()
+	return activityID, prs, nil
+}
+
+// analyzeActivity runs the derived analyses of a stored activity and returns the
+// personal records it set. Failures are logged but don't fail the import. Features that
+// are switched off still get their data, so switching one on shows the whole history.
+func analyzeActivity(activity models.Activity, records []models.Record) []newRecord {
+	if err := updateActivityZones(activity.ID, activity.Timestamp, records); err != nil {
+		log.Printf("Error computing zones for %s: %v", activity.ID, err)
+	}
+	if err := updateActivityPower(activity.ID, activity.Timestamp, records); err != nil {
+		log.Printf("Error computing power for %s: %v", activity.ID, err)
+	}
+	if err := updateActivityLoad(activity.ID, activity.Timestamp, records); err != nil {
+		log.Printf("Error computing load for %s: %v", activity.ID, err)
+	}
+	if err := updateActivityClimbs(activity, records); err != nil {
+		log.Printf("Error detecting climbs for %s: %v", activity.ID, err)
+	}
+	if err := updateActivityHeatmap(activity, records); err != nil {
+		log.Printf("Error updating heatmap for %s: %v", activity.ID, err)
+	}
+	if err := updateActivityTracks(activity, records); err != nil {
+		log.Printf("Error simplifying track for %s: %v", activity.ID, err)
+	}
+	if err := updateActivityThumbnail(activity, records); err != nil {
+		log.Printf("Error rendering thumbnail for %s: %v", activity.ID, err)
+	}
+	if err := updateActivityRoute(activity, records); err != nil {
+		log.Printf("Error clustering route for %s: %v", activity.ID, err)
+	}
+	if err := updateActivitySegments(activity, records); err != nil {
+		log.Printf("Error matching segments for %s: %v", activity.ID, err)
+	}
+	prs, err := updateActivityEfforts(activity, records)
+	if err != nil {
+		log.Printf("Error computing best efforts for %s: %v", activity.ID, err)
+	}
+	return prs
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sync"
+)
+
+// jobPollDelay is how long a settings panel waits before asking again whether the
+// background job it started has finished.
+const jobPollDelay = "2s"
+
+// backgroundJob runs a recompute over the whole history outside the request that asked
+// for it. Triggers while a run is queued coalesce into it; a trigger while one is
+// running queues one more run, so the last change is always picked up.
+type backgroundJob struct {
+	name string
+	run  func() error
+
+	wake chan struct{}
+
+	mu      sync.Mutex
+	queued  bool
+	running bool
+}
+
+// newBackgroundJob returns a job running run; start it with Start.
+func newBackgroundJob(name string, run func() error) *backgroundJob {
+	return &backgroundJob{name: name, run: run, wake: make(chan struct{}, 1)}
+}
+
+// Trigger schedules a run.
+func (j *backgroundJob) Trigger() {
+	j.mu.Lock()
+	j.queued = true
+	j.mu.Unlock()
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Busy reports whether a run is queued or in progress.
+func (j *backgroundJob) Busy() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.queued || j.running
+}
+
+// Start runs the job in the background whenever it is triggered.
+func (j *backgroundJob) Start() {
+	go func() {
+		for range j.wake {
+			j.mu.Lock()
+			if !j.queued {
+				j.mu.Unlock()
+				continue
+			}
+			j.queued, j.running = false, true
+			j.mu.Unlock()
+
+			if err := j.run(); err != nil {
+				log.Printf("Error %s: %v", j.name, err)
+			}
+
+			j.mu.Lock()
+			j.running = false
+			j.mu.Unlock()
+		}
+	}()
+}
+
+// jobProgress follows a background job from a settings panel. While the job is busy it
+// returns a note that asks url again after jobPollDelay (with ?wait=1); once a waiting
+// panel sees the job idle, it fires event so the panels showing derived data reload.
+func jobProgress(w http.ResponseWriter, r *http.Request, job *backgroundJob, url, target, note, event string) string {
+	if job.Busy() {
+		return `<p hx-get="` + url + `?wait=1" hx-trigger="load delay:` + jobPollDelay + `" hx-target="` + target +
+			`" hx-swap="innerHTML">` + note + `</p>`
+	}
+	if r.URL.Query().Get("wait") == "1" && event != "" {
+		w.Header().Set("HX-Trigger", event)
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// loadChartDays is the default span of the dashboard's fitness/fatigue chart.
+const loadChartDays = 90
+
+// loadRecompute coalesces recompute requests: while one is pending, further triggers are no-ops.
+var loadRecompute = make(chan struct{}, 1)
+
+// TriggerTrainingLoadRecompute schedules a background rebuild of the training-load series.
+func TriggerTrainingLoadRecompute() {
+	select {
+	case loadRecompute <- struct{}{}:
+	default:
+	}
+}
+
+// StartTrainingLoadWorker rebuilds the training-load series whenever activities change,
+// and once a day so the series keeps decaying through days without training.
+func StartTrainingLoadWorker() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		lastDay := ""
+		for {
+			select {
+			case <-loadRecompute:
+			case <-ticker.C:
+				if time.Now().UTC().Format("2006-01-02") == lastDay {
+					continue
+				}
+			}
+			if err := recomputeTrainingLoad(); err != nil {
+				log.Printf("Error recomputing training load: %v", err)
+				continue
+			}
+			lastDay = time.Now().UTC().Format("2006-01-02")
+		}
+	}()
+	TriggerTrainingLoadRecompute()
+}
+
+// recomputeTrainingLoad rebuilds the daily CTL/ATL/TSB series from the stored activity loads.
+func recomputeTrainingLoad() error {
+	daily, err := db.GetDailyLoads()
+	if err != nil {
+		return err
+	}
+	series := utils.TrainingLoadSeries(daily, time.Now().UTC())
+	if err := db.ReplaceTrainingLoad(series); err != nil {
+		return err
+	}
+	log.Printf("Training load recomputed: %d days", len(series))
+	return nil
+}
+
+// updateActivityLoad scores an activity's training stress with the best available
+// measure (TSS, hrTSS or TRIMP). Call it after the power analysis has run.
+func updateActivityLoad(id string, timestamp time.Time, records []models.Record) error {
+	stats, err := db.GetActivityStats(id)
+	if err != nil {
+		return err
+	}
+	tss, _ := stats["tss"].(float64)
+	profile, err := db.GetHRProfileAt(timestamp)
+	if err != nil {
+		return err
+	}
+	load, method := utils.ActivityLoad(tss, records, profile)
+	return db.SetActivityLoad(id, load, method)
+}
+
+// TrainingLoadHandler handles GET /api/training-load?from=YYYY-MM-DD&to=YYYY-MM-DD and
+// returns the daily training-load series as JSON. Both bounds are optional.
+func TrainingLoadHandler(w http.ResponseWriter, r *http.Request) {
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	for _, v := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", v); v != "" && err != nil {
+			http.Error(w, "Dates must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	series, err := db.GetTrainingLoad(from, to)
+	if err != nil {
+		log.Printf("Error loading training load: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if series == nil {
+		series = []utils.LoadDay{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"days": series})
+}
+
+// TrainingLoadChartHandler returns an HTML partial with the fitness/fatigue/form chart of
+// the last ?days=N days (default 90).
+func TrainingLoadChartHandler(w http.ResponseWriter, r *http.Request) {
+	days := loadChartDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	from := time.Now().UTC().AddDate(0, 0, -days).Format("2006-01-02")
+	series, err := db.GetTrainingLoad(from, "")
+	if err != nil {
+		log.Printf("Error loading training load: %v", err)
+		http.Error(w, "Failed to load training load", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if len(series) == 0 {
+		fmt.Fprint(w, "<p>No training load yet. Add a heart-rate profile or FTP to score activities.</p>")
+		return
+	}
+
+	ctl := utils.ChartSeries{Name: "Fitness (CTL)", Color: "#2196f3", Fill: true}
+	atl := utils.ChartSeries{Name: "Fatigue (ATL)", Color: "#e91e63"}
+	tsb := utils.ChartSeries{Name: "Form (TSB)", Color: "#ff9800"}
+	for _, d := range series {
+		t, _ := time.Parse("2006-01-02", d.Date)
+		x := float64(t.Unix())
+		ctl.X, ctl.Y = append(ctl.X, x), append(ctl.Y, d.CTL)
+		atl.X, atl.Y = append(atl.X, x), append(atl.Y, d.ATL)
+		tsb.X, tsb.Y = append(tsb.X, x), append(tsb.Y, d.TSB)
+	}
+	last := series[len(series)-1]
+	out := utils.LineChartSVG(utils.ChartOptions{
+		Width:   800,
+		Height:  250,
+		XFormat: func(v float64) string { return time.Unix(int64(v), 0).UTC().Format("Jan 2") },
+	}, ctl, atl, tsb)
+	out += fmt.Sprintf("<p>Today: fitness %.0f, fatigue %.0f, form %+.0f</p>", last.CTL, last.ATL, last.TSB)
+	fmt.Fprint(w, out)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// powerStatKeys are the stats_json keys written by the power analysis.
+var powerStatKeys = []string{"avgPower", "normalizedPower", "intensityFactor", "tss", "variabilityIndex", "ftp"}
+
+// updateActivityPower computes the power metrics and mean-maximal curve of an activity
+// against the FTP in effect on its date. Activities without power data are cleared.
+func updateActivityPower(id string, timestamp time.Time, records []models.Record) error {
+	values := map[string]any{}
+	for _, k := range powerStatKeys {
+		values[k] = nil
+	}
+	if !utils.HasPower(records) {
+		if err := db.SetActivityPowerCurve(id, nil); err != nil {
+			return err
+		}
+		return db.MergeActivityStats(id, values)
+	}
+
+	ftp, err := db.GetFTPAt(timestamp)
+	if err != nil {
+		return err
+	}
+	stream := utils.PowerStream(records)
+	m := utils.ComputePowerMetrics(stream, float64(ftp))
+	values["avgPower"] = m.AvgPower
+	values["normalizedPower"] = m.NormalizedPower
+	values["variabilityIndex"] = m.VariabilityIndex
+	if ftp > 0 {
+		values["ftp"] = ftp
+		values["intensityFactor"] = m.IntensityFactor
+		values["tss"] = m.TSS
+	}
+	if err := db.MergeActivityStats(id, values); err != nil {
+		return err
+	}
+	return db.SetActivityPowerCurve(id, utils.MeanMaxPower(stream, utils.PowerCurveDurations))
+}
+
+// powerJob rescores every activity's power after the FTP history changes, so saving
+// an FTP doesn't wait for the whole history.
+var powerJob = newBackgroundJob("recomputing power", recomputeAllPower)
+
+// StartPowerWorker runs the power rescoring the FTP form queues.
+func StartPowerWorker() {
+	powerJob.Start()
+}
+
+// recomputeAllPower refreshes power metrics and training load for every activity,
+// e.g. after the FTP history changed.
+func recomputeAllPower() error {
+	activities, err := db.ListActivities()
+	if err != nil {
+		return err
+	}
+	for _, act := range activities {
+		records, err := db.GetActivityRecords(act.ID)
+		if err != nil {
+			log.Printf("Error loading records for %s: %v", act.ID, err)
+			continue
+		}
+		if err := updateActivityPower(act.ID, act.Timestamp, records); err != nil {
+			log.Printf("Error updating power for %s: %v", act.ID, err)
+		}
+		if err := updateActivityLoad(act.ID, act.Timestamp, records); err != nil {
+			log.Printf("Error updating load for %s: %v", act.ID, err)
+		}
+	}
+	// Rebuilt here rather than triggered, so the chart is current when the panels reload
+	return recomputeTrainingLoad()
+}
+
+// FTPHandler shows (GET) and extends (POST) the FTP history as an HTML partial.
+// Adding an entry rescores every ride in the background.
+func FTPHandler(w http.ResponseWriter, r *http.Request) {
+	var msg string
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		from, err := time.Parse("2006-01-02", r.FormValue("effective_from"))
+		if err != nil {
+			http.Error(w, "Invalid effective_from date", http.StatusBadRequest)
+			return
+		}
+		ftp, err := strconv.Atoi(r.FormValue("ftp"))
+		if err != nil || ftp <= 0 {
+			http.Error(w, "FTP must be a positive number of watts", http.StatusBadRequest)
+			return
+		}
+		if _, err := db.InsertFTP(models.FTPEntry{EffectiveFrom: from.UTC(), FTP: ftp}); err != nil {
+			log.Printf("Error saving ftp: %v", err)
+			http.Error(w, "Failed to save FTP", http.StatusInternalServerError)
+			return
+		}
+		powerJob.Trigger()
+		msg = "<p>FTP saved.</p>"
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries, err := db.GetFTPHistory()
+	if err != nil {
+		log.Printf("Error loading ftp history: %v", err)
+		http.Error(w, "Failed to load FTP history", http.StatusInternalServerError)
+		return
+	}
+
+	out := `<form hx-post="/api/ftp" hx-target="#ftp-history" hx-swap="innerHTML">
+		<label>From <input type="date" name="effective_from" required></label>
+		<label>FTP (W) <input type="number" name="ftp" min="50" max="600" required></label>
+		<button type="submit">Add FTP</button>
+	</form>` + msg + jobProgress(w, r, powerJob, "/api/ftp", "#ftp-history", "Rescoring past rides…", "powerChanged")
+	if len(entries) == 0 {
+		out += "<p>No FTP set yet; IF and TSS are not computed.</p>"
+	} else {
+		out += `<table><thead><tr><th>From</th><th>FTP (W)</th></tr></thead><tbody>`
+		for _, e := range entries {
+			out += fmt.Sprintf("<tr><td>%s</td><td>%d</td></tr>", e.EffectiveFrom.Format("2006-01-02"), e.FTP)
+		}
+		out += `</tbody></table>`
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, out)
+}
+
+// PowerCurveHandler handles GET /api/power-curve and returns a mean-maximal power curve
+// as JSON: for one activity with ?id=<uuid>, otherwise the best curve across activities,
+// optionally limited by ?from=YYYY-MM-DD&to=YYYY-MM-DD (to is exclusive) or ?season=YYYY.
+func PowerCurveHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var curve []utils.PowerCurvePoint
+	var err error
+
+	if id := q.Get("id"); id != "" {
+		curve, err = db.GetActivityPowerCurve(id)
+	} else {
+		var from, to time.Time
+		if season := q.Get("season"); season != "" {
+			year, convErr := strconv.Atoi(season)
+			if convErr != nil {
+				http.Error(w, "Invalid season", http.StatusBadRequest)
+				return
+			}
+			from = time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+			to = from.AddDate(1, 0, 0)
+		}
+		if v := q.Get("from"); v != "" {
+			if from, err = time.Parse("2006-01-02", v); err != nil {
+				http.Error(w, "Invalid from date", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := q.Get("to"); v != "" {
+			if to, err = time.Parse("2006-01-02", v); err != nil {
+				http.Error(w, "Invalid to date", http.StatusBadRequest)
+				return
+			}
+		}
+		curve, err = db.GetBestPowerCurve(from, to)
+	}
+	if err != nil {
+		log.Printf("Error loading power curve: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"curve": curve})
+}
+
+// renderActivityPower builds the power section of the activity detail partial.
+func renderActivityPower(act models.Activity, stats map[string]interface{}) string {
+	np, ok := stats["normalizedPower"].(float64)
+	if !ok {
+		return ""
+	}
+	out := `<h3>Power</h3><ul>`
+	out += fmt.Sprintf("<li><strong>Average:</strong> %.0f W</li>", stats["avgPower"])
+	out += fmt.Sprintf("<li><strong>Normalized:</strong> %.0f W</li>", np)
+	out += fmt.Sprintf("<li><strong>Variability index:</strong> %.2f</li>", stats["variabilityIndex"])
+	if ftp, ok := stats["ftp"].(float64); ok {
+		out += fmt.Sprintf("<li><strong>Intensity factor:</strong> %.2f (FTP %.0f W)</li>", stats["intensityFactor"], ftp)
+		out += fmt.Sprintf("<li><strong>TSS:</strong> %.0f</li>", stats["tss"])
+	}
+	out += `</ul>`
+
+	curve, err := db.GetActivityPowerCurve(act.ID)
+	if err != nil {
+		log.Printf("Warning: Failed to load power curve for %s: %v", act.ID, err)
+		return out
+	}
+	if len(curve) > 0 {
+		out += `<table class="power-curve"><thead><tr><th>Duration</th><th>Best power</th></tr></thead><tbody>`
+		for _, p := range curve {
+			out += fmt.Sprintf("<tr><td>%s</td><td>%.0f W</td></tr>", utils.FormatDuration(float64(p.Duration)), p.Watts)
+		}
+		out += `</tbody></table>`
+	}
+	return out
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// maxPrivacyRadius bounds a zone's radius in meters.
+const maxPrivacyRadius = 5000
+
+// publicTrack returns the parts of a track left visible by the privacy zones, read at
+// request time so existing activities pick up new zones without reprocessing.
+func publicTrack(records []models.Record) ([][]models.Record, error) {
+	zones, err := db.GetPrivacyZones()
+	if err != nil {
+		return nil, err
+	}
+	return utils.TrimPrivacyZones(records, zones), nil
+}
+
+// createPrivacyZone validates the form of a new privacy zone and stores it.
+func createPrivacyZone(r *http.Request) (*models.PrivacyZone, error) {
+	lat, err1 := strconv.ParseFloat(r.FormValue("lat"), 64)
+	lon, err2 := strconv.ParseFloat(r.FormValue("lon"), 64)
+	if err1 != nil || err2 != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return nil, fmt.Errorf("Invalid center: latitude and longitude are required")
+	}
+	radius, err := strconv.ParseFloat(r.FormValue("radius"), 64)
+	if err != nil || radius <= 0 || radius > maxPrivacyRadius {
+		return nil, fmt.Errorf("Invalid radius: must be between 0 and %d m", maxPrivacyRadius)
+	}
+	z := models.PrivacyZone{
+		Name:      strings.TrimSpace(r.FormValue("name")),
+		Lat:       lat,
+		Lon:       lon,
+		Radius:    radius,
+		CreatedAt: time.Now().UTC(),
+	}
+	if z.ID, err = db.InsertPrivacyZone(z); err != nil {
+		return nil, err
+	}
+	return &z, nil
+}
+
+// PrivacyZonesHandler lists privacy zones (GET), creates one from name, lat, lon and
+// radius (POST) or deletes ?id= (DELETE), returning the list as an HTML partial.
+func PrivacyZonesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if _, err := createPrivacyZone(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+			return
+		}
+		if err := db.DeletePrivacyZone(id); err != nil {
+			log.Printf("Error deleting privacy zone %d: %v", id, err)
+			http.Error(w, "Failed to delete privacy zone", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Thumbnails are drawn from trimmed tracks; they are rendered again on request
+	if r.Method != http.MethodGet {
+		if err := db.ClearAllThumbnails(); err != nil {
+			log.Printf("Error clearing thumbnails after privacy zone change: %v", err)
+		}
+	}
+
+	zones, err := db.GetPrivacyZones()
+	if err != nil {
+		log.Printf("Error loading privacy zones: %v", err)
+		http.Error(w, "Failed to load privacy zones", http.StatusInternalServerError)
+		return
+	}
+	var out string
+	if len(zones) == 0 {
+		out = "<p>No privacy zones. Tracks are shown in full everywhere.</p>"
+	} else {
+		out = `<table><thead><tr><th>Name</th><th>Center</th><th>Radius</th><th></th></tr></thead><tbody>`
+		for _, z := range zones {
+			out += fmt.Sprintf(`<tr><td>%s</td><td>%.5f, %.5f</td><td>%.0f m</td>
+				<td><button hx-delete="/api/privacy-zones?id=%d" hx-confirm="Delete this privacy zone?" hx-target="#privacy-zones" hx-swap="innerHTML">Delete</button></td></tr>`,
+				html.EscapeString(z.Name), z.Lat, z.Lon, z.Radius, z.ID)
+		}
+		out += `</tbody></table>`
+	}
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, out)
+}
+
+// shareToken returns the token of an activity's share link, creating it on first use.
+// Share links carry the token instead of the activity ID, so they only lead to the
+// trimmed public views, never to the owner's endpoints.
+func shareToken(activityID string) (string, error) {
+	token, err := db.GetShareToken(activityID)
+	if token != "" || err != nil {
+		return token, err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	if err := db.SetShareToken(activityID, base64.RawURLEncoding.EncodeToString(b)); err != nil {
+		return "", err
+	}
+	// Read back: a concurrent request may have stored its token first
+	return db.GetShareToken(activityID)
+}
+
+// PublicActivityHandler returns the shareable view of the activity behind the share
+// token ?token= as an HTML partial: headline stats and a map of the track with privacy
+// zones trimmed.
+func PublicActivityHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	id, err := db.GetSharedActivityID(token)
+	var act *models.Activity
+	if err == nil && id != "" {
+		act, err = db.GetActivityByID(id)
+	}
+	if err != nil {
+		log.Printf("Error loading activity: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if act == nil {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return
+	}
+	var stats map[string]float64
+	if err := json.Unmarshal([]byte(act.StatsJSON), &stats); err != nil {
+		log.Printf("Warning: Failed to unmarshal stats for %s: %v", act.ID, err)
+	}
+	units := getUnits()
+	elevation := stats["elevation"]
+	if v, ok := stats["ascent"]; ok && getElevationSource() == ElevationComputed {
+		elevation = v
+	}
+	out := fmt.Sprintf(`<h2>%s on %s</h2>
+		<ul>
+			<li><strong>Distance:</strong> %s</li>
+			<li><strong>Moving time:</strong> %s</li>
+			<li><strong>Elevation gain:</strong> %.0f m</li>
+			<li><strong>Average:</strong> %s</li>
+		</ul>
+		<div id="map" style="height: 400px; width: 100%%;" data-track="/api/share/%s/track"></div>`,
+		html.EscapeString(act.Type), act.Timestamp.Format("2006-01-02"), utils.FormatDistance(stats["distance"], units),
+		utils.FormatDuration(stats["movingTime"]), elevation, utils.FormatSpeedOrPace(stats["avgSpeed"], act.Type, units),
+		url.PathEscape(token))
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, out)
+}
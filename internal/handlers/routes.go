@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// routeName returns the display name of a route.
+func routeName(name string, id int64) string {
+	if name == "" {
+		return fmt.Sprintf("Route #%d", id)
+	}
+	return name
+}
+
+// updateActivityRoute fingerprints an activity and adds it to the first route it
+// matches, founding a new route otherwise. Activities the user moved by hand stay put.
+func updateActivityRoute(act models.Activity, records []models.Record) error {
+	if _, manual, err := db.GetActivityRoute(act.ID); err != nil || manual {
+		return err
+	}
+	fp, ok := utils.ComputeFingerprint(records)
+	if !ok {
+		return db.ClearActivityRoute(act.ID)
+	}
+	start, end := fp.Points[0], fp.Points[len(fp.Points)-1]
+	routes, err := db.FindRoutes(act.Type, utils.NeighborCells(start.Lat, start.Lon), utils.NeighborCells(end.Lat, end.Lon))
+	if err != nil {
+		return err
+	}
+	for _, r := range routes {
+		if utils.SameRoute(r.Fingerprint, fp) {
+			return db.SetActivityRoute(act.ID, r.ID, fp, false)
+		}
+	}
+	routeID, err := db.InsertRoute(act.Type, fp)
+	if err != nil {
+		return err
+	}
+	return db.SetActivityRoute(act.ID, routeID, fp, false)
+}
+
+// reclusterRoutes fingerprints and clusters every activity again, except those the user
+// assigned by hand, e.g. for activities imported before routes existed.
+func reclusterRoutes() error {
+	activities, err := db.ListActivities()
+	if err != nil {
+		return err
+	}
+	for _, act := range activities {
+		records, err := db.GetActivityRecords(act.ID)
+		if err != nil {
+			log.Printf("Error loading records for %s: %v", act.ID, err)
+			continue
+		}
+		utils.EnsureDistance(records)
+		if err := updateActivityRoute(act, records); err != nil {
+			log.Printf("Error clustering %s: %v", act.ID, err)
+		}
+	}
+	return nil
+}
+
+// routesJob reclusters every activity when asked to, outside the request that asked.
+var routesJob = newBackgroundJob("reclustering routes", reclusterRoutes)
+
+// StartRoutesWorker runs the reclustering the routes panel queues.
+func StartRoutesWorker() {
+	routesJob.Start()
+}
+
+// RoutesHandler lists routes done at least twice (GET, ?all=1 for every route) and
+// renames a route (POST with id and name), as an HTML partial.
+func RoutesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid id", http.StatusBadRequest)
+			return
+		}
+		if err := db.RenameRoute(id, strings.TrimSpace(r.FormValue("name"))); err != nil {
+			log.Printf("Error renaming route %d: %v", id, err)
+			http.Error(w, "Failed to rename route", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("HX-Trigger", "routesChanged")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	minCount := 2
+	if r.URL.Query().Get("all") == "1" {
+		minCount = 1
+	}
+	routes, err := db.GetRoutes(minCount)
+	if err != nil {
+		log.Printf("Error loading routes: %v", err)
+		http.Error(w, "Failed to load routes", http.StatusInternalServerError)
+		return
+	}
+	units := getUnits()
+	out := `<button hx-post="/api/routes/recluster" hx-target="#routes" hx-swap="innerHTML">Recluster all activities</button>`
+	out += jobProgress(w, r, routesJob, "/api/routes", "#routes", "Reclustering all activities…", "")
+	if len(routes) == 0 {
+		out += "<p>No repeated routes yet.</p>"
+	} else {
+		out += `<table><thead><tr><th>Route</th><th>Sport</th><th>Length</th><th>Times</th><th>Best</th><th>Average</th><th>Last</th><th></th></tr></thead><tbody>`
+		for _, rt := range routes {
+			out += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%s</td><td>%s</td><td>%s</td>
+				<td><button hx-get="/api/routes/detail?id=%d" hx-target="#route-detail" hx-swap="innerHTML">Details</button></td></tr>`,
+				html.EscapeString(routeName(rt.Name, rt.ID)), html.EscapeString(rt.Sport), utils.FormatDistance(rt.Length, units), rt.Count,
+				utils.FormatDuration(rt.Best), utils.FormatDuration(rt.Average), rt.Last.Format("2006-01-02"), rt.ID)
+		}
+		out += `</tbody></table>`
+	}
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, out)
+}
+
+// RouteReclusterHandler queues reclustering every activity (POST) and returns the routes
+// list, which follows the job until it finishes.
+func RouteReclusterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	routesJob.Trigger()
+	r.Method = http.MethodGet
+	RoutesHandler(w, r)
+}
+
+// RouteDetailHandler returns an HTML partial for the route ?id=: rename and merge forms,
+// a moving-time trend chart and its activities with a button to split each off.
+func RouteDetailHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return
+	}
+	route, err := db.GetRoute(id)
+	if err != nil {
+		log.Printf("Error loading route %d: %v", id, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if route == nil {
+		http.Error(w, "Route not found", http.StatusNotFound)
+		return
+	}
+	activities, err := db.GetRouteActivities(id)
+	if err != nil {
+		log.Printf("Error loading activities of route %d: %v", id, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	others, err := db.GetRoutes(1)
+	if err != nil {
+		log.Printf("Error loading routes: %v", err)
+	}
+
+	out := fmt.Sprintf(`<h3>%s</h3>
+		<form hx-post="/api/routes" hx-target="#routes" hx-swap="innerHTML">
+			<input type="hidden" name="id" value="%d">
+			<label>Name <input type="text" name="name" value="%s"></label>
+			<button type="submit">Rename</button>
+		</form>`, html.EscapeString(routeName(route.Name, route.ID)), route.ID, html.EscapeString(route.Name))
+
+	var options string
+	for _, o := range others {
+		if o.ID != route.ID && o.Sport == route.Sport {
+			options += fmt.Sprintf(`<option value="%d">%s (%d)</option>`, o.ID, html.EscapeString(routeName(o.Name, o.ID)), o.Count)
+		}
+	}
+	if options != "" {
+		out += fmt.Sprintf(`<form hx-post="/api/routes/merge" hx-target="#route-detail" hx-swap="innerHTML">
+			<input type="hidden" name="into" value="%d">
+			<label>Merge in <select name="from">%s</select></label>
+			<button type="submit">Merge</button>
+		</form>`, route.ID, options)
+	}
+
+	if len(activities) > 1 {
+		series := utils.ChartSeries{Name: "Moving time", Color: "#1976d2"}
+		for _, a := range activities {
+			series.X = append(series.X, float64(a.Timestamp.Unix())/86400)
+			series.Y = append(series.Y, a.MovingTime)
+		}
+		out += utils.LineChartSVG(utils.ChartOptions{
+			Width:   600,
+			Height:  200,
+			XFormat: func(v float64) string { return time.Unix(int64(v*86400), 0).UTC().Format("2006-01-02") },
+			YFormat: utils.FormatDuration,
+		}, series)
+	}
+
+	out += `<table><thead><tr><th>Date</th><th>Moving time</th><th></th></tr></thead><tbody>`
+	for _, a := range activities {
+		out += fmt.Sprintf(`<tr><td><a href="/detail.html?id=%s">%s</a></td><td>%s</td>
+			<td><button hx-post="/api/routes/split?activity_id=%s" hx-target="#route-detail" hx-swap="innerHTML">Split off</button></td></tr>`,
+			html.EscapeString(a.ActivityID), a.Timestamp.Format("2006-01-02"), utils.FormatDuration(a.MovingTime), html.EscapeString(a.ActivityID))
+	}
+	out += `</tbody></table>`
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, out)
+}
+
+// RouteMergeHandler merges route from into route into (POST) and returns the merged
+// route's detail partial.
+func RouteMergeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	into, err1 := strconv.ParseInt(r.FormValue("into"), 10, 64)
+	from, err2 := strconv.ParseInt(r.FormValue("from"), 10, 64)
+	if err1 != nil || err2 != nil || into == from {
+		http.Error(w, "Invalid routes to merge", http.StatusBadRequest)
+		return
+	}
+	a, errA := db.GetRoute(into)
+	b, errB := db.GetRoute(from)
+	if errA != nil || errB != nil || a == nil || b == nil || a.Sport != b.Sport {
+		http.Error(w, "Routes must exist and be of the same sport", http.StatusBadRequest)
+		return
+	}
+	if err := db.MergeRoutes(into, from); err != nil {
+		log.Printf("Error merging route %d into %d: %v", from, into, err)
+		http.Error(w, "Failed to merge routes", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("HX-Trigger", "routesChanged")
+	r.URL.RawQuery = fmt.Sprintf("id=%d", into)
+	RouteDetailHandler(w, r)
+}
+
+// RouteSplitHandler moves the activity ?activity_id= out of its route into a new route
+// of its own (POST), which it keeps until the user merges it elsewhere.
+func RouteSplitHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	activityID := r.URL.Query().Get("activity_id")
+	fp, err := db.GetActivityFingerprint(activityID)
+	if err != nil {
+		log.Printf("Error loading fingerprint of %s: %v", activityID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if fp == nil {
+		http.Error(w, "Activity has no route", http.StatusNotFound)
+		return
+	}
+	var sport string
+	if err := db.DB.QueryRow("SELECT type FROM activities WHERE id = ?", activityID).Scan(&sport); err != nil {
+		log.Printf("Error querying activity %s: %v", activityID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	routeID, err := db.InsertRoute(sport, *fp)
+	if err == nil {
+		err = db.SetActivityRoute(activityID, routeID, *fp, true)
+	}
+	if err != nil {
+		log.Printf("Error splitting %s off its route: %v", activityID, err)
+		http.Error(w, "Failed to split route", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("HX-Trigger", "routesChanged")
+	r.URL.RawQuery = fmt.Sprintf("id=%d", routeID)
+	RouteDetailHandler(w, r)
+}
+
+// renderActivityRoute builds the route line of the activity detail partial.
+func renderActivityRoute(act models.Activity) string {
+	if !features.Routes {
+		return ""
+	}
+	routeID, _, err := db.GetActivityRoute(act.ID)
+	if err != nil {
+		log.Printf("Warning: Failed to load route for %s: %v", act.ID, err)
+		return ""
+	}
+	if routeID == 0 {
+		return ""
+	}
+	route, err := db.GetRoute(routeID)
+	if err != nil || route == nil || route.Count < 2 {
+		return ""
+	}
+	return fmt.Sprintf(`<p><strong>Route:</strong> %s, done %d times (best %s, average %s)</p>`,
+		html.EscapeString(routeName(route.Name, route.ID)), route.Count, utils.FormatDuration(route.Best), utils.FormatDuration(route.Average))
+}
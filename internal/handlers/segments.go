@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// segmentBoundsMargin is how far (degrees, roughly 100 m) outside an activity's bounding
+// box a segment may start and still be considered for matching.
+const segmentBoundsMargin = 0.001
+
+// matchSegment stores the efforts of one activity on one segment. Activities of another
+// sport, or whose track never comes near the segment start, get no efforts. Segments
+// without a path (e.g. from a damaged restore) are skipped.
+func matchSegment(seg models.Segment, act models.Activity, records []models.Record) error {
+	if len(seg.Points) < 2 {
+		return nil
+	}
+	var efforts []utils.SegmentEffort
+	minLat, minLon, maxLat, maxLon, ok := utils.TrackBounds(records)
+	start := seg.Points[0]
+	if ok && act.Type == seg.Sport &&
+		start.Lat >= minLat-segmentBoundsMargin && start.Lat <= maxLat+segmentBoundsMargin &&
+		start.Lon >= minLon-segmentBoundsMargin && start.Lon <= maxLon+segmentBoundsMargin {
+		efforts = utils.MatchSegment(records, seg)
+	}
+	return db.SetSegmentEfforts(seg.ID, act.ID, efforts)
+}
+
+// updateActivitySegments matches an activity against every segment.
+func updateActivitySegments(act models.Activity, records []models.Record) error {
+	segments, err := db.GetSegments()
+	if err != nil {
+		return err
+	}
+	for _, s := range segments {
+		if err := matchSegment(s.Segment, act, records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillSegment matches a segment against every stored activity. It runs in the
+// background after a segment is created and can be restarted from the segments list.
+func backfillSegment(seg models.Segment) {
+	activities, err := db.ListActivities()
+	if err != nil {
+		log.Printf("Error listing activities for segment %d: %v", seg.ID, err)
+		return
+	}
+	matched := 0
+	for _, act := range activities {
+		if act.Type != seg.Sport {
+			continue
+		}
+		records, err := db.GetActivityRecords(act.ID)
+		if err != nil {
+			log.Printf("Error loading records for %s: %v", act.ID, err)
+			continue
+		}
+		utils.EnsureDistance(records)
+		if err := matchSegment(seg, act, records); err != nil {
+			log.Printf("Error matching segment %d on %s: %v", seg.ID, act.ID, err)
+			continue
+		}
+		matched++
+	}
+	log.Printf("Segment %d (%s) matched against %d activities", seg.ID, seg.Name, matched)
+}
+
+// createSegment builds a segment from the ?activity_id track between from_km and to_km
+// (in the user's distance unit) and starts its backfill.
+func createSegment(r *http.Request) (*models.Segment, error) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		return nil, fmt.Errorf("Segment name is required")
+	}
+	activityID := r.FormValue("activity_id")
+	from, err1 := strconv.ParseFloat(r.FormValue("from"), 64)
+	to, err2 := strconv.ParseFloat(r.FormValue("to"), 64)
+	if err1 != nil || err2 != nil || from < 0 || to <= from {
+		return nil, fmt.Errorf("Invalid range: from must be less than to")
+	}
+	var sport string
+	if err := db.DB.QueryRow("SELECT type FROM activities WHERE id = ?", activityID).Scan(&sport); err != nil {
+		return nil, fmt.Errorf("Activity not found")
+	}
+	records, err := db.GetActivityRecords(activityID)
+	if err != nil {
+		return nil, err
+	}
+	utils.EnsureDistance(records)
+	unitLength := utils.UnitLength(getUnits())
+	points, length := utils.SegmentPath(records, from*unitLength, to*unitLength)
+	if len(points) < 2 {
+		return nil, fmt.Errorf("The selected range has no GPS track")
+	}
+
+	seg := models.Segment{
+		Name:             name,
+		Sport:            sport,
+		Points:           points,
+		Length:           length,
+		SourceActivityID: activityID,
+		CreatedAt:        time.Now().UTC(),
+	}
+	if seg.ID, err = db.InsertSegment(seg); err != nil {
+		return nil, err
+	}
+	go backfillSegment(seg)
+	return &seg, nil
+}
+
+// SegmentsHandler lists segments (GET), creates one from a stretch of an activity (POST
+// with activity_id, name, from and to) or deletes one (DELETE ?id=), returning the
+// segment list as an HTML partial.
+func SegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		seg, err := createSegment(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// The backfill runs in the background; the segment's own activity matches first
+		log.Printf("Created segment %d (%s), %.0f m", seg.ID, seg.Name, seg.Length)
+		w.Header().Set("HX-Trigger", "segmentsChanged")
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<p>Segment %s created; matching past activities in the background.</p>", html.EscapeString(seg.Name))
+		return
+	case http.MethodDelete:
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+			return
+		}
+		if _, err := db.DeleteSegment(id); err != nil {
+			log.Printf("Error deleting segment %d: %v", id, err)
+			http.Error(w, "Failed to delete segment", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	segments, err := db.GetSegments()
+	if err != nil {
+		log.Printf("Error loading segments: %v", err)
+		http.Error(w, "Failed to load segments", http.StatusInternalServerError)
+		return
+	}
+	units := getUnits()
+	var out string
+	if len(segments) == 0 {
+		out = "<p>No segments yet. Create one from an activity's detail page.</p>"
+	} else {
+		out = `<table><thead><tr><th>Segment</th><th>Sport</th><th>Length</th><th>Efforts</th><th>Best</th><th></th></tr></thead><tbody>`
+		for _, s := range segments {
+			best := "-"
+			if s.Efforts > 0 {
+				best = utils.FormatDuration(s.Best)
+			}
+			out += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%s</td>
+				<td><button hx-get="/api/segments/leaderboard?id=%d" hx-target="#segment-leaderboard" hx-swap="innerHTML">Leaderboard</button>
+				<button hx-post="/api/segments/backfill?id=%d" hx-target="#segment-leaderboard" hx-swap="innerHTML">Rematch</button>
+				<button hx-delete="/api/segments?id=%d" hx-confirm="Delete this segment?" hx-target="#segments" hx-swap="innerHTML">Delete</button></td></tr>`,
+				html.EscapeString(s.Name), html.EscapeString(s.Sport), utils.FormatDistance(s.Length, units), s.Efforts, best, s.ID, s.ID, s.ID)
+		}
+		out += `</tbody></table>`
+	}
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, out)
+}
+
+// SegmentBackfillHandler re-matches the segment ?id= against every stored activity in
+// the background (POST).
+func SegmentBackfillHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return
+	}
+	seg, err := db.GetSegment(id)
+	if err != nil {
+		log.Printf("Error loading segment %d: %v", id, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if seg == nil {
+		http.Error(w, "Segment not found", http.StatusNotFound)
+		return
+	}
+	go backfillSegment(*seg)
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, "<p>Rematching %s against all activities in the background.</p>", html.EscapeString(seg.Name))
+}
+
+// SegmentLeaderboardHandler returns the personal leaderboard of the segment ?id= as an
+// HTML partial.
+func SegmentLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return
+	}
+	seg, err := db.GetSegment(id)
+	if err != nil {
+		log.Printf("Error loading segment %d: %v", id, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if seg == nil {
+		http.Error(w, "Segment not found", http.StatusNotFound)
+		return
+	}
+	efforts, err := db.GetSegmentLeaderboard(id)
+	if err != nil {
+		log.Printf("Error loading leaderboard for segment %d: %v", id, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	units := getUnits()
+	out := fmt.Sprintf(`<h3>%s</h3>`, html.EscapeString(seg.Name))
+	if len(efforts) == 0 {
+		out += "<p>No efforts yet.</p>"
+	} else {
+		out += `<table class="leaderboard"><thead><tr><th>#</th><th>Date</th><th>Time</th><th>Avg</th></tr></thead><tbody>`
+		for _, e := range efforts {
+			avg := 0.0
+			if e.Elapsed > 0 {
+				avg = seg.Length / e.Elapsed
+			}
+			out += fmt.Sprintf(`<tr><td>%d</td><td><a href="/detail.html?id=%s">%s</a></td><td>%s</td><td>%s</td></tr>`,
+				e.Rank, html.EscapeString(e.ActivityID), e.Timestamp.Format("2006-01-02"), utils.FormatDuration(e.Elapsed),
+				utils.FormatSpeedOrPace(avg, seg.Sport, units))
+		}
+		out += `</tbody></table>`
+	}
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, out)
+}
+
+// renderActivitySegments builds the segments section of the activity detail partial:
+// the activity's efforts with their rank, and a form to create a segment from its track.
+func renderActivitySegments(act models.Activity, units string) string {
+	if !features.Segments {
+		return ""
+	}
+	efforts, err := db.GetActivitySegmentEfforts(act.ID)
+	if err != nil {
+		log.Printf("Warning: Failed to load segment efforts for %s: %v", act.ID, err)
+	}
+	out := `<h3>Segments</h3>`
+	if len(efforts) > 0 {
+		out += `<table class="segments"><thead><tr><th>Segment</th><th>Time</th><th>Starts at</th><th>Rank</th></tr></thead><tbody>`
+		for _, e := range efforts {
+			badge := ""
+			if e.Rank == 1 {
+				badge = `<span class="badge">PR</span>`
+			}
+			out += fmt.Sprintf(`<tr><td>%s</td><td>%s</td><td>%s</td><td>%d %s</td></tr>`,
+				html.EscapeString(e.SegmentName), utils.FormatDuration(e.Elapsed), utils.FormatDuration(e.Start), e.Rank, badge)
+		}
+		out += `</tbody></table>`
+	}
+	label := utils.DistanceLabel(units)
+	out += fmt.Sprintf(`<form hx-post="/api/segments" hx-target="#segment-created" hx-swap="innerHTML">
+		<input type="hidden" name="activity_id" value="%s">
+		<label>Name <input type="text" name="name" required></label>
+		<label>From (%s) <input type="number" name="from" step="0.01" min="0" required></label>
+		<label>To (%s) <input type="number" name="to" step="0.01" min="0" required></label>
+		<button type="submit">Create segment</button>
+	</form><div id="segment-created"></div>`, html.EscapeString(act.ID), label, label)
+	return out
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// getUnits returns the user's unit system preference, defaulting to the configured one.
+func getUnits() string {
+	units, err := db.GetSetting("units", defaultUnits)
+	if err != nil {
+		log.Printf("Error reading units setting: %v", err)
+	}
+	if !utils.ValidUnits(units) {
+		return defaultUnits
+	}
+	return units
+}
+
+// Elevation source preferences: which ascent total the dashboard shows.
+const (
+	ElevationDevice   = "device"
+	ElevationComputed = "computed"
+)
+
+// getElevationSource returns whether the user prefers device-reported or recomputed
+// ascent, defaulting to the device value (which falls back to ours when missing).
+func getElevationSource() string {
+	source, err := db.GetSetting("elevation_source", ElevationDevice)
+	if err != nil {
+		log.Printf("Error reading elevation source setting: %v", err)
+	}
+	if source != ElevationComputed {
+		return ElevationDevice
+	}
+	return source
+}
+
+// SettingsHandler shows (GET) and saves (POST) user preferences as an HTML form partial for HTMX.
+func SettingsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		units := r.FormValue("units")
+		if !utils.ValidUnits(units) {
+			http.Error(w, "Invalid units: must be metric or imperial", http.StatusBadRequest)
+			return
+		}
+		source := r.FormValue("elevation_source")
+		if source == "" {
+			source = ElevationDevice
+		}
+		if source != ElevationDevice && source != ElevationComputed {
+			http.Error(w, "Invalid elevation source: must be device or computed", http.StatusBadRequest)
+			return
+		}
+		if err := db.SetSetting("units", units); err != nil {
+			log.Printf("Error saving settings: %v", err)
+			http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+			return
+		}
+		if err := db.SetSetting("elevation_source", source); err != nil {
+			log.Printf("Error saving settings: %v", err)
+			http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+			return
+		}
+		// Let the dashboard reload anything that depends on the preferences
+		w.Header().Set("HX-Trigger", "settingsChanged")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	units := getUnits()
+	source := getElevationSource()
+	selected := func(v string) string {
+		if v == units || v == source {
+			return " selected"
+		}
+		return ""
+	}
+	html := fmt.Sprintf(`<form hx-post="/api/settings" hx-target="#settings" hx-swap="innerHTML" hx-trigger="change">
+		<label for="units">Units:</label>
+		<select id="units" name="units">
+			<option value="%s"%s>Metric (km)</option>
+			<option value="%s"%s>Imperial (mi)</option>
+		</select>
+		<label for="elevation_source">Ascent:</label>
+		<select id="elevation_source" name="elevation_source">
+			<option value="%s"%s>Device-reported</option>
+			<option value="%s"%s>Recomputed</option>
+		</select>
+	</form>`, utils.UnitsMetric, selected(utils.UnitsMetric), utils.UnitsImperial, selected(utils.UnitsImperial),
+		ElevationDevice, selected(ElevationDevice), ElevationComputed, selected(ElevationComputed))
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, html)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// SplitsHandler handles GET requests to /api/activity/splits?id=<uuid> and returns
+// the automatic km/mile splits as JSON, in the user's preferred unit system.
+func SplitsHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing ID parameter", http.StatusBadRequest)
+		return
+	}
+
+	var sport string
+	if err := db.DB.QueryRow("SELECT type FROM activities WHERE id = ?", id).Scan(&sport); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Activity not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error querying activity %s: %v", id, err)
+		return
+	}
+	records, err := db.GetActivityRecords(id)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error loading records for %s: %v", id, err)
+		return
+	}
+
+	units := getUnits()
+	utils.EnsureDistance(records)
+	splits := utils.ComputeSplits(records, sport, utils.UnitLength(units))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"units":  units,
+		"splits": splits,
+	})
+}
+
+// renderSplitTable builds the HTML split table for the activity detail partial.
+func renderSplitTable(splits []utils.Split, units string) string {
+	if len(splits) == 0 {
+		return ""
+	}
+	label := utils.DistanceLabel(units)
+	unitLength := utils.UnitLength(units)
+	html := fmt.Sprintf(`<h3>Splits</h3>
+		<table class="splits">
+			<thead><tr><th>%s</th><th>Time</th><th>Pace (/%s)</th><th>GAP (/%s)</th><th>Elev (m)</th><th>Avg HR</th></tr></thead>
+			<tbody>`, label, label, label)
+	for _, s := range splits {
+		name := fmt.Sprintf("%d", s.Index)
+		if s.Distance < unitLength*0.99 {
+			name = fmt.Sprintf("%.2f", float64(s.Index-1)+s.Distance/unitLength)
+		}
+		hr := "-"
+		if s.AvgHeartRate > 0 {
+			hr = fmt.Sprintf("%.0f", s.AvgHeartRate)
+		}
+		html += fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%+.0f</td><td>%s</td></tr>",
+			name, utils.FormatDuration(s.Time), utils.FormatPace(s.Pace), utils.FormatPace(s.GAP), s.ElevationChange, hr)
+	}
+	html += `</tbody>
+		</table>`
+	return html
+}
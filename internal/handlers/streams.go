@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// buildStreams turns the record stream into per-sample arrays for charts and analysis.
+// Sensor channels the activity never recorded are left out.
+func buildStreams(records []models.Record) map[string]any {
+	n := len(records)
+	timeOffsets := make([]float64, n)
+	distance := make([]float64, n)
+	// int slices: []uint8 would be JSON-encoded as base64
+	heartRate := make([]int, n)
+	cadence := make([]int, n)
+	power := make([]int, n)
+	var hasHR, hasCadence, hasPower bool
+	for i, r := range records {
+		timeOffsets[i] = r.Time.Sub(records[0].Time).Seconds()
+		distance[i] = r.Distance
+		heartRate[i], cadence[i], power[i] = int(r.HeartRate), int(r.Cadence), int(r.Power)
+		hasHR = hasHR || r.HeartRate > 0
+		hasCadence = hasCadence || r.Cadence > 0
+		hasPower = hasPower || r.Power > 0
+	}
+
+	streams := map[string]any{
+		"time":     timeOffsets, // seconds from start
+		"distance": distance,    // meters
+		"speed":    utils.SpeedStream(records),
+		"grade":    utils.GradeStream(records),
+		"gap":      utils.GAPStream(records), // grade-adjusted speed, m/s
+	}
+	if alt := utils.SmoothAltitude(records); alt != nil {
+		streams["altitude"] = alt
+	}
+	if hasHR {
+		streams["heartrate"] = heartRate
+	}
+	if hasCadence {
+		streams["cadence"] = cadence
+	}
+	if hasPower {
+		streams["power"] = power
+	}
+	return streams
+}
+
+// StreamsHandler handles GET /api/activity/streams?id=<uuid> and returns the activity's
+// data streams (time, distance, smoothed altitude, grade, speed, GAP and sensors) as JSON.
+func StreamsHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing ID parameter", http.StatusBadRequest)
+		return
+	}
+	records, err := db.GetActivityRecords(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Activity not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Printf("Error loading records for %s: %v", id, err)
+		return
+	}
+	utils.EnsureDistance(records)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildStreams(records))
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// renderThumbnail renders the route thumbnail of an activity over the local base map
+// when one is configured. Thumbnails show up wherever activities are listed, so they are
+// drawn from the track with the privacy zones trimmed; a trimmed track gets no start and
+// end markers, which would point at the zone edge.
+func renderThumbnail(records []models.Record) ([]byte, error) {
+	parts, err := publicTrack(records)
+	if err != nil {
+		return nil, err
+	}
+	untrimmed := len(parts) == 1 && len(parts[0]) == len(records)
+	return utils.RenderThumbnail(parts, untrimmed, tileSource)
+}
+
+// updateActivityThumbnail renders and stores the route thumbnail of an activity, or
+// that it has none.
+func updateActivityThumbnail(act models.Activity, records []models.Record) error {
+	img, err := renderThumbnail(records)
+	if err != nil {
+		return err
+	}
+	return db.SetActivityThumbnail(act.ID, img)
+}
+
+// ThumbnailHandler serves GET /api/activities/{id}/thumbnail.png. Activities imported
+// before thumbnails existed get theirs rendered on first request.
+func ThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	img, stored, err := db.GetActivityThumbnail(id)
+	if err != nil {
+		log.Printf("Error loading thumbnail for %s: %v", id, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !stored {
+		records, err := db.GetActivityRecords(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Activity not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error loading records for %s: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if img, err = renderThumbnail(records); err != nil {
+			log.Printf("Error rendering thumbnail for %s: %v", id, err)
+			http.Error(w, "Failed to render thumbnail", http.StatusInternalServerError)
+			return
+		}
+		if err := db.SetActivityThumbnail(id, img); err != nil {
+			log.Printf("Warning: Failed to store thumbnail for %s: %v", id, err)
+		}
+	}
+	w.Header().Set("Cache-Control", "max-age=3600")
+	if len(img) == 0 {
+		http.Error(w, "Activity has no track", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(img)
+}
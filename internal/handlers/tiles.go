@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// osmTileURL and osmAttribution are the online base map used when no local tiles are
+// configured.
+const (
+	osmTileURL     = "https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png"
+	osmAttribution = `&copy; <a href="https://www.openstreetmap.org/copyright">OpenStreetMap</a> contributors`
+)
+
+// tileSource is the local base map; nil when not configured.
+var tileSource utils.TileSource
+
+// SetTileFile serves base map tiles from a local .mbtiles or .pmtiles file.
+func SetTileFile(path string) error {
+	var src utils.TileSource
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mbtiles":
+		src, err = db.OpenMBTiles(path)
+	case ".pmtiles":
+		src, err = utils.OpenPMTiles(path)
+	default:
+		return fmt.Errorf("%s: tile file must be .mbtiles or .pmtiles", path)
+	}
+	if err != nil {
+		return err
+	}
+	tileSource = src
+	return nil
+}
+
+// TileHandler serves GET /tiles/{z}/{x}/{y} (an extension on y is ignored) from the
+// local tile file.
+func TileHandler(w http.ResponseWriter, r *http.Request) {
+	if tileSource == nil {
+		http.Error(w, "No local tiles configured", http.StatusNotFound)
+		return
+	}
+	y := r.PathValue("y")
+	if i := strings.IndexByte(y, '.'); i >= 0 {
+		y = y[:i]
+	}
+	zi, errZ := strconv.Atoi(r.PathValue("z"))
+	xi, errX := strconv.Atoi(r.PathValue("x"))
+	yi, errY := strconv.Atoi(y)
+	if errZ != nil || errX != nil || errY != nil || zi < 0 || zi > 30 || xi < 0 || yi < 0 || xi >= 1<<zi || yi >= 1<<zi {
+		http.Error(w, "Invalid tile coordinates", http.StatusBadRequest)
+		return
+	}
+
+	data, err := tileSource.Tile(zi, xi, yi)
+	if err != nil {
+		log.Printf("Error reading tile %d/%d/%d: %v", zi, xi, yi, err)
+		http.Error(w, "Failed to read tile", http.StatusInternalServerError)
+		return
+	}
+	if data == nil {
+		http.Error(w, "Tile not found", http.StatusNotFound)
+		return
+	}
+	info := tileSource.Info()
+	w.Header().Set("Content-Type", info.ContentType())
+	if info.Gzipped {
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.Write(data)
+}
+
+// MapConfigHandler returns the base map the frontend should use as JSON: the local
+// tiles when a raster tile file is configured, otherwise OpenStreetMap, or no base map
+// (an empty url) when online maps are switched off.
+func MapConfigHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := map[string]any{
+		"local":       false,
+		"url":         osmTileURL,
+		"attribution": osmAttribution,
+		"maxZoom":     19,
+	}
+	if !features.OnlineMaps {
+		cfg["url"] = ""
+		cfg["attribution"] = ""
+	}
+	if tileSource != nil {
+		info := tileSource.Info()
+		cfg["tiles"] = info
+		// Vector tiles need a renderer the pages don't ship; they stay available to
+		// external clients under /tiles
+		if info.Raster() {
+			cfg["local"] = true
+			cfg["url"] = "/tiles/{z}/{x}/{y}." + info.Format
+			cfg["attribution"] = info.Attribution
+			cfg["minZoom"] = info.MinZoom
+			cfg["maxZoom"] = info.MaxZoom
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg)
+}
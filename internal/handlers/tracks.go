@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// trackMaxZoom is the zoom reported as the upper end of the finest simplification level.
+const trackMaxZoom = 30
+
+// simplifyTracks simplifies a track at every level of utils.SimplifyLevels. Activities
+// without a drawable track get empty levels (no points), so the absence is stored too and
+// isn't recomputed on every request.
+func simplifyTracks(records []models.Record) []db.SimplifiedTrack {
+	points := utils.TrackPoints(records)
+	if len(points) < 2 {
+		points = nil
+	}
+	tracks := make([]db.SimplifiedTrack, len(utils.SimplifyLevels))
+	for i, l := range utils.SimplifyLevels {
+		simplified := utils.SimplifyTrack(points, l.Tolerance)
+		tracks[i] = db.SimplifiedTrack{Level: i, Tolerance: l.Tolerance, Points: len(simplified), Polyline: utils.EncodePolyline(simplified)}
+	}
+	return tracks
+}
+
+// updateActivityTracks stores the simplified tracks an activity's maps are drawn from.
+func updateActivityTracks(act models.Activity, records []models.Record) error {
+	return db.SetActivityTracks(act.ID, simplifyTracks(records))
+}
+
+// TrackHandler serves GET /api/activities/{id}/track?zoom=: the activity's full track
+// for its owner, see serveTrack.
+func TrackHandler(w http.ResponseWriter, r *http.Request) {
+	serveTrack(w, r, r.PathValue("id"), false)
+}
+
+// SharedTrackHandler serves GET /api/share/{token}/track?zoom=: the track of a shared
+// activity, always with the privacy zones trimmed.
+func SharedTrackHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := db.GetSharedActivityID(r.PathValue("token"))
+	if err != nil {
+		log.Printf("Error resolving share token: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if id == "" {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return
+	}
+	serveTrack(w, r, id, true)
+}
+
+// serveTrack writes an activity's track simplified for a map at ?zoom=, as JSON encoded
+// polylines (default) or as a GeoJSON feature with ?format=geojson. Public tracks have
+// the privacy zones trimmed, which can split them into several parts. Activities
+// imported before simplification existed get their tracks built on first request.
+func serveTrack(w http.ResponseWriter, r *http.Request, id string, public bool) {
+	q := r.URL.Query()
+	zoom, err := strconv.Atoi(q.Get("zoom"))
+	if err != nil && q.Get("zoom") != "" {
+		http.Error(w, "Invalid zoom parameter", http.StatusBadRequest)
+		return
+	}
+	level := utils.SimplifyLevelFor(zoom)
+	tolerance := utils.SimplifyLevels[level].Tolerance
+
+	var parts [][]models.LatLon
+	var points int
+	stored, err := db.GetActivityTrack(id, level)
+	if err != nil {
+		log.Printf("Error loading track for %s: %v", id, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if stored != nil && stored.Tolerance == tolerance && !public {
+		if stored.Points >= 2 {
+			parts, points = [][]models.LatLon{utils.DecodePolyline(stored.Polyline)}, stored.Points
+		}
+	} else {
+		act, err := db.GetActivityByID(id)
+		if err == nil && act == nil {
+			http.Error(w, "Activity not found", http.StatusNotFound)
+			return
+		}
+		var records []models.Record
+		if err == nil {
+			records, err = db.GetActivityRecords(id)
+		}
+		if err != nil {
+			log.Printf("Error loading records for %s: %v", id, err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if public {
+			visible, err := publicTrack(records)
+			if err != nil {
+				log.Printf("Error trimming privacy zones for %s: %v", id, err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			for _, part := range visible {
+				if simplified := utils.SimplifyTrack(utils.TrackPoints(part), tolerance); len(simplified) >= 2 {
+					parts = append(parts, simplified)
+					points += len(simplified)
+				}
+			}
+		} else {
+			if err := updateActivityTracks(*act, records); err != nil {
+				log.Printf("Warning: Failed to store tracks for %s: %v", id, err)
+			}
+			if simplified := utils.SimplifyTrack(utils.TrackPoints(records), tolerance); len(simplified) >= 2 {
+				parts, points = [][]models.LatLon{simplified}, len(simplified)
+			}
+		}
+	}
+
+	minZoom, maxZoom := 0, utils.SimplifyLevels[level].MaxZoom
+	if level > 0 {
+		minZoom = utils.SimplifyLevels[level-1].MaxZoom + 1
+	}
+	if level == len(utils.SimplifyLevels)-1 {
+		maxZoom = trackMaxZoom
+	}
+
+	if q.Get("format") == "geojson" {
+		coords := make([][][2]float64, len(parts))
+		for i, part := range parts {
+			for _, p := range part {
+				coords[i] = append(coords[i], [2]float64{p.Lon, p.Lat})
+			}
+		}
+		var geometry map[string]any
+		if len(coords) == 1 {
+			geometry = map[string]any{"type": "LineString", "coordinates": coords[0]}
+		} else {
+			geometry = map[string]any{"type": "MultiLineString", "coordinates": coords}
+		}
+		w.Header().Set("Content-Type", "application/geo+json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"type":     "Feature",
+			"geometry": geometry,
+			"properties": map[string]any{
+				"tolerance": tolerance,
+				"points":    points,
+				"minZoom":   minZoom,
+				"maxZoom":   maxZoom,
+			},
+		})
+		return
+	}
+
+	encoded := make([]string, len(parts))
+	for i, part := range parts {
+		encoded[i] = utils.EncodePolyline(part)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"parts":     encoded,
+		"tolerance": tolerance,
+		"points":    points,
+		"minZoom":   minZoom,
+		"maxZoom":   maxZoom,
+	})
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gratten/ownpath/internal/db"
+	"github.com/gratten/ownpath/internal/models"
+	"github.com/gratten/ownpath/internal/utils"
+)
+
+// zoneWeeks is how many weeks the dashboard's time-in-zone summary covers.
+const zoneWeeks = 12
+
+// updateActivityZones recomputes and stores an activity's time-in-zone using the
+// heart-rate profile that was in effect on the activity's date.
+func updateActivityZones(id string, timestamp time.Time, records []models.Record) error {
+	profile, err := db.GetHRProfileAt(timestamp)
+	if err != nil {
+		return err
+	}
+	if profile == nil || !utils.HasHeartRate(records) {
+		return db.SetActivityZones(id, nil)
+	}
+	return db.SetActivityZones(id, utils.TimeInZones(records, utils.HRZones(*profile)))
+}
+
+// zonesJob recomputes every activity's zones after the heart-rate profile history
+// changes, so saving a profile doesn't wait for the whole history.
+var zonesJob = newBackgroundJob("recomputing zones", recomputeAllZones)
+
+// StartZonesWorker runs the zone recomputes the profile form queues.
+func StartZonesWorker() {
+	zonesJob.Start()
+}
+
+// recomputeAllZones refreshes time-in-zone and training load for every activity,
+// e.g. after the heart-rate profile history changed.
+func recomputeAllZones() error {
+	activities, err := db.ListActivities()
+	if err != nil {
+		return err
+	}
+	for _, act := range activities {
+		records, err := db.GetActivityRecords(act.ID)
+		if err != nil {
+			log.Printf("Error loading records for %s: %v", act.ID, err)
+			continue
+		}
+		if err := updateActivityZones(act.ID, act.Timestamp, records); err != nil {
+			log.Printf("Error updating zones for %s: %v", act.ID, err)
+		}
+		// hrTSS and TRIMP depend on the heart-rate profile too
+		if err := updateActivityLoad(act.ID, act.Timestamp, records); err != nil {
+			log.Printf("Error updating load for %s: %v", act.ID, err)
+		}
+	}
+	// Rebuilt here rather than triggered, so the chart is current when the panels reload
+	return recomputeTrainingLoad()
+}
+
+// HRProfilesHandler shows (GET) and extends (POST) the heart-rate profile history as an
+// HTML partial. Adding a profile recomputes time-in-zone for all activities in the background.
+func HRProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	var msg string
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		profile, err := parseHRProfile(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := db.InsertHRProfile(profile); err != nil {
+			log.Printf("Error saving hr profile: %v", err)
+			http.Error(w, "Failed to save heart-rate profile", http.StatusInternalServerError)
+			return
+		}
+		zonesJob.Trigger()
+		msg = "<p>Profile saved.</p>"
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	profiles, err := db.GetHRProfiles()
+	if err != nil {
+		log.Printf("Error loading hr profiles: %v", err)
+		http.Error(w, "Failed to load heart-rate profiles", http.StatusInternalServerError)
+		return
+	}
+
+	out := `<form hx-post="/api/hr-profiles" hx-target="#hr-profiles" hx-swap="innerHTML">
+		<label>From <input type="date" name="effective_from" required></label>
+		<label>Max HR <input type="number" name="max_hr" min="100" max="250" required></label>
+		<label>Resting HR <input type="number" name="resting_hr" min="25" max="120" value="60"></label>
+		<label>LTHR <input type="number" name="lthr" min="80" max="230"></label>
+		<select name="model">
+			<option value="max">% of max HR</option>
+			<option value="hrr">% of HR reserve</option>
+			<option value="lthr">% of LTHR (Friel)</option>
+		</select>
+		<button type="submit">Add profile</button>
+	</form>` + msg + jobProgress(w, r, zonesJob, "/api/hr-profiles", "#hr-profiles", "Recomputing the zones of past activities…", "zonesChanged")
+	if len(profiles) == 0 {
+		out += "<p>No heart-rate profile yet; zones are not computed.</p>"
+	} else {
+		out += `<table><thead><tr><th>From</th><th>Max</th><th>Resting</th><th>LTHR</th><th>Model</th><th>Zones</th></tr></thead><tbody>`
+		for _, p := range profiles {
+			zones := ""
+			for _, z := range utils.HRZones(p) {
+				zones += fmt.Sprintf("%s %d+ ", z.Name, z.Min)
+			}
+			out += fmt.Sprintf("<tr><td>%s</td><td>%d</td><td>%d</td><td>%d</td><td>%s</td><td>%s</td></tr>",
+				p.EffectiveFrom.Format("2006-01-02"), p.MaxHR, p.RestingHR, p.LTHR, html.EscapeString(p.Model), zones)
+		}
+		out += `</tbody></table>`
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, out)
+}
+
+// parseHRProfile validates the heart-rate profile form.
+func parseHRProfile(r *http.Request) (models.HRProfile, error) {
+	var p models.HRProfile
+	from, err := time.Parse("2006-01-02", r.FormValue("effective_from"))
+	if err != nil {
+		return p, fmt.Errorf("invalid effective_from date: %w", err)
+	}
+	p.EffectiveFrom = from.UTC()
+	p.MaxHR, _ = strconv.Atoi(r.FormValue("max_hr"))
+	p.RestingHR, _ = strconv.Atoi(r.FormValue("resting_hr"))
+	p.LTHR, _ = strconv.Atoi(r.FormValue("lthr"))
+	p.Model = r.FormValue("model")
+
+	switch p.Model {
+	case models.ZoneModelMax:
+	case models.ZoneModelHRR:
+		if p.RestingHR <= 0 || p.RestingHR >= p.MaxHR {
+			return p, fmt.Errorf("resting HR must be between 0 and max HR for the HR reserve model")
+		}
+	case models.ZoneModelLTHR:
+		if p.LTHR <= 0 {
+			return p, fmt.Errorf("LTHR is required for the LTHR model")
+		}
+	default:
+		return p, fmt.Errorf("invalid zone model %q", p.Model)
+	}
+	if p.MaxHR <= 0 {
+		return p, fmt.Errorf("max HR is required")
+	}
+	return p, nil
+}
+
+// renderZoneBar draws a horizontal stacked bar of time-in-zone.
+func renderZoneBar(names []string, seconds []float64) string {
+	var total float64
+	for _, s := range seconds {
+		total += s
+	}
+	if total == 0 {
+		return ""
+	}
+	out := `<div class="zone-bar">`
+	for i, s := range seconds {
+		if s == 0 {
+			continue
+		}
+		name := fmt.Sprintf("Z%d", i+1)
+		if i < len(names) {
+			name = names[i]
+		}
+		pct := s / total * 100
+		out += fmt.Sprintf(`<div class="zone zone-%d" style="width: %.2f%%" title="%s: %s (%.0f%%)">%s</div>`,
+			i+1, pct, name, utils.FormatDuration(s), pct, name)
+	}
+	return out + `</div>`
+}
+
+// renderActivityZones builds the time-in-zone section of the activity detail partial.
+func renderActivityZones(act models.Activity) string {
+	seconds, err := db.GetActivityZones(act.ID)
+	if err != nil {
+		log.Printf("Warning: Failed to load zones for %s: %v", act.ID, err)
+		return ""
+	}
+	if len(seconds) == 0 {
+		return ""
+	}
+	var names []string
+	if profile, err := db.GetHRProfileAt(act.Timestamp); err == nil && profile != nil {
+		for _, z := range utils.HRZones(*profile) {
+			names = append(names, z.Name)
+		}
+	}
+	out := `<h3>Heart-Rate Zones</h3>` + renderZoneBar(names, seconds) + `<ul class="zone-legend">`
+	for i, s := range seconds {
+		name := fmt.Sprintf("Z%d", i+1)
+		if i < len(names) {
+			name = names[i]
+		}
+		out += fmt.Sprintf("<li>%s: %s</li>", name, utils.FormatDuration(s))
+	}
+	return out + `</ul>`
+}
+
+// WeeklyZonesHandler returns an HTML partial (table rows) of time-in-zone per week for the dashboard.
+func WeeklyZonesHandler(w http.ResponseWriter, r *http.Request) {
+	weeks, err := db.GetWeeklyZones(zoneWeeks)
+	if err != nil {
+		log.Printf("Error loading weekly zones: %v", err)
+		http.Error(w, "<tr><td colspan='3'>Error loading zones</td></tr>", http.StatusInternalServerError)
+		return
+	}
+
+	var out string
+	if len(weeks) == 0 {
+		out = "<tr><td colspan='3'>No heart-rate data yet</td></tr>"
+	}
+	for _, wk := range weeks {
+		var total float64
+		for _, s := range wk.Seconds {
+			total += s
+		}
+		out += fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%s</td></tr>",
+			wk.WeekStart, renderZoneBar(nil, wk.Seconds), utils.FormatDuration(total))
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, out)
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// FTPEntry is the athlete's functional threshold power valid from EffectiveFrom until
+// the next entry, so rides are scored against the FTP of their date.
+type FTPEntry struct {
+	ID            int64     `json:"id"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	FTP           int       `json:"ftp"` // watts
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Heart-rate zone models.
+const (
+	ZoneModelMax  = "max"  // percentage of max HR
+	ZoneModelHRR  = "hrr"  // percentage of heart-rate reserve (Karvonen)
+	ZoneModelLTHR = "lthr" // percentage of lactate threshold HR (Friel)
+)
+
+// HRProfile is the athlete's heart-rate profile valid from EffectiveFrom until the
+// next profile. Keeping the history lets past activities use the zones of their date.
+type HRProfile struct {
+	ID            int64     `json:"id"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	MaxHR         int       `json:"max_hr"`
+	RestingHR     int       `json:"resting_hr"`
+	LTHR          int       `json:"lthr"`
+	Model         string    `json:"model"`
+}
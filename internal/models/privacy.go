@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// PrivacyZone is a circle, e.g. around home, whose track points are hidden from maps,
+// exports and public views. The owner's private views still show them.
+type PrivacyZone struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Lat       float64   `json:"lat"`
+	Lon       float64   `json:"lon"`
+	Radius    float64   `json:"radius"` // meters
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Record is a single sample from an activity's data stream (one FIT Record message).
+// Zero values mean the sensor did not report that channel; Altitude and Temperature
+// are pointers because zero is a legitimate reading for them. DEMAltitude is filled by
+// the optional offline elevation correction and never replaces the device Altitude.
+type Record struct {
+	Time        time.Time `json:"time"`
+	Lat         float64   `json:"lat,omitempty"`     // degrees
+	Lon         float64   `json:"lon,omitempty"`     // degrees
+	Altitude    *float64  `json:"alt,omitempty"`     // meters
+	DEMAltitude *float64  `json:"demAlt,omitempty"`  // meters, terrain model correction
+	Distance    float64   `json:"dist,omitempty"`    // cumulative meters
+	Speed       float64   `json:"speed,omitempty"`   // m/s
+	HeartRate   uint8     `json:"hr,omitempty"`      // bpm
+	Cadence     uint8     `json:"cadence,omitempty"` // rpm (spm / 2 for running)
+	Power       uint16    `json:"power,omitempty"`   // watts
+	Temperature *int8     `json:"temp,omitempty"`    // degrees C
+}
+
+// HasPosition reports whether the record carries a GPS fix.
+func (r Record) HasPosition() bool {
+	return r.Lat != 0 || r.Lon != 0
+}
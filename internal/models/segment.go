@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// LatLon is a point of a stored path.
+type LatLon struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Segment is a user-defined stretch of road or trail that activities are matched
+// against. Its path is taken from the activity it was created from.
+type Segment struct {
+	ID               int64     `json:"id"`
+	Name             string    `json:"name"`
+	Sport            string    `json:"sport"`
+	Points           []LatLon  `json:"points"`
+	Length           float64   `json:"length"` // meters
+	SourceActivityID string    `json:"source_activity_id"`
+	CreatedAt        time.Time `json:"created_at"`
+}
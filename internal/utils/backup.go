@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot files are named ownpath-YYYYMMDD-HHMMSS.NNNNNNNNN.db after the (UTC) time they
+// were taken, to the nanosecond so a restore's safety snapshot never collides with a
+// backup taken the same second. Older snapshots have no fraction.
+const (
+	snapshotPrefix = "ownpath-"
+	snapshotLayout = "20060102-150405.000000000"
+	snapshotExt    = ".db"
+)
+
+// SnapshotName returns the file name of a snapshot taken at t.
+func SnapshotName(t time.Time) string {
+	return snapshotPrefix + t.UTC().Format(snapshotLayout) + snapshotExt
+}
+
+// ParseSnapshotName returns when a snapshot was taken from its file name, with or without
+// the fraction of a second; ok is false for files that aren't snapshots.
+func ParseSnapshotName(name string) (t time.Time, ok bool) {
+	if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotExt) {
+		return time.Time{}, false
+	}
+	// Parsing accepts a fraction after the seconds even though the layout has none
+	t, err := time.Parse("20060102-150405", strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotExt))
+	return t, err == nil
+}
+
+// SnapshotsToKeep applies the rotation policy to the times snapshots were taken: the
+// newest snapshot of each of the last daily days that have one, and the newest of each
+// of the last weekly ISO weeks that have one. It returns the times to keep; the newest
+// snapshot is always kept.
+func SnapshotsToKeep(times []time.Time, daily, weekly int) map[time.Time]bool {
+	sorted := append([]time.Time(nil), times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].After(sorted[j]) })
+
+	keep := map[time.Time]bool{}
+	if len(sorted) > 0 {
+		keep[sorted[0]] = true
+	}
+	days := map[string]bool{}
+	weeks := map[[2]int]bool{}
+	for _, t := range sorted {
+		day := t.UTC().Format("2006-01-02")
+		if !days[day] && len(days) < daily {
+			days[day] = true
+			keep[t] = true
+		}
+		y, w := t.UTC().ISOWeek()
+		if week := [2]int{y, w}; !weeks[week] && len(weeks) < weekly {
+			weeks[week] = true
+			keep[t] = true
+		}
+	}
+	return keep
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshotName(t *testing.T) {
+	taken := time.Date(2024, 5, 4, 8, 30, 15, 123456789, time.UTC)
+	name := SnapshotName(taken)
+	if name != "ownpath-20240504-083015.123456789.db" {
+		t.Errorf("SnapshotName = %s", name)
+	}
+	if got, ok := ParseSnapshotName(name); !ok || !got.Equal(taken) {
+		t.Errorf("ParseSnapshotName(%s) = %v, %v; want %v", name, got, ok, taken)
+	}
+	if other := SnapshotName(taken.Add(time.Millisecond)); other == name {
+		t.Errorf("snapshots taken in the same second share the name %s", name)
+	}
+
+	tests := []struct {
+		name string
+		want time.Time
+		ok   bool
+	}{
+		{"ownpath-20240504-083015.db", time.Date(2024, 5, 4, 8, 30, 15, 0, time.UTC), true}, // no fraction, as before
+		{"ownpath-20240504-083015.000000000.db", time.Date(2024, 5, 4, 8, 30, 15, 0, time.UTC), true},
+		{"ownpath-20240504-083015.db.tmp", time.Time{}, false},
+		{"ownpath-latest.db", time.Time{}, false},
+		{"backup-20240504-083015.db", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseSnapshotName(tt.name)
+		if ok != tt.ok || (ok && !got.Equal(tt.want)) {
+			t.Errorf("ParseSnapshotName(%s) = %v, %v; want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSnapshotsToKeep(t *testing.T) {
+	// Two snapshots a day, at 03:00 and 15:00, for the 28 days up to Sunday 2024-06-30
+	last := time.Date(2024, 6, 30, 15, 0, 0, 0, time.UTC)
+	var times []time.Time
+	for d := 0; d < 28; d++ {
+		day := last.AddDate(0, 0, -d)
+		times = append(times, day, day.Add(-12*time.Hour))
+	}
+	at := func(month time.Month, day int) time.Time { return time.Date(2024, month, day, 15, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name          string
+		daily, weekly int
+		want          []time.Time
+	}{
+		{"nothing configured keeps the newest", 0, 0, []time.Time{last}},
+		{"daily", 3, 0, []time.Time{at(6, 30), at(6, 29), at(6, 28)}},
+		// ISO weeks end on Sunday, so each week's newest snapshot is its Sunday afternoon
+		{"weekly", 0, 3, []time.Time{at(6, 30), at(6, 23), at(6, 16)}},
+		{"daily and weekly overlap", 2, 2, []time.Time{at(6, 30), at(6, 29), at(6, 23)}},
+		{"more than there are", 0, 10, []time.Time{at(6, 30), at(6, 23), at(6, 16), at(6, 9)}},
+	}
+	for _, tt := range tests {
+		keep := SnapshotsToKeep(times, tt.daily, tt.weekly)
+		if len(keep) != len(tt.want) {
+			t.Errorf("%s: kept %d snapshots, want %d: %v", tt.name, len(keep), len(tt.want), keep)
+			continue
+		}
+		for _, w := range tt.want {
+			if !keep[w] {
+				t.Errorf("%s: %v not kept", tt.name, w)
+			}
+		}
+	}
+
+	if keep := SnapshotsToKeep(nil, 7, 4); len(keep) != 0 {
+		t.Errorf("SnapshotsToKeep(nil) = %v, want none", keep)
+	}
+}
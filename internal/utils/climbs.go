@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"math"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// Climb detection thresholds.
+const (
+	climbMinLength  = 500.0 // meters
+	climbMinGrade   = 0.03  // average grade a climb must hold
+	climbFlatBand   = 2.0   // meters of altitude treated as level when trimming the ends
+	climbMaxDipMin  = 10.0  // meters of descent always tolerated inside a climb
+	climbMaxDipMax  = 50.0  // meters of descent that always ends a climb
+	climbDipFactor  = 0.1   // tolerated descent as a share of the gain so far
+	climbMatchRange = 100.0 // meters between start/end points of the same climb
+)
+
+// climbCategories are the category thresholds on climb score (length in meters times
+// average grade in percent), hardest first, in the style of the cycling grand tours.
+var climbCategories = []struct {
+	Name  string
+	Score float64
+}{
+	{"HC", 80000},
+	{"Cat 1", 64000},
+	{"Cat 2", 32000},
+	{"Cat 3", 16000},
+	{"Cat 4", 8000},
+}
+
+// Climb is a sustained ascent within an activity.
+type Climb struct {
+	Category      string  `json:"category"`
+	StartDistance float64 `json:"startDistance"` // meters from activity start
+	EndDistance   float64 `json:"endDistance"`
+	Length        float64 `json:"length"` // meters
+	Gain          float64 `json:"gain"`   // meters
+	AvgGrade      float64 `json:"avgGrade"`
+	MaxGrade      float64 `json:"maxGrade"`
+	Duration      float64 `json:"duration"` // seconds from foot to top
+	StartLat      float64 `json:"startLat"`
+	StartLon      float64 `json:"startLon"`
+	EndLat        float64 `json:"endLat"`
+	EndLon        float64 `json:"endLon"`
+}
+
+// ClimbSport reports whether climbs are detected for the sport.
+func ClimbSport(sport string) bool {
+	return sport == "Cycling" || sport == "Hiking"
+}
+
+// ClimbCategory returns the category of a climb of the given length (meters) and average
+// grade, or "" if it is too small to be categorized.
+func ClimbCategory(length, grade float64) string {
+	score := length * grade * 100
+	for _, c := range climbCategories {
+		if score >= c.Score {
+			return c.Name
+		}
+	}
+	return ""
+}
+
+// DetectClimbs finds the categorized climbs of an activity on the smoothed altitude
+// stream. A climb runs from a low point to the following high point and survives dips
+// of up to climbDipFactor of its gain (bounded by climbMaxDipMin/Max); its ends are then
+// trimmed of level ground so flat approaches don't dilute the grade.
+func DetectClimbs(records []models.Record) []Climb {
+	alt := SmoothAltitude(records)
+	if alt == nil {
+		return nil
+	}
+	grades := GradeStream(records)
+
+	var climbs []Climb
+	low, high := 0, 0
+	for i := range alt {
+		if alt[i] > alt[high] {
+			high = i
+			continue
+		}
+		gain := alt[high] - alt[low]
+		dip := math.Min(climbMaxDipMax, math.Max(climbMaxDipMin, gain*climbDipFactor))
+		switch {
+		case alt[high]-alt[i] > dip:
+			if c, ok := buildClimb(records, alt, grades, low, high); ok {
+				climbs = append(climbs, c)
+			}
+			low, high = i, i
+		case alt[i] < alt[low]:
+			// Still below the threshold of a climb: restart from the new low point
+			low, high = i, i
+		}
+	}
+	if c, ok := buildClimb(records, alt, grades, low, high); ok {
+		climbs = append(climbs, c)
+	}
+	return climbs
+}
+
+// buildClimb trims a low-to-high stretch and returns it as a climb if it qualifies.
+func buildClimb(records []models.Record, alt, grades []float64, low, high int) (Climb, bool) {
+	if high <= low {
+		return Climb{}, false
+	}
+	start, end := low, high
+	for j := low; j < high; j++ {
+		if alt[j] <= alt[low]+climbFlatBand {
+			start = j
+		}
+	}
+	for end > start && alt[end-1] >= alt[high]-climbFlatBand {
+		end--
+	}
+
+	length := records[end].Distance - records[start].Distance
+	gain := alt[end] - alt[start]
+	if length < climbMinLength || gain/length < climbMinGrade {
+		return Climb{}, false
+	}
+	category := ClimbCategory(length, gain/length)
+	if category == "" {
+		return Climb{}, false
+	}
+	c := Climb{
+		Category:      category,
+		StartDistance: records[start].Distance,
+		EndDistance:   records[end].Distance,
+		Length:        length,
+		Gain:          gain,
+		AvgGrade:      gain / length,
+		Duration:      records[end].Time.Sub(records[start].Time).Seconds(),
+	}
+	for j := start; j <= end; j++ {
+		c.MaxGrade = math.Max(c.MaxGrade, grades[j])
+	}
+	c.StartLat, c.StartLon = nearestPosition(records, start)
+	c.EndLat, c.EndLon = nearestPosition(records, end)
+	return c, true
+}
+
+// nearestPosition returns the GPS position of record i, or of the closest record that has one.
+func nearestPosition(records []models.Record, i int) (float64, float64) {
+	for d := 0; d < len(records); d++ {
+		for _, j := range []int{i - d, i + d} {
+			if j >= 0 && j < len(records) && records[j].HasPosition() {
+				return records[j].Lat, records[j].Lon
+			}
+		}
+	}
+	return 0, 0
+}
+
+// SameClimb reports whether two climbs cover the same road or trail: their start and end
+// points are within climbMatchRange meters of each other and their lengths within 10%.
+func SameClimb(a, b Climb) bool {
+	if a.StartLat == 0 && a.StartLon == 0 || b.StartLat == 0 && b.StartLon == 0 {
+		return false
+	}
+	return Haversine(a.StartLat, a.StartLon, b.StartLat, b.StartLon) <= climbMatchRange &&
+		Haversine(a.EndLat, a.EndLon, b.EndLat, b.EndLon) <= climbMatchRange &&
+		math.Abs(a.Length-b.Length) <= 0.1*math.Max(a.Length, b.Length)
+}
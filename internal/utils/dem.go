@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// hgtVoid marks a missing sample in SRTM data.
+const hgtVoid = -32768
+
+// hgtTile is one SRTM .hgt file: a square grid of big-endian int16 elevations covering
+// one degree, rows running north to south. SRTM1 tiles are 3601 samples wide, SRTM3 1201.
+type hgtTile struct {
+	size int
+	data []int16
+}
+
+// DEM looks up terrain elevation from SRTM .hgt tiles in a local directory. Tiles are
+// loaded on first use and cached; missing tiles are remembered so they aren't retried.
+type DEM struct {
+	dir   string
+	mu    sync.Mutex
+	tiles map[string]*hgtTile
+}
+
+// NewDEM returns a DEM reading tiles from dir, or an error if dir isn't a directory.
+func NewDEM(dir string) (*DEM, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &DEM{dir: dir, tiles: make(map[string]*hgtTile)}, nil
+}
+
+// Dir returns the tile directory.
+func (d *DEM) Dir() string {
+	return d.dir
+}
+
+// hgtName returns the SRTM file name of the tile whose south-west corner is (lat, lon),
+// e.g. N46E007.hgt.
+func hgtName(lat, lon int) string {
+	ns, ew := 'N', 'E'
+	if lat < 0 {
+		ns, lat = 'S', -lat
+	}
+	if lon < 0 {
+		ew, lon = 'W', -lon
+	}
+	return fmt.Sprintf("%c%02d%c%03d.hgt", ns, lat, ew, lon)
+}
+
+// tile returns the cached tile for the given corner, loading it if needed. It returns
+// nil when the tile file is missing or unreadable.
+func (d *DEM) tile(lat, lon int) *hgtTile {
+	name := hgtName(lat, lon)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t, ok := d.tiles[name]; ok {
+		return t
+	}
+	t, err := loadHGT(filepath.Join(d.dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Error loading DEM tile: %v", err)
+	}
+	d.tiles[name] = t // nil on error, so it isn't retried
+	return t
+}
+
+// loadHGT reads an .hgt file, inferring its resolution from the file size.
+func loadHGT(path string) (*hgtTile, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	size := int(math.Sqrt(float64(len(raw) / 2)))
+	if size < 2 || size*size*2 != len(raw) {
+		return nil, fmt.Errorf("%s: unexpected size %d bytes", path, len(raw))
+	}
+	data := make([]int16, size*size)
+	for i := range data {
+		data[i] = int16(binary.BigEndian.Uint16(raw[2*i:]))
+	}
+	return &hgtTile{size: size, data: data}, nil
+}
+
+// Elevation returns the terrain elevation (meters) at a point by bilinear interpolation
+// between the four surrounding samples. It reports false when the tile is missing or any
+// of the samples is void.
+func (d *DEM) Elevation(lat, lon float64) (float64, bool) {
+	latCorner, lonCorner := int(math.Floor(lat)), int(math.Floor(lon))
+	t := d.tile(latCorner, lonCorner)
+	if t == nil {
+		return 0, false
+	}
+	cells := float64(t.size - 1)
+	// Row 0 is the northern edge, column 0 the western edge
+	y := (float64(latCorner+1) - lat) * cells
+	x := (lon - float64(lonCorner)) * cells
+	row, col := min(int(y), t.size-2), min(int(x), t.size-2)
+	fy, fx := y-float64(row), x-float64(col)
+
+	at := func(r, c int) int16 { return t.data[r*t.size+c] }
+	nw, ne := at(row, col), at(row, col+1)
+	sw, se := at(row+1, col), at(row+1, col+1)
+	if nw == hgtVoid || ne == hgtVoid || sw == hgtVoid || se == hgtVoid {
+		return 0, false
+	}
+	north := float64(nw)*(1-fx) + float64(ne)*fx
+	south := float64(sw)*(1-fx) + float64(se)*fx
+	return north*(1-fy) + south*fy, true
+}
+
+// CorrectAltitude sets DEMAltitude on every positioned record the DEM covers, keeping
+// the device altitude untouched. It returns the number of records corrected.
+func CorrectAltitude(records []models.Record, dem *DEM) int {
+	corrected := 0
+	for i := range records {
+		records[i].DEMAltitude = nil
+		if !records[i].HasPosition() {
+			continue
+		}
+		if ele, ok := dem.Elevation(records[i].Lat, records[i].Lon); ok {
+			records[i].DEMAltitude = &ele
+			corrected++
+		}
+	}
+	return corrected
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// writeHGT writes a tile of the given samples (rows north to south) into dir.
+func writeHGT(t *testing.T, dir, name string, samples [][]int16) {
+	t.Helper()
+	var raw []byte
+	for _, row := range samples {
+		for _, v := range row {
+			raw = binary.BigEndian.AppendUint16(raw, uint16(v))
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testDEM returns a DEM with one 3x3 tile, N46E007, whose samples are half a degree
+// apart and whose south-east sample is void.
+func testDEM(t *testing.T) *DEM {
+	t.Helper()
+	dir := t.TempDir()
+	writeHGT(t, dir, "N46E007.hgt", [][]int16{
+		{100, 200, 300},
+		{400, 500, 600},
+		{700, 800, hgtVoid},
+	})
+	dem, err := NewDEM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dem
+}
+
+func TestDEMElevation(t *testing.T) {
+	dem := testDEM(t)
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     float64
+		ok       bool
+	}{
+		{"western edge", 46.5, 7, 400, true},
+		{"northern edge, in the tile to the north", 47, 7, 0, false},
+		{"south-west corner", 46, 7, 700, true},
+		{"center of a cell", 46.75, 7.25, 300, true},
+		{"on a column", 46.875, 7.5, 275, true},
+		{"on a row", 46.5, 7.125, 425, true},
+		{"next to a void sample", 46.25, 7.75, 0, false},
+		{"missing tile", 10.5, 10.5, 0, false},
+		{"southern hemisphere, missing tile", -33.5, 151.2, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := dem.Elevation(tt.lat, tt.lon)
+		if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: Elevation(%v, %v) = %v, %v; want %v, %v", tt.name, tt.lat, tt.lon, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCorrectAltitude(t *testing.T) {
+	dem := testDEM(t)
+	stale := 1234.0
+	deviceAlt := 380.0
+	records := []models.Record{
+		{Lat: 46.75, Lon: 7.25, Altitude: &deviceAlt},
+		{Lat: 46.25, Lon: 7.75, DEMAltitude: &stale}, // void: a stale correction is cleared
+		{HeartRate: 120},       // no position
+		{Lat: 10.5, Lon: 10.5}, // no tile
+	}
+	if n := CorrectAltitude(records, dem); n != 1 {
+		t.Errorf("CorrectAltitude corrected %d records, want 1", n)
+	}
+	if r := records[0]; r.DEMAltitude == nil || *r.DEMAltitude != 300 {
+		t.Errorf("record 0: DEMAltitude = %v, want 300", r.DEMAltitude)
+	}
+	if *records[0].Altitude != 380 {
+		t.Errorf("record 0: device altitude changed to %v", *records[0].Altitude)
+	}
+	for i, r := range records[1:] {
+		if r.DEMAltitude != nil {
+			t.Errorf("record %d: DEMAltitude = %v, want none", i+1, *r.DEMAltitude)
+		}
+	}
+}
+
+func TestNewDEMMissingDir(t *testing.T) {
+	if _, err := NewDEM(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("NewDEM succeeded for a missing directory")
+	}
+}
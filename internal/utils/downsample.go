@@ -0,0 +1,66 @@
+package utils
+
+import "math"
+
+// Downsample reduces a series to at most n points with the largest-triangle-three-buckets
+// algorithm, which keeps the first and last points and, from each bucket in between, the
+// point that best preserves the line's shape, so peaks survive. Series that are already
+// short enough, or n < 3, are returned unchanged.
+func Downsample(xs, ys []float64, n int) ([]float64, []float64) {
+	if n < 3 || len(xs) <= n {
+		return xs, ys
+	}
+	outX := make([]float64, 0, n)
+	outY := make([]float64, 0, n)
+	outX, outY = append(outX, xs[0]), append(outY, ys[0])
+
+	bucket := float64(len(xs)-2) / float64(n-2)
+	a := 0 // index of the previously selected point
+	for i := 0; i < n-2; i++ {
+		start := int(float64(i)*bucket) + 1
+		end := int(float64(i+1)*bucket) + 1
+
+		// Average of the next bucket is the triangle's third corner
+		nextStart, nextEnd := end, min(int(float64(i+2)*bucket)+1, len(xs))
+		var avgX, avgY float64
+		for j := nextStart; j < nextEnd; j++ {
+			avgX += xs[j]
+			avgY += ys[j]
+		}
+		if count := float64(nextEnd - nextStart); count > 0 {
+			avgX, avgY = avgX/count, avgY/count
+		} else {
+			avgX, avgY = xs[len(xs)-1], ys[len(ys)-1]
+		}
+
+		best, bestArea := start, -1.0
+		for j := start; j < end; j++ {
+			area := math.Abs((xs[a]-avgX)*(ys[j]-ys[a]) - (xs[a]-xs[j])*(avgY-ys[a]))
+			if area > bestArea {
+				best, bestArea = j, area
+			}
+		}
+		outX, outY = append(outX, xs[best]), append(outY, ys[best])
+		a = best
+	}
+	outX, outY = append(outX, xs[len(xs)-1]), append(outY, ys[len(ys)-1])
+	return outX, outY
+}
+
+// MovingAverage smooths a series with a centered moving average over window samples.
+func MovingAverage(ys []float64, window int) []float64 {
+	if window < 2 {
+		return ys
+	}
+	out := make([]float64, len(ys))
+	half := window / 2
+	for i := range ys {
+		lo, hi := max(0, i-half), min(len(ys), i+half+1)
+		var sum float64
+		for _, v := range ys[lo:hi] {
+			sum += v
+		}
+		out[i] = sum / float64(hi-lo)
+	}
+	return out
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// autoPauseGap is the longest gap between two records that still counts as continuous
+// recording. Longer gaps mean the device auto-paused and stopped writing records.
+const autoPauseGap = 30 * time.Second
+
+// minPause is the shortest stop that is reported as a pause.
+const minPause = 5 * time.Second
+
+// TimerEvent is a start or stop of the device timer (FIT Event message, event=timer).
+type TimerEvent struct {
+	Time  time.Time
+	Start bool
+}
+
+// Pause is a stretch of an activity where the athlete was not moving.
+type Pause struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Durations holds the time totals of an activity, all in seconds.
+type Durations struct {
+	Elapsed float64 // wall clock from start to finish, pauses included
+	Timer   float64 // time the device timer was running
+	Moving  float64 // time spent above the sport's moving speed threshold
+	Pauses  []Pause
+}
+
+// MovingSpeedThreshold returns the speed (m/s) below which an athlete of the given sport
+// is considered stopped.
+func MovingSpeedThreshold(sport string) float64 {
+	switch sport {
+	case "Cycling":
+		return 1.0
+	case "Running":
+		return 0.5
+	case "Walking", "Hiking":
+		return 0.3
+	case "Swimming":
+		return 0.1
+	default:
+		return 0.5
+	}
+}
+
+// TimerTime sums the intervals between timer start and stop events.
+// A timer still running after the last event is closed at end.
+func TimerTime(events []TimerEvent, end time.Time) float64 {
+	var total float64
+	var running bool
+	var startedAt time.Time
+	for _, ev := range events {
+		switch {
+		case ev.Start && !running:
+			running = true
+			startedAt = ev.Time
+		case !ev.Start && running:
+			running = false
+			total += ev.Time.Sub(startedAt).Seconds()
+		}
+	}
+	if running && end.After(startedAt) {
+		total += end.Sub(startedAt).Seconds()
+	}
+	return total
+}
+
+// ComputeDurations derives elapsed, timer and moving time for an activity.
+// sessionElapsed and sessionTimer are the device-reported totals (0 if unknown); they
+// are used when the record stream or timer events cannot provide the value.
+func ComputeDurations(records []models.Record, events []TimerEvent, sessionElapsed, sessionTimer float64, sport string) Durations {
+	var d Durations
+	if len(records) > 1 {
+		d.Elapsed = records[len(records)-1].Time.Sub(records[0].Time).Seconds()
+	}
+	if sessionElapsed > d.Elapsed {
+		d.Elapsed = sessionElapsed
+	}
+
+	switch {
+	case len(events) > 0:
+		var end time.Time
+		if len(records) > 0 {
+			end = records[len(records)-1].Time
+		}
+		d.Timer = TimerTime(events, end)
+	case sessionTimer > 0:
+		d.Timer = sessionTimer
+	default:
+		d.Timer = d.Elapsed
+	}
+
+	d.Moving, d.Pauses = MovingTime(records, sport)
+	if d.Moving > d.Timer && d.Timer > 0 {
+		d.Moving = d.Timer
+	}
+	return d
+}
+
+// MovingTime sums the intervals between consecutive records where the athlete moved
+// faster than the sport's threshold, and returns the detected pauses. Speed comes from
+// the record when reported, otherwise from the distance or position deltas.
+func MovingTime(records []models.Record, sport string) (float64, []Pause) {
+	threshold := MovingSpeedThreshold(sport)
+
+	var moving float64
+	var pauses []Pause
+	var pauseStart time.Time
+	inPause := false
+
+	for i := 1; i < len(records); i++ {
+		prev, cur := records[i-1], records[i]
+		dt := cur.Time.Sub(prev.Time)
+		if dt <= 0 {
+			continue
+		}
+
+		if isMovingInterval(prev, cur, threshold) {
+			moving += dt.Seconds()
+			if inPause {
+				if prev.Time.Sub(pauseStart) >= minPause {
+					pauses = append(pauses, Pause{Start: pauseStart, End: prev.Time})
+				}
+				inPause = false
+			}
+			continue
+		}
+		if !inPause {
+			inPause = true
+			pauseStart = prev.Time
+		}
+		// An auto-pause gap ends the pause at the next record even if we resume slowly.
+		if dt > autoPauseGap {
+			pauses = append(pauses, Pause{Start: pauseStart, End: cur.Time})
+			inPause = false
+		}
+	}
+	if inPause && len(records) > 0 {
+		end := records[len(records)-1].Time
+		if end.Sub(pauseStart) >= minPause {
+			pauses = append(pauses, Pause{Start: pauseStart, End: end})
+		}
+	}
+	return moving, pauses
+}
+
+// isMovingInterval reports whether the athlete was moving between two consecutive records.
+func isMovingInterval(prev, cur models.Record, threshold float64) bool {
+	dt := cur.Time.Sub(prev.Time)
+	if dt <= 0 || dt > autoPauseGap {
+		return false
+	}
+	return intervalSpeed(prev, cur, dt.Seconds()) >= threshold
+}
+
+// intervalSpeed estimates the speed (m/s) between two consecutive records.
+func intervalSpeed(prev, cur models.Record, dt float64) float64 {
+	if cur.Speed > 0 {
+		return cur.Speed
+	}
+	if cur.Distance > 0 && cur.Distance >= prev.Distance {
+		return (cur.Distance - prev.Distance) / dt
+	}
+	if prev.HasPosition() && cur.HasPosition() {
+		return Haversine(prev.Lat, prev.Lon, cur.Lat, cur.Lon) / dt
+	}
+	return 0
+}
@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"math"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// Effort metrics. Time efforts are better when lower, the others when higher.
+const (
+	EffortTime  = "time"  // seconds to cover a distance
+	EffortPower = "power" // average watts over a duration
+	EffortSpeed = "speed" // average m/s over a duration
+)
+
+// Effort is the best continuous stretch of an activity for one standard distance or duration.
+type Effort struct {
+	Name   string  `json:"name"`
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+	Start  float64 `json:"start"` // seconds from the first record
+	End    float64 `json:"end"`
+}
+
+// runEffortDistances are the standard running distances (meters), shortest first.
+var runEffortDistances = []struct {
+	Name   string
+	Meters float64
+}{
+	{"400m", 400},
+	{"1K", 1000},
+	{"1 mile", metersPerMile},
+	{"5K", 5000},
+	{"10K", 10000},
+	{"Half marathon", 21097.5},
+	{"Marathon", 42195},
+}
+
+// rideEffortDurations are the standard riding durations (seconds).
+var rideEffortDurations = []struct {
+	Name    string
+	Seconds int
+}{
+	{"5 min", 300},
+	{"20 min", 1200},
+	{"60 min", 3600},
+}
+
+// EffortOrder returns the display position of an effort name, so tables list
+// distances and durations from shortest to longest.
+func EffortOrder(name string) int {
+	for i, d := range runEffortDistances {
+		if d.Name == name {
+			return i
+		}
+	}
+	for i, d := range rideEffortDurations {
+		switch name {
+		case d.Name + " power":
+			return len(runEffortDistances) + 2*i
+		case d.Name + " speed":
+			return len(runEffortDistances) + 2*i + 1
+		}
+	}
+	return math.MaxInt32
+}
+
+// IsBetterEffort reports whether value a beats value b for the metric.
+func IsBetterEffort(metric string, a, b float64) bool {
+	if metric == EffortTime {
+		return a < b
+	}
+	return a > b
+}
+
+// BestEfforts finds the best efforts of an activity: standard distances for runs and
+// 5/20/60-minute power and speed for rides. Other sports have none.
+func BestEfforts(records []models.Record, sport string) []Effort {
+	if len(records) < 2 {
+		return nil
+	}
+	var efforts []Effort
+	switch sport {
+	case "Running":
+		for _, d := range runEffortDistances {
+			if e, ok := fastestDistance(records, d.Meters); ok {
+				e.Name = d.Name
+				efforts = append(efforts, e)
+			}
+		}
+	case "Cycling":
+		var stream []float64
+		if HasPower(records) {
+			stream = PowerStream(records)
+		}
+		for _, d := range rideEffortDurations {
+			if e, ok := bestAveragePower(stream, d.Seconds); ok {
+				e.Name = d.Name + " power"
+				efforts = append(efforts, e)
+			}
+			if e, ok := farthestDuration(records, float64(d.Seconds)); ok {
+				e.Name = d.Name + " speed"
+				efforts = append(efforts, e)
+			}
+		}
+	}
+	return efforts
+}
+
+// fastestDistance finds the shortest elapsed time to cover meters, interpolating the
+// start point inside the record interval where the segment begins.
+func fastestDistance(records []models.Record, meters float64) (Effort, bool) {
+	t0 := records[0].Time
+	best := Effort{Metric: EffortTime, Value: math.Inf(1)}
+	i := 0
+	for j := 1; j < len(records); j++ {
+		target := records[j].Distance - meters
+		if target < records[0].Distance {
+			continue
+		}
+		for i+1 < j && records[i+1].Distance <= target {
+			i++
+		}
+		// Start lies between records i and i+1
+		a, b := records[i], records[i+1]
+		start := a.Time.Sub(t0).Seconds()
+		if span := b.Distance - a.Distance; span > 0 {
+			start += (target - a.Distance) / span * b.Time.Sub(a.Time).Seconds()
+		}
+		end := records[j].Time.Sub(t0).Seconds()
+		if elapsed := end - start; elapsed > 0 && elapsed < best.Value {
+			best.Value, best.Start, best.End = elapsed, start, end
+		}
+	}
+	return best, !math.IsInf(best.Value, 1)
+}
+
+// farthestDuration finds the highest average speed held for the given number of seconds.
+func farthestDuration(records []models.Record, seconds float64) (Effort, bool) {
+	t0 := records[0].Time
+	best := Effort{Metric: EffortSpeed}
+	found := false
+	i := 0
+	for j := 1; j < len(records); j++ {
+		end := records[j].Time.Sub(t0).Seconds()
+		target := end - seconds
+		if target < 0 {
+			continue
+		}
+		for i+1 < j && records[i+1].Time.Sub(t0).Seconds() <= target {
+			i++
+		}
+		a, b := records[i], records[i+1]
+		startDist := a.Distance
+		if span := b.Time.Sub(a.Time).Seconds(); span > 0 {
+			startDist += (target - a.Time.Sub(t0).Seconds()) / span * (b.Distance - a.Distance)
+		}
+		if speed := (records[j].Distance - startDist) / seconds; speed > best.Value {
+			best.Value, best.Start, best.End = speed, target, end
+			found = true
+		}
+	}
+	return best, found
+}
+
+// bestAveragePower finds the highest average power over seconds in a 1 Hz stream.
+// Offsets are positions in the stream, which excludes auto-pause gaps.
+func bestAveragePower(stream []float64, seconds int) (Effort, bool) {
+	if len(stream) < seconds || seconds <= 0 {
+		return Effort{}, false
+	}
+	var window float64
+	best := Effort{Metric: EffortPower}
+	for i, p := range stream {
+		window += p
+		if i >= seconds {
+			window -= stream[i-seconds]
+		}
+		if i >= seconds-1 && window/float64(seconds) > best.Value {
+			best.Value = window / float64(seconds)
+			best.Start, best.End = float64(i-seconds+1), float64(i+1)
+		}
+	}
+	return best, best.Value > 0
+}
@@ -0,0 +1,128 @@
+package utils
+
+import "github.com/gratten/ownpath/internal/models"
+
+// altitudeWindow is the distance (meters) of the moving average applied to altitude.
+// It is wide enough to flatten GPS/barometer jitter but keeps short steep pitches.
+const altitudeWindow = 40.0
+
+// SmoothAltitude returns a smoothed altitude per record: gaps are filled by linear
+// interpolation, then each value is averaged over the surrounding altitudeWindow meters
+// of distance. It returns nil when no record has an altitude.
+func SmoothAltitude(records []models.Record) []float64 {
+	filled := fillAltitude(records)
+	if filled == nil {
+		return nil
+	}
+	prefix := make([]float64, len(filled)+1)
+	for i, a := range filled {
+		prefix[i+1] = prefix[i] + a
+	}
+
+	smoothed := make([]float64, len(filled))
+	lo, hi := 0, 0
+	for i := range filled {
+		d := records[i].Distance
+		for lo < i && d-records[lo].Distance > altitudeWindow/2 {
+			lo++
+		}
+		if hi < i {
+			hi = i
+		}
+		for hi+1 < len(records) && records[hi+1].Distance-d <= altitudeWindow/2 {
+			hi++
+		}
+		smoothed[i] = (prefix[hi+1] - prefix[lo]) / float64(hi-lo+1)
+	}
+	return smoothed
+}
+
+// HasDEMAltitude reports whether any record carries a terrain-model altitude.
+func HasDEMAltitude(records []models.Record) bool {
+	for _, r := range records {
+		if r.DEMAltitude != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// fillAltitude copies the altitude stream, interpolating records without altitude from
+// their neighbours (by distance) and extending the first/last known value to the ends.
+// When the track was DEM-corrected the corrected stream is used throughout, so device
+// and terrain altitudes (which can differ by tens of meters) are never mixed.
+func fillAltitude(records []models.Record) []float64 {
+	useDEM := HasDEMAltitude(records)
+	filled := make([]float64, len(records))
+	last := -1
+	for i, r := range records {
+		alt := r.Altitude
+		if useDEM {
+			alt = r.DEMAltitude
+		}
+		if alt == nil {
+			continue
+		}
+		filled[i] = *alt
+		switch {
+		case last == -1:
+			for j := 0; j < i; j++ {
+				filled[j] = filled[i]
+			}
+		case i-last > 1:
+			span := records[i].Distance - records[last].Distance
+			for j := last + 1; j < i; j++ {
+				f := float64(j-last) / float64(i-last)
+				if span > 0 {
+					f = (records[j].Distance - records[last].Distance) / span
+				}
+				filled[j] = filled[last] + f*(filled[i]-filled[last])
+			}
+		}
+		last = i
+	}
+	if last == -1 {
+		return nil
+	}
+	for j := last + 1; j < len(records); j++ {
+		filled[j] = filled[last]
+	}
+	return filled
+}
+
+// ascentThreshold is the hysteresis (meters) of the ascent/descent counter: altitude must
+// move this far from the last turning point before the change is counted, so residual
+// noise on flat ground does not add up to phantom climbing.
+const ascentThreshold = 3.0
+
+// ElevationStats are the elevation totals recomputed from the altitude stream.
+type ElevationStats struct {
+	Ascent      float64 // meters
+	Descent     float64 // meters
+	MinAltitude float64 // meters
+	MaxAltitude float64 // meters
+}
+
+// ComputeElevation derives total ascent/descent and the altitude range from the smoothed
+// altitude stream (see SmoothAltitude). It reports false when there is no altitude data.
+func ComputeElevation(records []models.Record) (ElevationStats, bool) {
+	alt := SmoothAltitude(records)
+	if alt == nil {
+		return ElevationStats{}, false
+	}
+	stats := ElevationStats{MinAltitude: alt[0], MaxAltitude: alt[0]}
+	ref := alt[0]
+	for _, a := range alt {
+		stats.MinAltitude = min(stats.MinAltitude, a)
+		stats.MaxAltitude = max(stats.MaxAltitude, a)
+		switch {
+		case a-ref >= ascentThreshold:
+			stats.Ascent += a - ref
+			ref = a
+		case ref-a >= ascentThreshold:
+			stats.Descent += ref - a
+			ref = a
+		}
+	}
+	return stats, true
+}
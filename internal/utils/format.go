@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// FormatDuration renders seconds as h:mm:ss (or m:ss under an hour).
+func FormatDuration(seconds float64) string {
+	s := int(math.Round(seconds))
+	if s < 0 {
+		s = 0
+	}
+	h, m, sec := s/3600, (s%3600)/60, s%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, sec)
+	}
+	return fmt.Sprintf("%d:%02d", m, sec)
+}
+
+// FormatPace renders a pace in seconds per distance unit as m:ss.
+func FormatPace(secondsPerUnit float64) string {
+	if secondsPerUnit <= 0 || math.IsInf(secondsPerUnit, 0) || math.IsNaN(secondsPerUnit) {
+		return "-"
+	}
+	return FormatDuration(secondsPerUnit)
+}
+
+// IsPaceSport reports whether a sport is conventionally shown as pace rather than speed.
+func IsPaceSport(sport string) bool {
+	switch sport {
+	case "Running", "Walking", "Hiking":
+		return true
+	default:
+		return false
+	}
+}
+
+// SportFromName maps a free-form activity type (GPX <type>, TCX Sport, or a FIT sport
+// number as text) to one of OwnPath's sport names.
+func SportFromName(name string) string {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "running", "run", "trail_running", "trail running", "treadmill_running", "1":
+		return "Running"
+	case "cycling", "biking", "bike", "ride", "road_biking", "mountain_biking", "gravel_cycling", "2":
+		return "Cycling"
+	case "hiking", "hike", "17":
+		return "Hiking"
+	case "walking", "walk", "11":
+		return "Walking"
+	case "swimming", "swim", "open_water_swimming", "lap_swimming", "5":
+		return "Swimming"
+	default:
+		return "Unknown"
+	}
+}
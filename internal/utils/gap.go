@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"math"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// gradeWindow is the distance (meters) over which grade is measured. Shorter windows
+// turn GPS/barometer noise into wild grades.
+const gradeWindow = 50.0
+
+// maxGrade clamps grades to the range the cost model was fitted on.
+const maxGrade = 0.45
+
+// MinettiCost returns the metabolic cost of running (J/kg/m) at the given grade
+// (rise over run, e.g. 0.1 for 10%), using the polynomial of Minetti et al. (2002).
+func MinettiCost(grade float64) float64 {
+	g := math.Max(-maxGrade, math.Min(maxGrade, grade))
+	return 155.4*math.Pow(g, 5) - 30.4*math.Pow(g, 4) - 43.3*math.Pow(g, 3) +
+		46.3*g*g + 19.5*g + 3.6
+}
+
+// GradeFactor returns how much harder running at grade is than on the flat.
+// Multiplying a distance by it gives the equivalent flat distance.
+func GradeFactor(grade float64) float64 {
+	return MinettiCost(grade) / MinettiCost(0)
+}
+
+// GradeStream returns the grade at each record, measured on the smoothed altitude
+// (see SmoothAltitude) over the surrounding gradeWindow meters of distance. Activities
+// without altitude get all-zero grades.
+func GradeStream(records []models.Record) []float64 {
+	grades := make([]float64, len(records))
+	alt := SmoothAltitude(records)
+	if alt == nil {
+		return grades
+	}
+	lo, hi := 0, 0
+	for i := range records {
+		d := records[i].Distance
+		for lo < i && d-records[lo].Distance > gradeWindow/2 {
+			lo++
+		}
+		if hi < i {
+			hi = i
+		}
+		for hi+1 < len(records) && records[hi+1].Distance-d <= gradeWindow/2 {
+			hi++
+		}
+		if run := records[hi].Distance - records[lo].Distance; run > 0 {
+			grades[i] = (alt[hi] - alt[lo]) / run
+		}
+	}
+	return grades
+}
+
+// SpeedStream returns the speed (m/s) at each record: the recorded speed when present,
+// otherwise derived from the distance covered since the previous record.
+func SpeedStream(records []models.Record) []float64 {
+	speeds := make([]float64, len(records))
+	for i, r := range records {
+		if r.Speed > 0 || i == 0 {
+			speeds[i] = r.Speed
+			continue
+		}
+		if dt := r.Time.Sub(records[i-1].Time).Seconds(); dt > 0 && dt <= autoPauseGap.Seconds() {
+			speeds[i] = math.Max(0, r.Distance-records[i-1].Distance) / dt
+		}
+	}
+	return speeds
+}
+
+// GAPStream returns the grade-adjusted speed (m/s) at each record: the flat-ground speed
+// that would cost the same effort as the actual speed on the actual grade.
+func GAPStream(records []models.Record) []float64 {
+	grades := GradeStream(records)
+	gap := SpeedStream(records)
+	for i := range gap {
+		gap[i] *= GradeFactor(grades[i])
+	}
+	return gap
+}
+
+// AverageGAP returns the grade-adjusted average speed (m/s) over moving time: the
+// flat-equivalent distance covered while moving divided by the moving time.
+func AverageGAP(records []models.Record, sport string) float64 {
+	threshold := MovingSpeedThreshold(sport)
+	grades := GradeStream(records)
+	var flatDist, moving float64
+	for i := 1; i < len(records); i++ {
+		if !isMovingInterval(records[i-1], records[i], threshold) {
+			continue
+		}
+		dd := math.Max(0, records[i].Distance-records[i-1].Distance)
+		flatDist += dd * GradeFactor(grades[i])
+		moving += records[i].Time.Sub(records[i-1].Time).Seconds()
+	}
+	if moving == 0 {
+		return 0
+	}
+	return flatDist / moving
+}
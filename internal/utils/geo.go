@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"math"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// earthRadius is the mean Earth radius in meters.
+const earthRadius = 6371008.8
+
+// Haversine returns the great-circle distance in meters between two points given in degrees.
+func Haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadius * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// EnsureDistance fills the cumulative Distance of records from their positions when
+// the source did not record a distance stream (e.g. GPS-only tracks).
+func EnsureDistance(records []models.Record) {
+	for _, r := range records {
+		if r.Distance > 0 {
+			return
+		}
+	}
+	var total float64
+	var last *models.Record
+	for i := range records {
+		if !records[i].HasPosition() {
+			records[i].Distance = total
+			continue
+		}
+		if last != nil {
+			total += Haversine(last.Lat, last.Lon, records[i].Lat, records[i].Lon)
+		}
+		records[i].Distance = total
+		last = &records[i]
+	}
+}
@@ -1,8 +1,15 @@
 package utils
 
 import (
+	"encoding/xml"
 	"fmt"
+	"io"
+	"math"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/gratten/ownpath/internal/models"
 )
 
 // generateGPXFromFIT generates a GPX XML string from parsed FIT data.
@@ -40,3 +47,254 @@ func GenerateGPXFromFIT(parsedData struct {
 	sb.WriteString(`</trkseg></trk></gpx>`)
 	return sb.String()
 }
+
+// gpxFile mirrors the parts of a GPX 1.0/1.1 document OwnPath imports. Element names
+// match regardless of namespace, so Garmin TrackPointExtension v1/v2 both work.
+type gpxFile struct {
+	Metadata struct {
+		Time string `xml:"time"`
+	} `xml:"metadata"`
+	Time   string `xml:"time"` // GPX 1.0 puts the file time at the top level
+	Tracks []struct {
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxPoint struct {
+	Lat        float64  `xml:"lat,attr"`
+	Lon        float64  `xml:"lon,attr"`
+	Ele        *float64 `xml:"ele"`
+	Time       string   `xml:"time"`
+	Extensions struct {
+		Power        *float64 `xml:"power"`        // bare element written by many tools
+		PowerInWatts *float64 `xml:"PowerInWatts"` // Garmin PowerExtension
+		TPX          struct {
+			HR    *float64 `xml:"hr"`
+			Cad   *float64 `xml:"cad"`
+			ATemp *float64 `xml:"atemp"`
+		} `xml:"TrackPointExtension"`
+	} `xml:"extensions"`
+}
+
+// ImportedGPX is a GPX track converted to OwnPath's record stream.
+type ImportedGPX struct {
+	Sport       string
+	StartTime   time.Time
+	Records     []models.Record
+	TimerEvents []TimerEvent // one start/stop pair per track segment
+}
+
+// ParseGPX reads a GPX track. Points without a timestamp are dropped since every
+// analysis is time based; each track segment becomes a timer start/stop pair.
+func ParseGPX(r io.Reader) (*ImportedGPX, error) {
+	var doc gpxFile
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid GPX: %w", err)
+	}
+
+	imp := &ImportedGPX{Sport: "Unknown"}
+	for _, trk := range doc.Tracks {
+		if trk.Type != "" && imp.Sport == "Unknown" {
+			imp.Sport = SportFromName(trk.Type)
+		}
+		for _, seg := range trk.Segments {
+			var segStart, segEnd time.Time
+			for _, pt := range seg.Points {
+				t, err := time.Parse(time.RFC3339, strings.TrimSpace(pt.Time))
+				if err != nil {
+					continue
+				}
+				rec := models.Record{Time: t.UTC(), Lat: pt.Lat, Lon: pt.Lon, Altitude: pt.Ele}
+				if v := pt.Extensions.TPX.HR; v != nil && *v > 0 && *v < 256 {
+					rec.HeartRate = uint8(*v)
+				}
+				if v := pt.Extensions.TPX.Cad; v != nil && *v > 0 && *v < 256 {
+					rec.Cadence = uint8(*v)
+				}
+				if v := pt.Extensions.TPX.ATemp; v != nil && *v > -128 && *v < 128 {
+					temp := int8(math.Round(*v))
+					rec.Temperature = &temp
+				}
+				v := pt.Extensions.PowerInWatts
+				if v == nil {
+					v = pt.Extensions.Power
+				}
+				if v != nil && *v > 0 && *v < 65535 {
+					rec.Power = uint16(*v)
+				}
+				imp.Records = append(imp.Records, rec)
+				if segStart.IsZero() {
+					segStart = rec.Time
+				}
+				segEnd = rec.Time
+			}
+			if !segStart.IsZero() {
+				imp.TimerEvents = append(imp.TimerEvents,
+					TimerEvent{Time: segStart, Start: true}, TimerEvent{Time: segEnd, Start: false})
+			}
+		}
+	}
+	if len(imp.Records) == 0 {
+		return nil, fmt.Errorf("GPX contains no timestamped track points")
+	}
+
+	sort.SliceStable(imp.Records, func(i, j int) bool { return imp.Records[i].Time.Before(imp.Records[j].Time) })
+	imp.StartTime = imp.Records[0].Time
+	for _, v := range []string{doc.Metadata.Time, doc.Time} {
+		if t, err := time.Parse(time.RFC3339, strings.TrimSpace(v)); err == nil && t.Before(imp.StartTime) {
+			imp.StartTime = t.UTC()
+		}
+	}
+	EnsureDistance(imp.Records)
+	return imp, nil
+}
+
+// GPX namespaces of exported documents.
+const (
+	gpxNamespace    = "http://www.topografix.com/GPX/1/1"
+	gpxtpxNamespace = "http://www.garmin.com/xmlschemas/TrackPointExtension/v2"
+	gpxpwrNamespace = "http://www.garmin.com/xmlschemas/PowerExtension/v1"
+	gpxSchemas      = gpxNamespace + " http://www.topografix.com/GPX/1/1/gpx.xsd " +
+		gpxtpxNamespace + " http://www.garmin.com/xmlschemas/TrackPointExtensionv2.xsd " +
+		gpxpwrNamespace + " http://www.garmin.com/xmlschemas/PowerExtensionv1.xsd"
+)
+
+// gpxOut is the GPX 1.1 document OwnPath exports.
+type gpxOut struct {
+	XMLName        xml.Name `xml:"gpx"`
+	Version        string   `xml:"version,attr"`
+	Creator        string   `xml:"creator,attr"`
+	Xmlns          string   `xml:"xmlns,attr"`
+	XmlnsGpxtpx    string   `xml:"xmlns:gpxtpx,attr"`
+	XmlnsPwr       string   `xml:"xmlns:pwr,attr"`
+	XmlnsXsi       string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	Metadata       struct {
+		Name string `xml:"name,omitempty"`
+		Time string `xml:"time,omitempty"`
+	} `xml:"metadata"`
+	Track struct {
+		Name     string          `xml:"name,omitempty"`
+		Type     string          `xml:"type,omitempty"`
+		Segments []gpxOutSegment `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxOutSegment struct {
+	Points []gpxOutPoint `xml:"trkpt"`
+}
+
+type gpxOutPoint struct {
+	Lat        float64        `xml:"lat,attr"`
+	Lon        float64        `xml:"lon,attr"`
+	Ele        *float64       `xml:"ele,omitempty"`
+	Time       string         `xml:"time,omitempty"`
+	Extensions *gpxExtensions `xml:"extensions,omitempty"`
+}
+
+// gpxExtensions carries the sensor channels in Garmin's extensions: power in the
+// PowerExtension, the rest in the TrackPointExtension (elements in schema order).
+type gpxExtensions struct {
+	Power *uint16    `xml:"pwr:PowerInWatts,omitempty"`
+	TPX   *gpxOutTPX `xml:"gpxtpx:TrackPointExtension,omitempty"`
+}
+
+type gpxOutTPX struct {
+	ATemp *int8  `xml:"gpxtpx:atemp,omitempty"`
+	HR    *uint8 `xml:"gpxtpx:hr,omitempty"`
+	Cad   *uint8 `xml:"gpxtpx:cad,omitempty"`
+}
+
+// gpxExtensionsOf returns the extensions of a record, or nil without sensor data.
+func gpxExtensionsOf(r models.Record) *gpxExtensions {
+	var ext gpxExtensions
+	if r.Power > 0 {
+		ext.Power = &r.Power
+	}
+	if r.Temperature != nil || r.HeartRate > 0 || r.Cadence > 0 {
+		ext.TPX = &gpxOutTPX{ATemp: r.Temperature}
+		if r.HeartRate > 0 {
+			ext.TPX.HR = &r.HeartRate
+		}
+		if r.Cadence > 0 {
+			ext.TPX.Cad = &r.Cadence
+		}
+	}
+	if ext.Power == nil && ext.TPX == nil {
+		return nil
+	}
+	return &ext
+}
+
+// SplitAtPauses splits a record stream where the device stopped recording (gaps longer
+// than an auto-pause), matching how imported GPX segments become timer stops.
+func SplitAtPauses(records []models.Record) [][]models.Record {
+	var parts [][]models.Record
+	start := 0
+	for i := 1; i < len(records); i++ {
+		if records[i].Time.Sub(records[i-1].Time) > autoPauseGap {
+			parts = append(parts, records[start:i])
+			start = i
+		}
+	}
+	if start < len(records) {
+		parts = append(parts, records[start:])
+	}
+	return parts
+}
+
+// WriteGPX writes a track as a GPX 1.1 document with one track segment per part, with
+// timestamps and the sensor channels as extensions. Records without a position are
+// skipped; elevation is the device's, or the terrain model's when the device had none.
+func WriteGPX(w io.Writer, name, sport string, start time.Time, parts [][]models.Record) error {
+	doc := gpxOut{
+		Version:        "1.1",
+		Creator:        "OwnPath",
+		Xmlns:          gpxNamespace,
+		XmlnsGpxtpx:    gpxtpxNamespace,
+		XmlnsPwr:       gpxpwrNamespace,
+		XmlnsXsi:       "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: gpxSchemas,
+	}
+	doc.Metadata.Name = name
+	if !start.IsZero() {
+		doc.Metadata.Time = start.UTC().Format(time.RFC3339)
+	}
+	doc.Track.Name, doc.Track.Type = name, sport
+	for _, part := range parts {
+		var seg gpxOutSegment
+		for _, r := range part {
+			if !r.HasPosition() {
+				continue
+			}
+			pt := gpxOutPoint{Lat: r.Lat, Lon: r.Lon, Extensions: gpxExtensionsOf(r)}
+			alt := r.Altitude
+			if alt == nil {
+				alt = r.DEMAltitude
+			}
+			if alt != nil {
+				ele := math.Round(*alt*10) / 10
+				pt.Ele = &ele
+			}
+			if !r.Time.IsZero() {
+				pt.Time = r.Time.UTC().Format(time.RFC3339)
+			}
+			seg.Points = append(seg.Points, pt)
+		}
+		if len(seg.Points) > 0 {
+			doc.Track.Segments = append(doc.Track.Segments, seg)
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode gpx: %w", err)
+	}
+	return enc.Close()
+}
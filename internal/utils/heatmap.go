@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// HeatmapZoom is the web-mercator zoom level of the stored density grid: one cell per
+// tile pixel at this zoom, roughly 10 m at the equator. Tiles at lower zooms aggregate
+// cells; higher zooms scale them up.
+const HeatmapZoom = 14
+
+// TileSize is the width and height of a map tile in pixels.
+const TileSize = 256
+
+// heatmapSaturation is the number of activities at which a pixel reaches full heat.
+const heatmapSaturation = 20.0
+
+// HeatCell is a cell of the density grid, in global pixel coordinates at HeatmapZoom.
+type HeatCell struct {
+	X int
+	Y int
+}
+
+// TileHeat is the number of activities that crossed one pixel of a tile.
+type TileHeat struct {
+	X     int // pixel within the tile, 0..TileSize-1 (in grid cells for zooms above HeatmapZoom)
+	Y     int
+	Count int
+}
+
+// MercatorPixel returns the global web-mercator pixel coordinates of a point at a zoom.
+func MercatorPixel(lat, lon float64, zoom int) (float64, float64) {
+	scale := float64(TileSize) * math.Exp2(float64(zoom))
+	lat = math.Max(-85.05112878, math.Min(85.05112878, lat))
+	sin := math.Sin(lat * math.Pi / 180)
+	x := (lon + 180) / 360 * scale
+	y := (0.5 - math.Log((1+sin)/(1-sin))/(4*math.Pi)) * scale
+	return x, y
+}
+
+// HeatmapCells returns the distinct grid cells an activity's track passes through.
+// Consecutive points are joined so fast or sparse tracks leave no gaps.
+func HeatmapCells(records []models.Record) []HeatCell {
+	seen := make(map[HeatCell]bool)
+	var cells []HeatCell
+	add := func(x, y float64) {
+		c := HeatCell{X: int(x), Y: int(y)}
+		if !seen[c] {
+			seen[c] = true
+			cells = append(cells, c)
+		}
+	}
+	var prev models.Record
+	havePrev := false
+	for _, r := range records {
+		if !r.HasPosition() {
+			continue
+		}
+		x, y := MercatorPixel(r.Lat, r.Lon, HeatmapZoom)
+		if havePrev {
+			px, py := MercatorPixel(prev.Lat, prev.Lon, HeatmapZoom)
+			// Don't draw lines across GPS dropouts
+			if steps := math.Max(math.Abs(x-px), math.Abs(y-py)); steps < 200 {
+				for s := 1.0; s < steps; s++ {
+					add(px+(x-px)*s/steps, py+(y-py)*s/steps)
+				}
+			}
+		}
+		add(x, y)
+		prev, havePrev = r, true
+	}
+	return cells
+}
+
+// heatColor maps an activity count to a color running from translucent red through
+// orange and yellow to white on a logarithmic scale.
+func heatColor(count int) color.NRGBA {
+	t := math.Min(1, math.Log1p(float64(count))/math.Log1p(heatmapSaturation))
+	switch {
+	case t < 0.5:
+		return color.NRGBA{R: 255, G: uint8(255 * t), B: 0, A: uint8(120 + 270*t)}
+	default:
+		return color.NRGBA{R: 255, G: 128 + uint8(127*(t-0.5)*2), B: uint8(255 * (t - 0.5) * 2), A: 255}
+	}
+}
+
+// RenderHeatmapTile draws the heat of one tile as a transparent PNG. cellSize is the
+// width in pixels of one TileHeat cell (1 at or below HeatmapZoom).
+func RenderHeatmapTile(heat []TileHeat, cellSize int) ([]byte, error) {
+	img := image.NewNRGBA(image.Rect(0, 0, TileSize, TileSize))
+	for _, h := range heat {
+		c := heatColor(h.Count)
+		for dy := 0; dy < cellSize; dy++ {
+			for dx := 0; dx < cellSize; dx++ {
+				x, y := h.X*cellSize+dx, h.Y*cellSize+dy
+				if x >= 0 && x < TileSize && y >= 0 && y < TileSize {
+					img.SetNRGBA(x, y, c)
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+func TestMercatorPixel(t *testing.T) {
+	tests := []struct {
+		lat, lon float64
+		zoom     int
+		x, y     float64
+	}{
+		{0, 0, 0, 128, 128},
+		{0, 0, 1, 256, 256},
+		{85.05112878, -180, 0, 0, 0},
+		{-85.05112878, 180, 0, 256, 256},
+		{89, 0, 0, 128, 0}, // clamped to the edge of the map
+		{0, 90, 2, 768, 512},
+	}
+	for _, tt := range tests {
+		x, y := MercatorPixel(tt.lat, tt.lon, tt.zoom)
+		if math.Abs(x-tt.x) > 1e-6 || math.Abs(y-tt.y) > 1e-6 {
+			t.Errorf("MercatorPixel(%g, %g, %d) = %g, %g; want %g, %g", tt.lat, tt.lon, tt.zoom, x, y, tt.x, tt.y)
+		}
+	}
+}
+
+// heatPoint returns a record at the centre of the grid cell dx, dy cells east and south
+// of the one at 0°, 0°.
+func heatPoint(dx, dy float64) models.Record {
+	scale := float64(TileSize) * math.Exp2(HeatmapZoom)
+	x, y := scale/2+dx+0.5, scale/2+dy+0.5
+	lon := x/scale*360 - 180
+	lat := math.Atan(math.Sinh(math.Pi*(1-2*y/scale))) * 180 / math.Pi
+	return models.Record{Lat: lat, Lon: lon}
+}
+
+func TestHeatmapCells(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []models.Record
+		want    int // distinct cells
+	}{
+		{"single point", []models.Record{heatPoint(1, 1)}, 1},
+		{"same cell twice", []models.Record{heatPoint(1, 1), heatPoint(1, 1)}, 1},
+		{"neighbours", []models.Record{heatPoint(1, 1), heatPoint(2, 1)}, 2},
+		{"gap filled in", []models.Record{heatPoint(1, 1), heatPoint(11, 1)}, 11},
+		{"diagonal filled in", []models.Record{heatPoint(1, 1), heatPoint(11, 11)}, 11},
+		{"dropout left open", []models.Record{heatPoint(1, 1), heatPoint(301, 1)}, 2},
+		{"positionless records skipped", []models.Record{heatPoint(1, 1), {}, heatPoint(3, 1)}, 3},
+		{"no track", []models.Record{{}, {}}, 0},
+	}
+	for _, tt := range tests {
+		cells := HeatmapCells(tt.records)
+		if len(cells) != tt.want {
+			t.Errorf("%s: got %d cells, want %d: %v", tt.name, len(cells), tt.want, cells)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"math"
+	"time"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// Time constants (days) of the fitness/fatigue model.
+const (
+	ctlDays = 42
+	atlDays = 7
+)
+
+// Load methods, in order of preference.
+const (
+	LoadTSS   = "tss"   // power-based, needs FTP
+	LoadHRTSS = "hrtss" // heart-rate based, needs LTHR (or max HR to estimate it)
+	LoadTRIMP = "trimp" // Banister TRIMP, needs max and resting HR
+)
+
+// LoadDay is one day of the training-load series.
+type LoadDay struct {
+	Date string  `json:"date"` // YYYY-MM-DD
+	Load float64 `json:"load"` // summed activity load of the day
+	CTL  float64 `json:"ctl"`  // chronic training load (fitness)
+	ATL  float64 `json:"atl"`  // acute training load (fatigue)
+	TSB  float64 `json:"tsb"`  // training stress balance (form), yesterday's CTL - ATL
+}
+
+// HRTSS computes heart-rate training stress: each second scores like TSS with the
+// heart-rate intensity (HR above resting relative to LTHR above resting) as IF.
+func HRTSS(records []models.Record, restingHR, lthr int) float64 {
+	if lthr <= restingHR {
+		return 0
+	}
+	var score float64
+	for i := 1; i < len(records); i++ {
+		hr := records[i].HeartRate
+		dt := records[i].Time.Sub(records[i-1].Time)
+		if hr == 0 || dt <= 0 || dt > autoPauseGap {
+			continue
+		}
+		intensity := math.Max(0, float64(int(hr)-restingHR)) / float64(lthr-restingHR)
+		score += dt.Hours() * intensity * intensity * 100
+	}
+	return score
+}
+
+// TRIMP computes Banister's training impulse from the heart-rate reserve.
+func TRIMP(records []models.Record, restingHR, maxHR int) float64 {
+	if maxHR <= restingHR {
+		return 0
+	}
+	var score float64
+	for i := 1; i < len(records); i++ {
+		hr := records[i].HeartRate
+		dt := records[i].Time.Sub(records[i-1].Time)
+		if hr == 0 || dt <= 0 || dt > autoPauseGap {
+			continue
+		}
+		hrr := math.Max(0, math.Min(1, float64(int(hr)-restingHR)/float64(maxHR-restingHR)))
+		score += dt.Minutes() * hrr * 0.64 * math.Exp(1.92*hrr)
+	}
+	return score
+}
+
+// ActivityLoad picks the best available load measure for an activity: TSS from power
+// (tss > 0), else hrTSS or TRIMP from the heart-rate profile. It returns 0 and an
+// empty method when no measure applies.
+func ActivityLoad(tss float64, records []models.Record, profile *models.HRProfile) (float64, string) {
+	if tss > 0 {
+		return tss, LoadTSS
+	}
+	if profile == nil || !HasHeartRate(records) {
+		return 0, ""
+	}
+	lthr := profile.LTHR
+	if lthr == 0 && profile.MaxHR > 0 {
+		lthr = int(math.Round(0.89 * float64(profile.MaxHR))) // common LTHR estimate
+	}
+	if lthr > profile.RestingHR && profile.RestingHR > 0 {
+		return HRTSS(records, profile.RestingHR, lthr), LoadHRTSS
+	}
+	if profile.MaxHR > 0 {
+		return TRIMP(records, profile.RestingHR, profile.MaxHR), LoadTRIMP
+	}
+	return 0, ""
+}
+
+// TrainingLoadSeries turns daily loads (keyed by YYYY-MM-DD) into a continuous CTL/ATL/TSB
+// series from the earliest day through end, with exponentially weighted averages.
+func TrainingLoadSeries(daily map[string]float64, end time.Time) []LoadDay {
+	if len(daily) == 0 {
+		return nil
+	}
+	var start time.Time
+	for d := range daily {
+		t, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			continue
+		}
+		if start.IsZero() || t.Before(start) {
+			start = t
+		}
+	}
+	if start.IsZero() {
+		return nil
+	}
+	end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+
+	kCTL := 1 - math.Exp(-1.0/ctlDays)
+	kATL := 1 - math.Exp(-1.0/atlDays)
+	var series []LoadDay
+	var ctl, atl float64
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		load := daily[date]
+		tsb := ctl - atl
+		ctl += (load - ctl) * kCTL
+		atl += (load - atl) * kATL
+		series = append(series, LoadDay{Date: date, Load: load, CTL: ctl, ATL: atl, TSB: tsb})
+	}
+	return series
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"math"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// npWindow is the rolling-average window (seconds) of Coggan's normalized power.
+const npWindow = 30
+
+// PowerCurveDurations are the durations (seconds) of the mean-maximal power curve, 1s to 2h.
+var PowerCurveDurations = []int{1, 2, 5, 10, 15, 20, 30, 60, 120, 180, 300, 600, 900, 1200, 1800, 2700, 3600, 5400, 7200}
+
+// PowerMetrics summarizes a ride's power data.
+type PowerMetrics struct {
+	Seconds          int     // length of the 1 Hz power stream
+	AvgPower         float64 // watts
+	NormalizedPower  float64 // watts
+	IntensityFactor  float64 // NP / FTP, 0 without FTP
+	TSS              float64 // training stress score, 0 without FTP
+	VariabilityIndex float64 // NP / average power
+}
+
+// PowerCurvePoint is the best average power held for Duration seconds.
+type PowerCurvePoint struct {
+	Duration   int     `json:"duration"`
+	Watts      float64 `json:"watts"`
+	ActivityID string  `json:"activity_id,omitempty"` // set for best-of curves across activities
+}
+
+// HasPower reports whether any record carries a power sample.
+func HasPower(records []models.Record) bool {
+	for _, r := range records {
+		if r.Power > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// PowerStream resamples the record stream to one power value per second. Each gap between
+// records is filled with the closing sample; auto-pause gaps are dropped.
+func PowerStream(records []models.Record) []float64 {
+	if len(records) == 0 {
+		return nil
+	}
+	stream := []float64{float64(records[0].Power)}
+	for i := 1; i < len(records); i++ {
+		dt := records[i].Time.Sub(records[i-1].Time)
+		if dt <= 0 || dt > autoPauseGap {
+			continue
+		}
+		for s := 0; s < int(math.Round(dt.Seconds())); s++ {
+			stream = append(stream, float64(records[i].Power))
+		}
+	}
+	return stream
+}
+
+// NormalizedPower computes Coggan's NP: the fourth root of the mean of the fourth power of
+// the 30-second rolling average. Streams shorter than the window fall back to the mean.
+func NormalizedPower(stream []float64) float64 {
+	if len(stream) == 0 {
+		return 0
+	}
+	if len(stream) < npWindow {
+		return mean(stream)
+	}
+	var window, sum4 float64
+	for i, p := range stream {
+		window += p
+		if i >= npWindow {
+			window -= stream[i-npWindow]
+		}
+		if i >= npWindow-1 {
+			sum4 += math.Pow(window/npWindow, 4)
+		}
+	}
+	return math.Pow(sum4/float64(len(stream)-npWindow+1), 0.25)
+}
+
+// ComputePowerMetrics derives NP, IF, TSS and VI from a 1 Hz power stream and the FTP
+// in effect (0 if unknown, which leaves IF and TSS at 0).
+func ComputePowerMetrics(stream []float64, ftp float64) PowerMetrics {
+	m := PowerMetrics{Seconds: len(stream)}
+	if len(stream) == 0 {
+		return m
+	}
+	m.AvgPower = mean(stream)
+	m.NormalizedPower = NormalizedPower(stream)
+	if m.AvgPower > 0 {
+		m.VariabilityIndex = m.NormalizedPower / m.AvgPower
+	}
+	if ftp > 0 {
+		m.IntensityFactor = m.NormalizedPower / ftp
+		m.TSS = float64(m.Seconds) * m.NormalizedPower * m.IntensityFactor / (ftp * 3600) * 100
+	}
+	return m
+}
+
+// MeanMaxPower returns the highest average power sustained for each of the given
+// durations. Durations longer than the stream are omitted.
+func MeanMaxPower(stream []float64, durations []int) []PowerCurvePoint {
+	prefix := make([]float64, len(stream)+1)
+	for i, p := range stream {
+		prefix[i+1] = prefix[i] + p
+	}
+	var curve []PowerCurvePoint
+	for _, d := range durations {
+		if d <= 0 || d > len(stream) {
+			continue
+		}
+		var best float64
+		for end := d; end <= len(stream); end++ {
+			if sum := prefix[end] - prefix[end-d]; sum > best {
+				best = sum
+			}
+		}
+		curve = append(curve, PowerCurvePoint{Duration: d, Watts: best / float64(d)})
+	}
+	return curve
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
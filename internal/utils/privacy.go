@@ -0,0 +1,42 @@
+package utils
+
+import "github.com/gratten/ownpath/internal/models"
+
+// InPrivacyZone reports whether a point lies inside any of the zones.
+func InPrivacyZone(lat, lon float64, zones []models.PrivacyZone) bool {
+	for _, z := range zones {
+		if Haversine(lat, lon, z.Lat, z.Lon) <= z.Radius {
+			return true
+		}
+	}
+	return false
+}
+
+// TrimPrivacyZones drops the positioned records that fall inside any of the zones. The
+// track is split where it enters a zone, so no line is drawn across the hidden part;
+// the result is the visible stretches in order. Records without a position are kept
+// with the stretch they belong to.
+func TrimPrivacyZones(records []models.Record, zones []models.PrivacyZone) [][]models.Record {
+	if len(zones) == 0 {
+		if len(records) == 0 {
+			return nil
+		}
+		return [][]models.Record{records}
+	}
+	var parts [][]models.Record
+	var current []models.Record
+	for _, r := range records {
+		if r.HasPosition() && InPrivacyZone(r.Lat, r.Lon, zones) {
+			if len(current) > 0 {
+				parts = append(parts, current)
+				current = nil
+			}
+			continue
+		}
+		current = append(current, r)
+	}
+	if len(current) > 0 {
+		parts = append(parts, current)
+	}
+	return parts
+}
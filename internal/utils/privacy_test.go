@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// privacyTrack builds records at the given multiples of 100 m east along the equator,
+// with their index as Distance; a negative offset is a record without a position.
+func privacyTrack(offsets ...int) []models.Record {
+	const metersPerDegree = earthRadius * math.Pi / 180
+	records := make([]models.Record, len(offsets))
+	for i, o := range offsets {
+		records[i].Distance = float64(i)
+		if o >= 0 {
+			// Just north of the equator, as 0,0 reads as no position
+			records[i].Lat, records[i].Lon = 1e-9, float64(o)*100/metersPerDegree
+		}
+	}
+	return records
+}
+
+func TestTrimPrivacyZones(t *testing.T) {
+	// Around the third point of privacyTrack, 200 m from the start
+	home := models.PrivacyZone{Lat: 0, Lon: 200 / (earthRadius * math.Pi / 180), Radius: 150}
+
+	tests := []struct {
+		name    string
+		records []models.Record
+		zones   []models.PrivacyZone
+		want    [][]float64 // Distance of the records of each part
+	}{
+		{"no zones", privacyTrack(0, 1, 2), nil, [][]float64{{0, 1, 2}}},
+		{"nothing inside", privacyTrack(5, 6, 7), []models.PrivacyZone{home}, [][]float64{{0, 1, 2}}},
+		{"starts inside", privacyTrack(2, 3, 4, 5, 6), []models.PrivacyZone{home}, [][]float64{{2, 3, 4}}},
+		{"ends inside", privacyTrack(6, 5, 4, 3, 2), []models.PrivacyZone{home}, [][]float64{{0, 1, 2}}},
+		{"passes through", privacyTrack(0, 1, 2, 3, 4, 5), []models.PrivacyZone{home}, [][]float64{{0}, {4, 5}}},
+		{"positionless records stay with their stretch", privacyTrack(5, -1, 2, -1, 6), []models.PrivacyZone{home}, [][]float64{{0, 1}, {3, 4}}},
+		{"all inside", privacyTrack(1, 2, 3), []models.PrivacyZone{home}, nil},
+		{"empty", nil, nil, nil},
+	}
+	for _, tt := range tests {
+		parts := TrimPrivacyZones(tt.records, tt.zones)
+		if len(parts) != len(tt.want) {
+			t.Errorf("%s: got %d parts, want %d", tt.name, len(parts), len(tt.want))
+			continue
+		}
+		for i, part := range parts {
+			if len(part) != len(tt.want[i]) {
+				t.Errorf("%s: part %d has %d records, want %d", tt.name, i, len(part), len(tt.want[i]))
+				continue
+			}
+			for j, r := range part {
+				if r.Distance != tt.want[i][j] {
+					t.Errorf("%s: part %d record %d is record %.0f, want %.0f", tt.name, i, j, r.Distance, tt.want[i][j])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// Route fingerprinting parameters.
+const (
+	routeCellSize        = 0.002 // degrees of the start/end grid cells (about 200 m)
+	routePoints          = 32    // points of the simplified polyline
+	routeLengthTolerance = 0.15  // relative length difference allowed within a route
+	routeMeanDistance    = 75.0  // meters, mean gap between matching polyline points
+	routeMaxDistance     = 250.0 // meters, largest gap between matching polyline points
+)
+
+// RouteFingerprint summarizes the path of an activity for route clustering: the grid
+// cells of its start and end, and its track resampled to routePoints points evenly
+// spaced by distance.
+type RouteFingerprint struct {
+	StartCell string          `json:"startCell"`
+	EndCell   string          `json:"endCell"`
+	Length    float64         `json:"length"` // meters
+	Points    []models.LatLon `json:"points"`
+}
+
+// RouteCell returns the grid cell containing a point.
+func RouteCell(lat, lon float64) string {
+	return fmt.Sprintf("%d,%d", int(math.Floor(lat/routeCellSize)), int(math.Floor(lon/routeCellSize)))
+}
+
+// NeighborCells returns the cell containing a point and its eight neighbours, so
+// activities starting either side of a cell border are still compared.
+func NeighborCells(lat, lon float64) []string {
+	cells := make([]string, 0, 9)
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			cells = append(cells, RouteCell(lat+float64(dy)*routeCellSize, lon+float64(dx)*routeCellSize))
+		}
+	}
+	return cells
+}
+
+// ComputeFingerprint builds the route fingerprint of an activity. It reports false when
+// the activity has too little GPS track to describe a route.
+func ComputeFingerprint(records []models.Record) (RouteFingerprint, bool) {
+	var track []models.Record
+	for _, r := range records {
+		if r.HasPosition() {
+			track = append(track, r)
+		}
+	}
+	if len(track) < 2 {
+		return RouteFingerprint{}, false
+	}
+	first, last := track[0], track[len(track)-1]
+	length := last.Distance - first.Distance
+	if length <= 0 {
+		return RouteFingerprint{}, false
+	}
+
+	fp := RouteFingerprint{
+		StartCell: RouteCell(first.Lat, first.Lon),
+		EndCell:   RouteCell(last.Lat, last.Lon),
+		Length:    length,
+	}
+	j := 0
+	for k := 0; k < routePoints; k++ {
+		target := first.Distance + length*float64(k)/float64(routePoints-1)
+		for j+1 < len(track)-1 && track[j+1].Distance < target {
+			j++
+		}
+		a, b := track[j], track[j+1]
+		f := 0.0
+		if span := b.Distance - a.Distance; span > 0 {
+			f = math.Max(0, math.Min(1, (target-a.Distance)/span))
+		}
+		fp.Points = append(fp.Points, models.LatLon{Lat: a.Lat + f*(b.Lat-a.Lat), Lon: a.Lon + f*(b.Lon-a.Lon)})
+	}
+	return fp, true
+}
+
+// SameRoute reports whether two fingerprints describe the same route: similar length
+// and polylines that stay close point by point, in the same direction.
+func SameRoute(a, b RouteFingerprint) bool {
+	if len(a.Points) != len(b.Points) || len(a.Points) == 0 {
+		return false
+	}
+	if math.Abs(a.Length-b.Length) > routeLengthTolerance*math.Max(a.Length, b.Length) {
+		return false
+	}
+	total := 0.0
+	for i := range a.Points {
+		d := Haversine(a.Points[i].Lat, a.Points[i].Lon, b.Points[i].Lat, b.Points[i].Lon)
+		if d > routeMaxDistance {
+			return false
+		}
+		total += d
+	}
+	return total/float64(len(a.Points)) <= routeMeanDistance
+}
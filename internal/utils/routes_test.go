@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// routeTrack builds a straight track of the given length heading east from lat, lon,
+// with a record every 10 m, and returns its fingerprint.
+func routeTrack(t *testing.T, lat, lon, length float64) RouteFingerprint {
+	t.Helper()
+	const metersPerDegree = earthRadius * math.Pi / 180
+	var records []models.Record
+	for d := 0.0; d <= length; d += 10 {
+		records = append(records, models.Record{Lat: lat, Lon: lon + d/(metersPerDegree*math.Cos(lat*math.Pi/180)), Distance: d})
+	}
+	fp, ok := ComputeFingerprint(records)
+	if !ok {
+		t.Fatalf("no fingerprint for a %.0f m track", length)
+	}
+	return fp
+}
+
+// reversed returns the fingerprint of the same path ridden the other way.
+func reversed(fp RouteFingerprint) RouteFingerprint {
+	r := RouteFingerprint{StartCell: fp.EndCell, EndCell: fp.StartCell, Length: fp.Length}
+	for i := len(fp.Points) - 1; i >= 0; i-- {
+		r.Points = append(r.Points, fp.Points[i])
+	}
+	return r
+}
+
+func TestComputeFingerprint(t *testing.T) {
+	fp := routeTrack(t, 45.0011, 6.0011, 5000)
+	if len(fp.Points) != routePoints {
+		t.Errorf("fingerprint has %d points, want %d", len(fp.Points), routePoints)
+	}
+	if fp.Length != 5000 {
+		t.Errorf("length = %.0f, want 5000", fp.Length)
+	}
+	if fp.StartCell != "22500,3000" {
+		t.Errorf("start cell = %s, want 22500,3000", fp.StartCell)
+	}
+	if first := fp.Points[0]; first.Lat != 45.0011 || first.Lon != 6.0011 {
+		t.Errorf("first point = %v, want the start of the track", first)
+	}
+
+	tests := []struct {
+		name    string
+		records []models.Record
+	}{
+		{"no records", nil},
+		{"one point", []models.Record{{Lat: 45, Lon: 6}}},
+		{"no position", []models.Record{{Distance: 0}, {Distance: 100}}},
+		{"no distance", []models.Record{{Lat: 45, Lon: 6}, {Lat: 45.001, Lon: 6}}},
+	}
+	for _, tt := range tests {
+		if _, ok := ComputeFingerprint(tt.records); ok {
+			t.Errorf("%s: got a fingerprint", tt.name)
+		}
+	}
+}
+
+func TestSameRoute(t *testing.T) {
+	const metersPerDegree = earthRadius * math.Pi / 180
+	base := routeTrack(t, 45, 6, 5000)
+
+	tests := []struct {
+		name  string
+		other RouteFingerprint
+		want  bool
+	}{
+		{"same track", routeTrack(t, 45, 6, 5000), true},
+		{"shifted 50 m", routeTrack(t, 45+50/metersPerDegree, 6, 5000), true},
+		{"2% longer", routeTrack(t, 45, 6, 5100), true},
+		{"shifted 300 m", routeTrack(t, 45+300/metersPerDegree, 6, 5000), false},
+		{"20% longer", routeTrack(t, 45, 6, 6000), false},
+		{"other way round", reversed(base), false},
+		{"no points", RouteFingerprint{Length: 5000}, false},
+	}
+	for _, tt := range tests {
+		if got := SameRoute(base, tt.other); got != tt.want {
+			t.Errorf("%s: SameRoute = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := SameRoute(tt.other, base); got != tt.want {
+			t.Errorf("%s (swapped): SameRoute = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNeighborCells(t *testing.T) {
+	cells := NeighborCells(45.0011, 6.0011)
+	if len(cells) != 9 {
+		t.Fatalf("got %d cells, want 9", len(cells))
+	}
+	want := map[string]bool{}
+	for _, lat := range []int{22499, 22500, 22501} {
+		for _, lon := range []int{2999, 3000, 3001} {
+			want[RouteCell(float64(lat)*routeCellSize+routeCellSize/2, float64(lon)*routeCellSize+routeCellSize/2)] = true
+		}
+	}
+	for _, c := range cells {
+		if !want[c] {
+			t.Errorf("unexpected neighbour cell %s", c)
+		}
+		delete(want, c)
+	}
+	if len(want) > 0 {
+		t.Errorf("missing neighbour cells %v", want)
+	}
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"math"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// Segment matching tolerances.
+const (
+	segmentPointSpacing   = 10.0 // meters between stored segment points
+	segmentEndpointRadius = 30.0 // meters an effort must pass from the segment start/end
+	segmentPathTolerance  = 40.0 // meters a segment point may be from the effort's track
+	segmentMinCoverage    = 0.9  // share of segment points that must lie on the track
+	segmentMinTravel      = 0.8  // effort distance as a share of segment length, lower bound
+	segmentMaxTravel      = 1.5  // and upper bound, so detours aren't counted
+)
+
+// SegmentEffort is one pass of an activity over a segment.
+type SegmentEffort struct {
+	Start   float64 `json:"start"` // seconds from the first record
+	End     float64 `json:"end"`
+	Elapsed float64 `json:"elapsed"` // seconds
+}
+
+// SegmentPath extracts the path of the records between two distances (meters), keeping
+// a point every segmentPointSpacing meters. It returns the points and the path length.
+func SegmentPath(records []models.Record, from, to float64) ([]models.LatLon, float64) {
+	var selected []models.Record
+	for _, r := range records {
+		if r.HasPosition() && r.Distance >= from && r.Distance <= to {
+			selected = append(selected, r)
+		}
+	}
+	if len(selected) < 2 {
+		return nil, 0
+	}
+	points := []models.LatLon{{Lat: selected[0].Lat, Lon: selected[0].Lon}}
+	kept := selected[0].Distance
+	for i, r := range selected[1:] {
+		// Always end exactly at the last point of the selection
+		if r.Distance-kept >= segmentPointSpacing || i == len(selected)-2 {
+			points = append(points, models.LatLon{Lat: r.Lat, Lon: r.Lon})
+			kept = r.Distance
+		}
+	}
+	return points, selected[len(selected)-1].Distance - selected[0].Distance
+}
+
+// MatchSegment finds every pass of the records over the segment: the track must come
+// within segmentEndpointRadius of the start and later of the end, cover a plausible
+// distance in between, and follow the segment's path. Efforts don't overlap.
+func MatchSegment(records []models.Record, seg models.Segment) []SegmentEffort {
+	if len(seg.Points) < 2 || len(records) == 0 {
+		return nil
+	}
+	start, end := seg.Points[0], seg.Points[len(seg.Points)-1]
+	t0 := records[0].Time
+
+	var efforts []SegmentEffort
+	for i := 0; i < len(records); i++ {
+		if distanceTo(records[i], start) > segmentEndpointRadius {
+			continue
+		}
+		i = closestInRun(records, i, start)
+		j, ok := findSegmentEnd(records, i, seg.Length, end)
+		if !ok || !followsPath(records[i:j+1], seg.Points) {
+			continue
+		}
+		efforts = append(efforts, SegmentEffort{
+			Start:   records[i].Time.Sub(t0).Seconds(),
+			End:     records[j].Time.Sub(t0).Seconds(),
+			Elapsed: records[j].Time.Sub(records[i].Time).Seconds(),
+		})
+		i = j
+	}
+	return efforts
+}
+
+// distanceTo returns the distance (meters) from a record to a point, or +Inf when the
+// record has no position.
+func distanceTo(r models.Record, p models.LatLon) float64 {
+	if !r.HasPosition() {
+		return math.Inf(1)
+	}
+	return Haversine(r.Lat, r.Lon, p.Lat, p.Lon)
+}
+
+// closestInRun returns the record closest to p among the consecutive records from i
+// that stay within segmentEndpointRadius of it.
+func closestInRun(records []models.Record, i int, p models.LatLon) int {
+	best := i
+	for k := i + 1; k < len(records) && distanceTo(records[k], p) <= segmentEndpointRadius; k++ {
+		if distanceTo(records[k], p) < distanceTo(records[best], p) {
+			best = k
+		}
+	}
+	return best
+}
+
+// findSegmentEnd looks for the record after i where the effort reaches the segment end.
+func findSegmentEnd(records []models.Record, i int, length float64, end models.LatLon) (int, bool) {
+	for j := i + 1; j < len(records); j++ {
+		travel := records[j].Distance - records[i].Distance
+		if travel > length*segmentMaxTravel {
+			return 0, false
+		}
+		if travel >= length*segmentMinTravel && distanceTo(records[j], end) <= segmentEndpointRadius {
+			return closestInRun(records, j, end), true
+		}
+	}
+	return 0, false
+}
+
+// followsPath reports whether enough of the segment's points lie near the track.
+func followsPath(track []models.Record, points []models.LatLon) bool {
+	matched := 0
+	for _, p := range points {
+		for _, r := range track {
+			if distanceTo(r, p) <= segmentPathTolerance {
+				matched++
+				break
+			}
+		}
+	}
+	return float64(matched) >= segmentMinCoverage*float64(len(points))
+}
+
+// TrackBounds returns the bounding box of the positioned records, and false if there are none.
+func TrackBounds(records []models.Record) (minLat, minLon, maxLat, maxLon float64, ok bool) {
+	for _, r := range records {
+		if !r.HasPosition() {
+			continue
+		}
+		if !ok {
+			minLat, maxLat, minLon, maxLon, ok = r.Lat, r.Lat, r.Lon, r.Lon, true
+			continue
+		}
+		minLat, maxLat = min(minLat, r.Lat), max(maxLat, r.Lat)
+		minLon, maxLon = min(minLon, r.Lon), max(maxLon, r.Lon)
+	}
+	return
+}
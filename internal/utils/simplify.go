@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"math"
+	"strings"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// SimplifyLevel is one stored simplification of a track: the Douglas–Peucker tolerance
+// used for maps shown at zooms up to MaxZoom.
+type SimplifyLevel struct {
+	MaxZoom   int
+	Tolerance float64 // meters
+}
+
+// SimplifyLevels are the stored simplifications, coarsest first. The last level also
+// serves every deeper zoom; its tolerance is below what a screen pixel shows there.
+var SimplifyLevels = []SimplifyLevel{
+	{MaxZoom: 10, Tolerance: 40},
+	{MaxZoom: 13, Tolerance: 8},
+	{MaxZoom: 16, Tolerance: 2},
+}
+
+// SimplifyLevelFor returns the index of the level to draw a map at zoom with.
+func SimplifyLevelFor(zoom int) int {
+	for i, l := range SimplifyLevels {
+		if zoom <= l.MaxZoom {
+			return i
+		}
+	}
+	return len(SimplifyLevels) - 1
+}
+
+// TrackPoints returns the positions of a track's records.
+func TrackPoints(records []models.Record) []models.LatLon {
+	var points []models.LatLon
+	for _, r := range records {
+		if r.HasPosition() {
+			points = append(points, models.LatLon{Lat: r.Lat, Lon: r.Lon})
+		}
+	}
+	return points
+}
+
+// SimplifyTrack reduces a path with the Douglas–Peucker algorithm: every dropped point
+// lies within tolerance meters of the simplified line. The endpoints are always kept.
+func SimplifyTrack(points []models.LatLon, tolerance float64) []models.LatLon {
+	if len(points) < 3 {
+		return points
+	}
+	// Local equirectangular projection to meters, accurate enough at track scale
+	cosLat := math.Cos(points[0].Lat * math.Pi / 180)
+	const metersPerDegree = earthRadius * math.Pi / 180
+	xs := make([]float64, len(points))
+	ys := make([]float64, len(points))
+	for i, p := range points {
+		xs[i] = p.Lon * cosLat * metersPerDegree
+		ys[i] = p.Lat * metersPerDegree
+	}
+
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+	// Explicit stack: long tracks would recurse too deep
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		first, last := span[0], span[1]
+		best, bestDist := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(xs[i], ys[i], xs[first], ys[first], xs[last], ys[last]); d > bestDist {
+				best, bestDist = i, d
+			}
+		}
+		if best >= 0 {
+			keep[best] = true
+			stack = append(stack, [2]int{first, best}, [2]int{best, last})
+		}
+	}
+
+	var out []models.LatLon
+	for i, p := range points {
+		if keep[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// segmentDistance returns the distance from point p to the segment a-b.
+func segmentDistance(px, py, ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	if dx == 0 && dy == 0 {
+		return math.Hypot(px-ax, py-ay)
+	}
+	t := math.Max(0, math.Min(1, ((px-ax)*dx+(py-ay)*dy)/(dx*dx+dy*dy)))
+	return math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
+
+// EncodePolyline encodes a path in Google's encoded polyline format at 5 decimals.
+func EncodePolyline(points []models.LatLon) string {
+	var sb strings.Builder
+	var prevLat, prevLon int64
+	for _, p := range points {
+		lat, lon := int64(math.Round(p.Lat*1e5)), int64(math.Round(p.Lon*1e5))
+		encodePolylineValue(&sb, lat-prevLat)
+		encodePolylineValue(&sb, lon-prevLon)
+		prevLat, prevLon = lat, lon
+	}
+	return sb.String()
+}
+
+// encodePolylineValue appends one zigzag-encoded delta in 5-bit chunks.
+func encodePolylineValue(sb *strings.Builder, v int64) {
+	u := uint64(v << 1)
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		sb.WriteByte(byte((0x20 | (u & 0x1f)) + 63))
+		u >>= 5
+	}
+	sb.WriteByte(byte(u + 63))
+}
+
+// DecodePolyline decodes a path encoded by EncodePolyline.
+func DecodePolyline(s string) []models.LatLon {
+	var points []models.LatLon
+	var lat, lon int64
+	next := func(i *int) int64 {
+		var result uint64
+		var shift uint
+		for *i < len(s) {
+			b := uint64(s[*i]) - 63
+			*i++
+			result |= (b & 0x1f) << shift
+			shift += 5
+			if b < 0x20 {
+				break
+			}
+		}
+		if result&1 != 0 {
+			return ^int64(result >> 1)
+		}
+		return int64(result >> 1)
+	}
+	for i := 0; i < len(s); {
+		lat += next(&i)
+		lon += next(&i)
+		points = append(points, models.LatLon{Lat: float64(lat) / 1e5, Lon: float64(lon) / 1e5})
+	}
+	return points
+}
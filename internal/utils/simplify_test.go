@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// path builds points along the equator every 0.001° (about 111 m) of longitude, offset
+// north by the given number of meters.
+func path(offsets ...float64) []models.LatLon {
+	points := make([]models.LatLon, len(offsets))
+	for i, o := range offsets {
+		points[i] = models.LatLon{Lat: o / (earthRadius * math.Pi / 180), Lon: float64(i) * 0.001}
+	}
+	return points
+}
+
+func TestSimplifyTrack(t *testing.T) {
+	tests := []struct {
+		name      string
+		points    []models.LatLon
+		tolerance float64
+		want      []int // indexes of the points kept
+	}{
+		{"straight line", path(0, 0, 0, 0, 0), 1, []int{0, 4}},
+		{"bump within tolerance", path(0, 0, 5, 0, 0), 10, []int{0, 4}},
+		{"bump over tolerance", path(0, 0, 15, 0, 0), 10, []int{0, 2, 4}},
+		{"zigzag", path(0, 30, 0, 30, 0), 10, []int{0, 1, 2, 3, 4}},
+		{"small bump next to a large one", path(0, 40, 0, 4, 0), 10, []int{0, 1, 2, 4}},
+		{"two points", path(0, 50), 1, []int{0, 1}},
+		{"empty", nil, 1, nil},
+	}
+	for _, tt := range tests {
+		got := SimplifyTrack(tt.points, tt.tolerance)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: kept %d points, want %d: %v", tt.name, len(got), len(tt.want), got)
+			continue
+		}
+		for i, w := range tt.want {
+			if got[i] != tt.points[w] {
+				t.Errorf("%s: point %d = %v, want point %d %v", tt.name, i, got[i], w, tt.points[w])
+			}
+		}
+	}
+}
+
+func TestSimplifyLevelFor(t *testing.T) {
+	tests := []struct {
+		zoom, want int
+	}{
+		{0, 0},
+		{10, 0},
+		{11, 1},
+		{13, 1},
+		{16, 2},
+		{20, 2}, // deeper than any level
+	}
+	for _, tt := range tests {
+		if got := SimplifyLevelFor(tt.zoom); got != tt.want {
+			t.Errorf("SimplifyLevelFor(%d) = %d, want %d", tt.zoom, got, tt.want)
+		}
+	}
+}
+
+func TestPolyline(t *testing.T) {
+	tests := []struct {
+		name    string
+		points  []models.LatLon
+		encoded string // "" checks the round trip only
+	}{
+		// The example from Google's description of the format
+		{"reference", []models.LatLon{{Lat: 38.5, Lon: -120.2}, {Lat: 40.7, Lon: -120.95}, {Lat: 43.252, Lon: -126.453}}, "_p~iF~ps|U_ulLnnqC_mqNvxq`@"},
+		{"origin", []models.LatLon{{Lat: 0, Lon: 0}}, "??"},
+		{"southern and eastern", []models.LatLon{{Lat: -33.86882, Lon: 151.20929}, {Lat: -33.86882, Lon: 151.20929}}, ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		encoded := EncodePolyline(tt.points)
+		if tt.encoded != "" && encoded != tt.encoded {
+			t.Errorf("%s: encoded %q, want %q", tt.name, encoded, tt.encoded)
+		}
+		decoded := DecodePolyline(encoded)
+		if len(decoded) != len(tt.points) {
+			t.Errorf("%s: decoded %d points, want %d", tt.name, len(decoded), len(tt.points))
+			continue
+		}
+		for i, p := range tt.points {
+			if math.Abs(decoded[i].Lat-p.Lat) > 5e-6 || math.Abs(decoded[i].Lon-p.Lon) > 5e-6 {
+				t.Errorf("%s: point %d decoded as %v, want %v", tt.name, i, decoded[i], p)
+			}
+		}
+	}
+}
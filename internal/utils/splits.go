@@ -0,0 +1,101 @@
+package utils
+
+import "github.com/gratten/ownpath/internal/models"
+
+// minPartialSplit is the shortest trailing partial split (meters) worth reporting.
+const minPartialSplit = 10.0
+
+// Split is one automatic distance split (1 km or 1 mile) of an activity.
+type Split struct {
+	Index           int     `json:"index"`           // 1-based
+	Distance        float64 `json:"distance"`        // meters; the last split may be partial
+	Time            float64 `json:"time"`            // moving time in seconds
+	Pace            float64 `json:"pace"`            // seconds per distance unit
+	ElevationChange float64 `json:"elevationChange"` // meters, end minus start (smoothed altitude)
+	AvgHeartRate    float64 `json:"avgHeartRate"`    // bpm, 0 without a heart-rate sensor
+	GAP             float64 `json:"gap"`             // grade-adjusted seconds per distance unit
+}
+
+// splitBuilder accumulates one split while walking the record stream.
+type splitBuilder struct {
+	split    Split
+	startAlt float64
+	hrSum    float64
+	hrTime   float64
+	flatDist float64
+}
+
+func (b *splitBuilder) add(dist, dt float64, moving bool, hr uint8, grade float64) {
+	b.split.Distance += dist
+	if moving {
+		b.split.Time += dt
+	}
+	if hr > 0 {
+		b.hrSum += float64(hr) * dt
+		b.hrTime += dt
+	}
+	b.flatDist += dist * GradeFactor(grade)
+}
+
+func (b *splitBuilder) finish(endAlt float64, unitLength float64) Split {
+	s := b.split
+	s.ElevationChange = endAlt - b.startAlt
+	if s.Distance > 0 {
+		s.Pace = s.Time / s.Distance * unitLength
+	}
+	if b.flatDist > 0 {
+		s.GAP = s.Time / b.flatDist * unitLength
+	}
+	if b.hrTime > 0 {
+		s.AvgHeartRate = b.hrSum / b.hrTime
+	}
+	return s
+}
+
+// ComputeSplits cuts the record stream into consecutive splits of unitLength meters
+// (see UnitLength). Intervals crossing a split boundary are divided proportionally.
+func ComputeSplits(records []models.Record, sport string, unitLength float64) []Split {
+	if len(records) < 2 || unitLength <= 0 {
+		return nil
+	}
+	threshold := MovingSpeedThreshold(sport)
+	grades := GradeStream(records)
+	alt := SmoothAltitude(records)
+	if alt == nil {
+		alt = make([]float64, len(records)) // no elevation: every change reads 0
+	}
+
+	var splits []Split
+	b := &splitBuilder{split: Split{Index: 1}, startAlt: alt[0]}
+	boundary := records[0].Distance + unitLength // the distance stream need not start at 0
+
+	for i := 1; i < len(records); i++ {
+		prev, rec := records[i-1], records[i]
+		dd := rec.Distance - prev.Distance
+		if dd < 0 {
+			dd = 0
+		}
+		dt := rec.Time.Sub(prev.Time).Seconds()
+		moving := isMovingInterval(prev, rec, threshold)
+
+		pos := prev.Distance
+		for dd > 0 && rec.Distance >= boundary {
+			f := (boundary - pos) / dd
+			b.add(boundary-pos, f*dt, moving, rec.HeartRate, grades[i])
+
+			endAlt := alt[i-1] + (boundary-prev.Distance)/(rec.Distance-prev.Distance)*(alt[i]-alt[i-1])
+			splits = append(splits, b.finish(endAlt, unitLength))
+			b = &splitBuilder{split: Split{Index: len(splits) + 1}, startAlt: endAlt}
+
+			dt -= f * dt
+			dd -= boundary - pos
+			pos = boundary
+			boundary += unitLength
+		}
+		b.add(dd, dt, moving, rec.HeartRate, grades[i])
+	}
+	if b.split.Distance >= minPartialSplit {
+		splits = append(splits, b.finish(alt[len(alt)-1], unitLength))
+	}
+	return splits
+}
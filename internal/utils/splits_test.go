@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// leg is a stretch of constant speed (m/s) lasting seconds; speed 0 is a stop.
+type leg struct {
+	seconds float64
+	speed   float64
+}
+
+// splitTrack builds a record every 10 s (and at the end of each leg) from startDist on.
+func splitTrack(startDist float64, legs ...leg) []models.Record {
+	t := time.Date(2024, 5, 4, 8, 0, 0, 0, time.UTC)
+	dist := startDist
+	records := []models.Record{{Time: t, Distance: dist}}
+	for _, l := range legs {
+		for left := l.seconds; left > 0; {
+			step := math.Min(10, left)
+			t = t.Add(time.Duration(step * float64(time.Second)))
+			dist += l.speed * step
+			records = append(records, models.Record{Time: t, Distance: dist})
+			left -= step
+		}
+	}
+	return records
+}
+
+// withGap drops records[from:to], as when the device stopped recording.
+func withGap(records []models.Record, from, to int) []models.Record {
+	return append(records[:from:from], records[to:]...)
+}
+
+func TestComputeSplits(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []models.Record
+		want    []Split // only Index, Distance and Time are compared
+	}{
+		{
+			name:    "whole splits",
+			records: splitTrack(0, leg{500, 4}),
+			want:    []Split{{Index: 1, Distance: 1000, Time: 250}, {Index: 2, Distance: 1000, Time: 250}},
+		},
+		{
+			name:    "partial last split",
+			records: splitTrack(0, leg{625, 4}),
+			want: []Split{
+				{Index: 1, Distance: 1000, Time: 250},
+				{Index: 2, Distance: 1000, Time: 250},
+				{Index: 3, Distance: 500, Time: 125},
+			},
+		},
+		{
+			name:    "partial split too short to report",
+			records: splitTrack(0, leg{501, 4}),
+			want:    []Split{{Index: 1, Distance: 1000, Time: 250}, {Index: 2, Distance: 1000, Time: 250}},
+		},
+		{
+			name:    "stop inside a split",
+			records: splitTrack(0, leg{125, 4}, leg{60, 0}, leg{375, 4}),
+			want:    []Split{{Index: 1, Distance: 1000, Time: 250}, {Index: 2, Distance: 1000, Time: 250}},
+		},
+		{
+			// No records from 200 s to 260 s: the 240 m covered then count as distance only
+			name:    "recording gap across a boundary",
+			records: withGap(splitTrack(0, leg{500, 4}), 21, 26),
+			want:    []Split{{Index: 1, Distance: 1000, Time: 200}, {Index: 2, Distance: 1000, Time: 240}},
+		},
+		{
+			name:    "non-zero start",
+			records: splitTrack(5000, leg{625, 4}),
+			want: []Split{
+				{Index: 1, Distance: 1000, Time: 250},
+				{Index: 2, Distance: 1000, Time: 250},
+				{Index: 3, Distance: 500, Time: 125},
+			},
+		},
+		{
+			name:    "too few records",
+			records: splitTrack(0),
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		got := ComputeSplits(tt.records, "Running", 1000)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d splits, want %d: %+v", tt.name, len(got), len(tt.want), got)
+			continue
+		}
+		for i, w := range tt.want {
+			g := got[i]
+			if g.Index != w.Index || math.Abs(g.Distance-w.Distance) > 1e-6 || math.Abs(g.Time-w.Time) > 1e-6 {
+				t.Errorf("%s: split %d = {%d %.2f m %.2f s}, want {%d %.2f m %.2f s}",
+					tt.name, i+1, g.Index, g.Distance, g.Time, w.Index, w.Distance, w.Time)
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+)
+
+// Chart layout margins (pixels) around the plot area.
+const (
+	chartMarginLeft   = 50
+	chartMarginRight  = 10
+	chartMarginTop    = 20
+	chartMarginBottom = 25
+	chartTicks        = 4
+)
+
+// ChartSeries is one line of a chart. X and Y must have the same length.
+type ChartSeries struct {
+	Name  string
+	Color string
+	X     []float64
+	Y     []float64
+	Fill  bool // shade the area under the line
+}
+
+// ChartBand highlights an x range of a chart, e.g. a climb on an elevation profile.
+type ChartBand struct {
+	From  float64
+	To    float64
+	Label string
+	Color string
+}
+
+// ChartOptions controls the size and axis labels of a chart.
+type ChartOptions struct {
+	Width   int
+	Height  int
+	XFormat func(float64) string // tick label for an x value
+	YFormat func(float64) string // tick label for a y value
+	Bands   []ChartBand          // shaded behind the series
+	NonNeg  bool                 // values are never negative: don't pad the y axis below 0
+}
+
+// LineChartSVG renders series as an inline SVG line chart with gridlines, axis labels and
+// a legend. All series share both axes.
+func LineChartSVG(opts ChartOptions, series ...ChartSeries) string {
+	if opts.XFormat == nil {
+		opts.XFormat = func(v float64) string { return fmt.Sprintf("%.0f", v) }
+	}
+	if opts.YFormat == nil {
+		opts.YFormat = func(v float64) string { return fmt.Sprintf("%.0f", v) }
+	}
+
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		for i := range s.X {
+			minX, maxX = math.Min(minX, s.X[i]), math.Max(maxX, s.X[i])
+			minY, maxY = math.Min(minY, s.Y[i]), math.Max(maxY, s.Y[i])
+		}
+	}
+	if math.IsInf(minX, 0) {
+		return ""
+	}
+	if maxX == minX {
+		maxX = minX + 1
+	}
+	if maxY == minY {
+		maxY = minY + 1
+	}
+	pad := (maxY - minY) * 0.05
+	minY, maxY = minY-pad, maxY+pad
+	if opts.NonNeg && minY < 0 {
+		minY = 0
+	}
+
+	plotW := float64(opts.Width - chartMarginLeft - chartMarginRight)
+	plotH := float64(opts.Height - chartMarginTop - chartMarginBottom)
+	px := func(x float64) float64 { return chartMarginLeft + (x-minX)/(maxX-minX)*plotW }
+	py := func(y float64) float64 { return chartMarginTop + (maxY-y)/(maxY-minY)*plotH }
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg class="chart" viewBox="0 0 %d %d" width="100%%" preserveAspectRatio="none" xmlns="http://www.w3.org/2000/svg">`, opts.Width, opts.Height)
+
+	// Gridlines and tick labels
+	for i := 0; i <= chartTicks; i++ {
+		y := minY + (maxY-minY)*float64(i)/chartTicks
+		fmt.Fprintf(&sb, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#ddd"/>`, chartMarginLeft, py(y), opts.Width-chartMarginRight, py(y))
+		fmt.Fprintf(&sb, `<text x="%d" y="%.1f" font-size="10" text-anchor="end" fill="#666">%s</text>`, chartMarginLeft-4, py(y)+3, html.EscapeString(opts.YFormat(y)))
+		x := minX + (maxX-minX)*float64(i)/chartTicks
+		fmt.Fprintf(&sb, `<text x="%.1f" y="%d" font-size="10" text-anchor="middle" fill="#666">%s</text>`, px(x), opts.Height-6, html.EscapeString(opts.XFormat(x)))
+	}
+	if minY < 0 && maxY > 0 {
+		fmt.Fprintf(&sb, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#999"/>`, chartMarginLeft, py(0), opts.Width-chartMarginRight, py(0))
+	}
+
+	for _, b := range opts.Bands {
+		x1, x2 := px(math.Max(b.From, minX)), px(math.Min(b.To, maxX))
+		fmt.Fprintf(&sb, `<rect x="%.1f" y="%d" width="%.1f" height="%.1f" fill="%s" fill-opacity="0.15"/>`,
+			x1, chartMarginTop, math.Max(x2-x1, 1), plotH, b.Color)
+		if b.Label != "" {
+			fmt.Fprintf(&sb, `<text x="%.1f" y="%d" font-size="10" text-anchor="middle" fill="%s">%s</text>`,
+				(x1+x2)/2, chartMarginTop+10, b.Color, html.EscapeString(b.Label))
+		}
+	}
+
+	for i, s := range series {
+		if len(s.X) == 0 {
+			continue
+		}
+		var pts strings.Builder
+		for j := range s.X {
+			fmt.Fprintf(&pts, "%.1f,%.1f ", px(s.X[j]), py(s.Y[j]))
+		}
+		if s.Fill {
+			base := py(math.Max(minY, 0))
+			fmt.Fprintf(&sb, `<polygon points="%.1f,%.1f %s%.1f,%.1f" fill="%s" fill-opacity="0.2" stroke="none"/>`,
+				px(s.X[0]), base, pts.String(), px(s.X[len(s.X)-1]), base, s.Color)
+		}
+		fmt.Fprintf(&sb, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"/>`, strings.TrimSpace(pts.String()), s.Color)
+		fmt.Fprintf(&sb, `<text x="%d" y="12" font-size="11" fill="%s">%s</text>`, chartMarginLeft+i*90, s.Color, html.EscapeString(s.Name))
+	}
+	sb.WriteString(`</svg>`)
+	return sb.String()
+}
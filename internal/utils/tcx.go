@@ -0,0 +1,290 @@
+package utils
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// TCX namespaces of exported documents.
+const (
+	tcxNamespace  = "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"
+	tcxNamespace3 = "http://www.garmin.com/xmlschemas/ActivityExtension/v2"
+	tcxSchemas    = tcxNamespace + " http://www.garmin.com/xmlschemas/TrainingCenterDatabasev2.xsd"
+)
+
+// tcxFile mirrors the parts of a TCX document OwnPath imports. Element names match
+// regardless of namespace prefix.
+type tcxFile struct {
+	Activities []struct {
+		Sport string `xml:"Sport,attr"`
+		ID    string `xml:"Id"`
+		Notes string `xml:"Notes"`
+		Laps  []struct {
+			TotalTimeSeconds float64 `xml:"TotalTimeSeconds"`
+			Tracks           []struct {
+				Points []tcxPoint `xml:"Trackpoint"`
+			} `xml:"Track"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+type tcxPoint struct {
+	Time     string `xml:"Time"`
+	Position *struct {
+		Lat float64 `xml:"LatitudeDegrees"`
+		Lon float64 `xml:"LongitudeDegrees"`
+	} `xml:"Position"`
+	Altitude   *float64 `xml:"AltitudeMeters"`
+	Distance   *float64 `xml:"DistanceMeters"`
+	HeartRate  *float64 `xml:"HeartRateBpm>Value"`
+	Cadence    *float64 `xml:"Cadence"`
+	Extensions struct {
+		TPX struct {
+			Speed      *float64 `xml:"Speed"`
+			Watts      *float64 `xml:"Watts"`
+			RunCadence *float64 `xml:"RunCadence"`
+		} `xml:"TPX"`
+	} `xml:"Extensions"`
+}
+
+// ImportedTCX is a TCX activity converted to OwnPath's record stream.
+type ImportedTCX struct {
+	Sport       string
+	StartTime   time.Time
+	Records     []models.Record
+	TimerEvents []TimerEvent // one start/stop pair per track
+	TimerTime   float64      // sum of the laps' TotalTimeSeconds
+}
+
+// ParseTCX reads the first activity of a TCX document. Like GPX, points without a
+// timestamp are dropped and each track becomes a timer start/stop pair.
+func ParseTCX(r io.Reader) (*ImportedTCX, error) {
+	var doc tcxFile
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid TCX: %w", err)
+	}
+	if len(doc.Activities) == 0 {
+		return nil, fmt.Errorf("TCX contains no activity")
+	}
+	act := doc.Activities[0]
+
+	imp := &ImportedTCX{Sport: SportFromName(act.Sport)}
+	if fields := strings.Fields(act.Notes); imp.Sport == "Unknown" && len(fields) > 0 {
+		// TCX only knows Running and Biking; OwnPath's exports name the sport in Notes
+		imp.Sport = SportFromName(fields[0])
+	}
+	for _, lap := range act.Laps {
+		imp.TimerTime += lap.TotalTimeSeconds
+		for _, trk := range lap.Tracks {
+			var trkStart, trkEnd time.Time
+			for _, pt := range trk.Points {
+				t, err := time.Parse(time.RFC3339, strings.TrimSpace(pt.Time))
+				if err != nil {
+					continue
+				}
+				rec := models.Record{Time: t.UTC(), Altitude: pt.Altitude}
+				if pt.Position != nil {
+					rec.Lat, rec.Lon = pt.Position.Lat, pt.Position.Lon
+				}
+				if pt.Distance != nil {
+					rec.Distance = *pt.Distance
+				}
+				if v := pt.Extensions.TPX.Speed; v != nil && *v >= 0 {
+					rec.Speed = *v
+				}
+				if v := pt.HeartRate; v != nil && *v > 0 && *v < 256 {
+					rec.HeartRate = uint8(*v)
+				}
+				cad := pt.Cadence
+				if cad == nil {
+					cad = pt.Extensions.TPX.RunCadence
+				}
+				if cad != nil && *cad > 0 && *cad < 256 {
+					rec.Cadence = uint8(*cad)
+				}
+				if v := pt.Extensions.TPX.Watts; v != nil && *v > 0 && *v < 65535 {
+					rec.Power = uint16(*v)
+				}
+				imp.Records = append(imp.Records, rec)
+				if trkStart.IsZero() {
+					trkStart = rec.Time
+				}
+				trkEnd = rec.Time
+			}
+			if !trkStart.IsZero() {
+				imp.TimerEvents = append(imp.TimerEvents,
+					TimerEvent{Time: trkStart, Start: true}, TimerEvent{Time: trkEnd, Start: false})
+			}
+		}
+	}
+	if len(imp.Records) == 0 {
+		return nil, fmt.Errorf("TCX contains no timestamped track points")
+	}
+
+	sort.SliceStable(imp.Records, func(i, j int) bool { return imp.Records[i].Time.Before(imp.Records[j].Time) })
+	imp.StartTime = imp.Records[0].Time
+	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(act.ID)); err == nil && t.Before(imp.StartTime) {
+		imp.StartTime = t.UTC()
+	}
+	EnsureDistance(imp.Records)
+	return imp, nil
+}
+
+// tcxOut is the TCX document OwnPath exports (elements in schema order).
+type tcxOut struct {
+	XMLName        xml.Name `xml:"TrainingCenterDatabase"`
+	Xmlns          string   `xml:"xmlns,attr"`
+	XmlnsNs3       string   `xml:"xmlns:ns3,attr"`
+	XmlnsXsi       string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	Activity       struct {
+		Sport string      `xml:"Sport,attr"`
+		ID    string      `xml:"Id"`
+		Laps  []tcxOutLap `xml:"Lap"`
+		Notes string      `xml:"Notes,omitempty"`
+	} `xml:"Activities>Activity"`
+}
+
+type tcxOutLap struct {
+	StartTime        string        `xml:"StartTime,attr"`
+	TotalTimeSeconds float64       `xml:"TotalTimeSeconds"`
+	DistanceMeters   float64       `xml:"DistanceMeters"`
+	MaximumSpeed     *float64      `xml:"MaximumSpeed,omitempty"`
+	Calories         int           `xml:"Calories"`
+	AvgHeartRate     *tcxOutValue  `xml:"AverageHeartRateBpm,omitempty"`
+	MaxHeartRate     *tcxOutValue  `xml:"MaximumHeartRateBpm,omitempty"`
+	Intensity        string        `xml:"Intensity"`
+	TriggerMethod    string        `xml:"TriggerMethod"`
+	Track            []tcxOutPoint `xml:"Track>Trackpoint"`
+}
+
+type tcxOutValue struct {
+	Value uint8 `xml:"Value"`
+}
+
+type tcxOutPoint struct {
+	Time       string            `xml:"Time"`
+	Position   *tcxOutPosition   `xml:"Position,omitempty"`
+	Altitude   *float64          `xml:"AltitudeMeters,omitempty"`
+	Distance   float64           `xml:"DistanceMeters"`
+	HeartRate  *tcxOutValue      `xml:"HeartRateBpm,omitempty"`
+	Cadence    *uint8            `xml:"Cadence,omitempty"`
+	Extensions *tcxOutExtensions `xml:"Extensions,omitempty"`
+}
+
+type tcxOutPosition struct {
+	Lat float64 `xml:"LatitudeDegrees"`
+	Lon float64 `xml:"LongitudeDegrees"`
+}
+
+// tcxOutExtensions carries speed and power in Garmin's ActivityExtension.
+type tcxOutExtensions struct {
+	TPX struct {
+		Speed float64 `xml:"ns3:Speed"`
+		Watts *uint16 `xml:"ns3:Watts,omitempty"`
+	} `xml:"ns3:TPX"`
+}
+
+// tcxSport maps an OwnPath sport name to the three sports TCX knows.
+func tcxSport(sport string) string {
+	switch sport {
+	case "Running":
+		return "Running"
+	case "Cycling":
+		return "Biking"
+	default:
+		return "Other"
+	}
+}
+
+// tcxLap summarizes one recording stretch as a TCX lap with its trackpoints.
+func tcxLap(part []models.Record) tcxOutLap {
+	first, last := part[0], part[len(part)-1]
+	lap := tcxOutLap{
+		StartTime:        first.Time.UTC().Format(time.RFC3339),
+		TotalTimeSeconds: last.Time.Sub(first.Time).Seconds(),
+		DistanceMeters:   math.Round((last.Distance-first.Distance)*10) / 10,
+		Intensity:        "Active",
+		TriggerMethod:    "Manual",
+	}
+	var maxSpeed float64
+	var hrSum, hrCount int
+	var hrMax uint8
+	for _, r := range part {
+		pt := tcxOutPoint{Time: r.Time.UTC().Format(time.RFC3339), Distance: math.Round(r.Distance*10) / 10}
+		if r.HasPosition() {
+			pt.Position = &tcxOutPosition{r.Lat, r.Lon}
+		}
+		alt := r.Altitude
+		if alt == nil {
+			alt = r.DEMAltitude
+		}
+		if alt != nil {
+			ele := math.Round(*alt*10) / 10
+			pt.Altitude = &ele
+		}
+		if r.HeartRate > 0 {
+			pt.HeartRate = &tcxOutValue{r.HeartRate}
+			hrSum += int(r.HeartRate)
+			hrCount++
+			hrMax = max(hrMax, r.HeartRate)
+		}
+		if r.Cadence > 0 {
+			pt.Cadence = &r.Cadence
+		}
+		if r.Speed > 0 || r.Power > 0 {
+			pt.Extensions = &tcxOutExtensions{}
+			pt.Extensions.TPX.Speed = math.Round(r.Speed*1000) / 1000
+			if r.Power > 0 {
+				pt.Extensions.TPX.Watts = &r.Power
+			}
+		}
+		maxSpeed = math.Max(maxSpeed, r.Speed)
+		lap.Track = append(lap.Track, pt)
+	}
+	if maxSpeed > 0 {
+		maxSpeed = math.Round(maxSpeed*1000) / 1000
+		lap.MaximumSpeed = &maxSpeed
+	}
+	if hrCount > 0 {
+		lap.AvgHeartRate = &tcxOutValue{uint8(math.Round(float64(hrSum) / float64(hrCount)))}
+		lap.MaxHeartRate = &tcxOutValue{hrMax}
+	}
+	return lap
+}
+
+// WriteTCX writes an activity as a TrainingCenterDatabase v2 document with one lap per
+// part, so pauses between parts show as gaps between laps. Speed and power go in the
+// ActivityExtension TPX element; elevation falls back to the terrain model's.
+func WriteTCX(w io.Writer, name, sport string, start time.Time, parts [][]models.Record) error {
+	doc := tcxOut{
+		Xmlns:          tcxNamespace,
+		XmlnsNs3:       tcxNamespace3,
+		XmlnsXsi:       "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: tcxSchemas,
+	}
+	doc.Activity.Sport = tcxSport(sport)
+	doc.Activity.ID = start.UTC().Format(time.RFC3339)
+	doc.Activity.Notes = name
+	for _, part := range parts {
+		if len(part) > 0 {
+			doc.Activity.Laps = append(doc.Activity.Laps, tcxLap(part))
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode tcx: %w", err)
+	}
+	return enc.Close()
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// Thumbnail dimensions in pixels.
+const (
+	ThumbnailWidth  = 160
+	ThumbnailHeight = 120
+)
+
+// thumbnailPadding keeps the track clear of the thumbnail's edges.
+const thumbnailPadding = 8
+
+// thumbnailMaxZoom is the deepest zoom a thumbnail is drawn at, so short tracks aren't
+// magnified into a blob.
+const thumbnailMaxZoom = 17
+
+var (
+	thumbnailBackground = color.NRGBA{R: 0xf4, G: 0xf4, B: 0xf4, A: 0xff}
+	thumbnailTrack      = color.NRGBA{R: 0x19, G: 0x76, B: 0xd2, A: 0xff}
+	thumbnailStart      = color.NRGBA{R: 0x2e, G: 0x7d, B: 0x32, A: 0xff}
+	thumbnailEnd        = color.NRGBA{R: 0xc6, G: 0x28, B: 0x28, A: 0xff}
+)
+
+// RenderThumbnail draws an activity's track, given as the stretches to show, as a small
+// PNG fitted and centered at the deepest web-mercator zoom that holds it. No line joins
+// one stretch to the next. With markers, the start and end are marked. When tiles is a
+// raster tile source covering that zoom, its tiles are drawn underneath; tiles it lacks
+// are left blank. It returns nil when the track has no positions.
+func RenderThumbnail(parts [][]models.Record, markers bool, tiles TileSource) ([]byte, error) {
+	var positioned [][]models.Record
+	minLat, maxLat, minLon, maxLon := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+	for _, part := range parts {
+		var points []models.Record
+		for _, r := range part {
+			if !r.HasPosition() {
+				continue
+			}
+			points = append(points, r)
+			minLat, maxLat = math.Min(minLat, r.Lat), math.Max(maxLat, r.Lat)
+			minLon, maxLon = math.Min(minLon, r.Lon), math.Max(maxLon, r.Lon)
+		}
+		if len(points) > 0 {
+			positioned = append(positioned, points)
+		}
+	}
+	if len(positioned) == 0 {
+		return nil, nil
+	}
+
+	// Deepest zoom at which the bounding box fits inside the padded thumbnail
+	zoom := thumbnailMaxZoom
+	var x0, y0, x1, y1 float64
+	for ; zoom > 0; zoom-- {
+		x0, y1 = MercatorPixel(minLat, minLon, zoom)
+		x1, y0 = MercatorPixel(maxLat, maxLon, zoom)
+		if x1-x0 <= ThumbnailWidth-2*thumbnailPadding && y1-y0 <= ThumbnailHeight-2*thumbnailPadding {
+			break
+		}
+	}
+	x0, y1 = MercatorPixel(minLat, minLon, zoom)
+	x1, y0 = MercatorPixel(maxLat, maxLon, zoom)
+	// Global pixel of the thumbnail's top-left corner
+	originX := math.Floor((x0+x1)/2 - ThumbnailWidth/2)
+	originY := math.Floor((y0+y1)/2 - ThumbnailHeight/2)
+
+	img := image.NewNRGBA(image.Rect(0, 0, ThumbnailWidth, ThumbnailHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(thumbnailBackground), image.Point{}, draw.Src)
+	// The base map only shows when the archive has tiles at this zoom; image/* can't
+	// decode webp
+	if tiles != nil {
+		info := tiles.Info()
+		if (info.Format == "png" || info.Format == "jpg") && zoom >= info.MinZoom && zoom <= info.MaxZoom {
+			drawTiles(img, tiles, zoom, int(originX), int(originY))
+		}
+	}
+
+	for _, points := range positioned {
+		var prevX, prevY float64
+		for i, r := range points {
+			x, y := MercatorPixel(r.Lat, r.Lon, zoom)
+			x, y = x-originX, y-originY
+			if i > 0 {
+				drawLine(img, prevX, prevY, x, y, 1.2, thumbnailTrack)
+			}
+			prevX, prevY = x, y
+		}
+	}
+	if markers {
+		first, last := positioned[0], positioned[len(positioned)-1]
+		sx, sy := MercatorPixel(first[0].Lat, first[0].Lon, zoom)
+		fillCircle(img, sx-originX, sy-originY, 3, thumbnailStart)
+		ex, ey := MercatorPixel(last[len(last)-1].Lat, last[len(last)-1].Lon, zoom)
+		fillCircle(img, ex-originX, ey-originY, 3, thumbnailEnd)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawTiles copies the base map tiles covering the thumbnail, whose top-left corner is
+// global pixel (originX, originY) at zoom, into img.
+func drawTiles(img *image.NRGBA, tiles TileSource, zoom, originX, originY int) {
+	n := 1 << zoom
+	for ty := originY / TileSize; ty*TileSize < originY+ThumbnailHeight; ty++ {
+		for tx := originX / TileSize; tx*TileSize < originX+ThumbnailWidth; tx++ {
+			if tx < 0 || ty < 0 || tx >= n || ty >= n {
+				continue
+			}
+			data, err := tiles.Tile(zoom, tx, ty)
+			if err != nil || data == nil {
+				continue
+			}
+			var tile image.Image
+			if tiles.Info().Format == "jpg" {
+				tile, err = jpeg.Decode(bytes.NewReader(data))
+			} else {
+				tile, err = png.Decode(bytes.NewReader(data))
+			}
+			if err != nil {
+				continue
+			}
+			at := image.Pt(tx*TileSize-originX, ty*TileSize-originY)
+			draw.Draw(img, tile.Bounds().Add(at), tile, tile.Bounds().Min, draw.Over)
+		}
+	}
+}
+
+// drawLine draws a line of the given half-width by stamping discs along it.
+func drawLine(img *image.NRGBA, x0, y0, x1, y1, radius float64, c color.NRGBA) {
+	steps := math.Ceil(math.Max(math.Abs(x1-x0), math.Abs(y1-y0)) * 2)
+	for s := 0.0; s <= steps; s++ {
+		t := 0.0
+		if steps > 0 {
+			t = s / steps
+		}
+		fillCircle(img, x0+(x1-x0)*t, y0+(y1-y0)*t, radius, c)
+	}
+}
+
+// fillCircle fills a disc centered on (cx, cy).
+func fillCircle(img *image.NRGBA, cx, cy, radius float64, c color.NRGBA) {
+	b := img.Bounds()
+	for y := int(math.Floor(cy - radius)); y <= int(math.Ceil(cy+radius)); y++ {
+		for x := int(math.Floor(cx - radius)); x <= int(math.Ceil(cx+radius)); x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			if dx*dx+dy*dy <= radius*radius && image.Pt(x, y).In(b) {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+}
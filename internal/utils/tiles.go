@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// TileInfo describes the tiles of a tile archive.
+type TileInfo struct {
+	Format      string `json:"format"` // "png", "jpg", "webp" or "pbf"
+	MinZoom     int    `json:"minzoom"`
+	MaxZoom     int    `json:"maxzoom"`
+	Name        string `json:"name,omitempty"`
+	Attribution string `json:"attribution,omitempty"`
+	Gzipped     bool   `json:"-"` // tile data is gzip-compressed (vector tiles usually are)
+}
+
+// Raster reports whether the tiles are images a plain tile layer can show.
+func (i TileInfo) Raster() bool {
+	return i.Format == "png" || i.Format == "jpg" || i.Format == "webp"
+}
+
+// ContentType returns the MIME type of the tiles.
+func (i TileInfo) ContentType() string {
+	switch i.Format {
+	case "png":
+		return "image/png"
+	case "jpg":
+		return "image/jpeg"
+	case "webp":
+		return "image/webp"
+	case "pbf":
+		return "application/x-protobuf"
+	}
+	return "application/octet-stream"
+}
+
+// TileSource is a local archive of map tiles in XYZ addressing. Tile returns nil data
+// (and no error) for a tile the archive doesn't have.
+type TileSource interface {
+	Info() TileInfo
+	Tile(z, x, y int) ([]byte, error)
+	Close() error
+}
+
+// PMTiles v3 constants.
+const (
+	pmtilesHeaderLen   = 127
+	pmtilesCompNone    = 1
+	pmtilesCompGzip    = 2
+	pmtilesMaxDepth    = 4  // directory levels followed before giving up
+	pmtilesLeafCache   = 64 // leaf directories kept in memory
+	pmtilesMaxDirBytes = 16 << 20
+)
+
+// pmtilesEntry is one directory entry: a run of tiles, or a leaf directory when
+// RunLength is 0.
+type pmtilesEntry struct {
+	TileID    uint64
+	Offset    uint64
+	Length    uint64
+	RunLength uint64
+}
+
+// PMTiles reads tiles from a PMTiles v3 archive.
+type PMTiles struct {
+	f            *os.File
+	info         TileInfo
+	internalComp byte
+	leafOffset   uint64
+	dataOffset   uint64
+	root         []pmtilesEntry
+
+	mu     sync.Mutex
+	leaves map[uint64][]pmtilesEntry
+}
+
+// OpenPMTiles opens a PMTiles v3 archive and reads its root directory.
+func OpenPMTiles(path string) (*PMTiles, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, pmtilesHeaderLen)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read pmtiles header: %w", err)
+	}
+	if string(header[:7]) != "PMTiles" || header[7] != 3 {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a PMTiles v3 archive", path)
+	}
+	u64 := func(off int) uint64 { return binary.LittleEndian.Uint64(header[off:]) }
+
+	p := &PMTiles{
+		f:            f,
+		internalComp: header[97],
+		leafOffset:   u64(40),
+		dataOffset:   u64(56),
+		leaves:       make(map[uint64][]pmtilesEntry),
+	}
+	p.info = TileInfo{MinZoom: int(header[100]), MaxZoom: int(header[101]), Gzipped: header[98] == pmtilesCompGzip}
+	switch header[99] {
+	case 1:
+		p.info.Format = "pbf"
+	case 2:
+		p.info.Format = "png"
+	case 3:
+		p.info.Format = "jpg"
+	case 4:
+		p.info.Format = "webp"
+	default:
+		f.Close()
+		return nil, fmt.Errorf("unsupported pmtiles tile type %d", header[99])
+	}
+	if tc := header[98]; tc != pmtilesCompNone && tc != pmtilesCompGzip && tc != 0 {
+		f.Close()
+		return nil, fmt.Errorf("unsupported pmtiles tile compression %d", tc)
+	}
+	if p.root, err = p.readDirectory(u64(8), u64(16)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Info returns the archive's tile format and zoom range.
+func (p *PMTiles) Info() TileInfo { return p.info }
+
+// Close closes the archive file.
+func (p *PMTiles) Close() error { return p.f.Close() }
+
+// readDirectory reads and decodes the directory stored at offset.
+func (p *PMTiles) readDirectory(offset, length uint64) ([]pmtilesEntry, error) {
+	if length > pmtilesMaxDirBytes {
+		return nil, fmt.Errorf("pmtiles directory too large (%d bytes)", length)
+	}
+	raw := make([]byte, length)
+	if _, err := p.f.ReadAt(raw, int64(offset)); err != nil {
+		return nil, fmt.Errorf("failed to read pmtiles directory: %w", err)
+	}
+	switch p.internalComp {
+	case pmtilesCompNone, 0:
+	case pmtilesCompGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress pmtiles directory: %w", err)
+		}
+		if raw, err = io.ReadAll(io.LimitReader(zr, pmtilesMaxDirBytes)); err != nil {
+			return nil, fmt.Errorf("failed to decompress pmtiles directory: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported pmtiles directory compression %d", p.internalComp)
+	}
+	return decodePMTilesDirectory(raw)
+}
+
+// decodePMTilesDirectory decodes the columnar varint encoding of a directory.
+func decodePMTilesDirectory(raw []byte) ([]pmtilesEntry, error) {
+	r := bytes.NewReader(raw)
+	next := func() (uint64, error) { return binary.ReadUvarint(r) }
+	n, err := next()
+	if err != nil || n > uint64(len(raw)) {
+		return nil, fmt.Errorf("invalid pmtiles directory")
+	}
+	entries := make([]pmtilesEntry, n)
+	var id uint64
+	for i := range entries {
+		v, err := next()
+		if err != nil {
+			return nil, fmt.Errorf("invalid pmtiles directory: %w", err)
+		}
+		id += v
+		entries[i].TileID = id
+	}
+	for i := range entries {
+		if entries[i].RunLength, err = next(); err != nil {
+			return nil, fmt.Errorf("invalid pmtiles directory: %w", err)
+		}
+	}
+	for i := range entries {
+		if entries[i].Length, err = next(); err != nil {
+			return nil, fmt.Errorf("invalid pmtiles directory: %w", err)
+		}
+	}
+	for i := range entries {
+		v, err := next()
+		if err != nil {
+			return nil, fmt.Errorf("invalid pmtiles directory: %w", err)
+		}
+		// 0 means "right after the previous entry", which the first entry has none of
+		switch {
+		case v == 0 && i == 0:
+			return nil, fmt.Errorf("invalid pmtiles directory: first entry has no offset")
+		case v == 0:
+			entries[i].Offset = entries[i-1].Offset + entries[i-1].Length
+		default:
+			entries[i].Offset = v - 1
+		}
+	}
+	return entries, nil
+}
+
+// findPMTilesEntry returns the entry covering tile id: the last entry with TileID <= id,
+// if it's a leaf pointer or its run includes id.
+func findPMTilesEntry(entries []pmtilesEntry, id uint64) (pmtilesEntry, bool) {
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].TileID > id }) - 1
+	if i < 0 {
+		return pmtilesEntry{}, false
+	}
+	e := entries[i]
+	if e.RunLength == 0 || id < e.TileID+e.RunLength {
+		return e, true
+	}
+	return pmtilesEntry{}, false
+}
+
+// leaf returns a leaf directory, reading it on first use.
+func (p *PMTiles) leaf(offset, length uint64) ([]pmtilesEntry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if dir, ok := p.leaves[offset]; ok {
+		return dir, nil
+	}
+	dir, err := p.readDirectory(p.leafOffset+offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.leaves) >= pmtilesLeafCache {
+		clear(p.leaves)
+	}
+	p.leaves[offset] = dir
+	return dir, nil
+}
+
+// Tile returns the tile at z/x/y, or nil if the archive doesn't have it.
+func (p *PMTiles) Tile(z, x, y int) ([]byte, error) {
+	if z < p.info.MinZoom || z > p.info.MaxZoom {
+		return nil, nil
+	}
+	id := ZXYToTileID(z, x, y)
+	dir := p.root
+	for depth := 0; depth < pmtilesMaxDepth; depth++ {
+		e, ok := findPMTilesEntry(dir, id)
+		if !ok {
+			return nil, nil
+		}
+		if e.RunLength > 0 {
+			data := make([]byte, e.Length)
+			if _, err := p.f.ReadAt(data, int64(p.dataOffset+e.Offset)); err != nil {
+				return nil, fmt.Errorf("failed to read tile: %w", err)
+			}
+			return data, nil
+		}
+		var err error
+		if dir, err = p.leaf(e.Offset, e.Length); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("pmtiles directories nested too deep")
+}
+
+// ZXYToTileID returns the PMTiles tile ID of z/x/y: the number of tiles at lower zooms
+// plus the tile's position along a Hilbert curve at its zoom.
+func ZXYToTileID(z, x, y int) uint64 {
+	var acc uint64
+	for t := 0; t < z; t++ {
+		acc += uint64(1) << (2 * t)
+	}
+	n := uint64(1) << z
+	tx, ty := uint64(x), uint64(y)
+	var d uint64
+	for s := n / 2; s > 0; s /= 2 {
+		var rx, ry uint64
+		if tx&s > 0 {
+			rx = 1
+		}
+		if ty&s > 0 {
+			ry = 1
+		}
+		d += s * s * ((3 * rx) ^ ry)
+		// Rotate the quadrant so the curve stays continuous
+		if ry == 0 {
+			if rx == 1 {
+				tx, ty = n-1-tx, n-1-ty
+			}
+			tx, ty = ty, tx
+		}
+	}
+	return acc + d
+}
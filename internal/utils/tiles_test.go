@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestZXYToTileID(t *testing.T) {
+	tests := []struct {
+		z, x, y int
+		want    uint64
+	}{
+		{0, 0, 0, 0},
+		// Zoom 1 follows the Hilbert curve counter-clockwise from the top left
+		{1, 0, 0, 1},
+		{1, 0, 1, 2},
+		{1, 1, 1, 3},
+		{1, 1, 0, 4},
+		{2, 0, 0, 5},
+		{2, 3, 0, 20}, // last tile of zoom 2
+		{3, 0, 0, 21},
+		{3, 7, 0, 84},
+		{12, 3423, 1763, 19078479}, // from the PMTiles specification's test suite
+	}
+	for _, tt := range tests {
+		if got := ZXYToTileID(tt.z, tt.x, tt.y); got != tt.want {
+			t.Errorf("ZXYToTileID(%d, %d, %d) = %d, want %d", tt.z, tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+// encodePMTilesDirectory is the inverse of decodePMTilesDirectory, writing an offset of
+// 0 for entries that directly follow the previous one.
+func encodePMTilesDirectory(entries []pmtilesEntry) []byte {
+	var raw []byte
+	raw = binary.AppendUvarint(raw, uint64(len(entries)))
+	var last uint64
+	for _, e := range entries {
+		raw = binary.AppendUvarint(raw, e.TileID-last)
+		last = e.TileID
+	}
+	for _, e := range entries {
+		raw = binary.AppendUvarint(raw, e.RunLength)
+	}
+	for _, e := range entries {
+		raw = binary.AppendUvarint(raw, e.Length)
+	}
+	for i, e := range entries {
+		if i > 0 && e.Offset == entries[i-1].Offset+entries[i-1].Length {
+			raw = binary.AppendUvarint(raw, 0)
+		} else {
+			raw = binary.AppendUvarint(raw, e.Offset+1)
+		}
+	}
+	return raw
+}
+
+func TestPMTilesDirectory(t *testing.T) {
+	entries := []pmtilesEntry{
+		{TileID: 0, Offset: 0, Length: 100, RunLength: 1},
+		{TileID: 1, Offset: 100, Length: 50, RunLength: 3},  // tiles 1-3 share the data
+		{TileID: 10, Offset: 0, Length: 100, RunLength: 1},  // same data as tile 0
+		{TileID: 20, Offset: 400, Length: 80, RunLength: 0}, // leaf directory from 20 on
+	}
+	dir, err := decodePMTilesDirectory(encodePMTilesDirectory(entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dir) != len(entries) {
+		t.Fatalf("decoded %d entries, want %d", len(dir), len(entries))
+	}
+	for i := range entries {
+		if dir[i] != entries[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, dir[i], entries[i])
+		}
+	}
+
+	tests := []struct {
+		id     uint64
+		want   uint64 // TileID of the entry found
+		wantOK bool
+	}{
+		{0, 0, true},
+		{1, 1, true},
+		{3, 1, true},
+		{4, 0, false}, // past the run
+		{9, 0, false},
+		{10, 10, true},
+		{11, 0, false},
+		{20, 20, true},
+		{1000, 20, true}, // leaf directories cover everything after them
+	}
+	for _, tt := range tests {
+		e, ok := findPMTilesEntry(dir, tt.id)
+		if ok != tt.wantOK || (ok && e.TileID != tt.want) {
+			t.Errorf("findPMTilesEntry(%d) = %d, %v; want %d, %v", tt.id, e.TileID, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	if _, err := decodePMTilesDirectory([]byte{1, 0, 1, 10, 0}); err == nil {
+		t.Error("decoded a directory whose first entry has no offset")
+	}
+}
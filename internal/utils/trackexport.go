@@ -0,0 +1,390 @@
+package utils
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// ExportTrack is one activity handed to a TrackWriter: its track split into parts at
+// pauses and privacy zones.
+type ExportTrack struct {
+	ID    string
+	Name  string
+	Sport string
+	Start time.Time
+	Parts [][]models.Record
+}
+
+// TrackWriter writes activities one at a time in an export format, so multi-activity
+// exports don't hold every record stream in memory. Close finishes the document.
+type TrackWriter interface {
+	WriteTrack(t ExportTrack) error
+	Close() error
+}
+
+// exportElevation is a record's elevation rounded to 0.1 m: the device's, or the
+// terrain model's when the device had none.
+func exportElevation(r models.Record) *float64 {
+	alt := r.Altitude
+	if alt == nil {
+		alt = r.DEMAltitude
+	}
+	if alt == nil {
+		return nil
+	}
+	ele := math.Round(*alt*10) / 10
+	return &ele
+}
+
+// geojsonWriter writes a GeoJSON Feature, or a FeatureCollection of them.
+type geojsonWriter struct {
+	w          io.Writer
+	collection bool
+	n          int
+}
+
+// NewGeoJSONWriter returns a writer of GeoJSON: a single Feature, or with collection a
+// FeatureCollection of one Feature per activity.
+func NewGeoJSONWriter(w io.Writer, collection bool) TrackWriter {
+	return &geojsonWriter{w: w, collection: collection}
+}
+
+// geojsonFeature builds the feature of an activity: a LineString, or MultiLineString
+// with several parts, of [lon, lat(, ele)] positions. Per-point data follows the
+// coordinateProperties convention of togeojson: arrays shaped like the coordinates,
+// with null where a channel has no value.
+func geojsonFeature(t ExportTrack) map[string]any {
+	var coords [][][]float64
+	props := map[string][][]any{}
+	channels := []string{"times", "distances", "speeds", "heartRates", "cadences", "powers"}
+	for _, part := range t.Parts {
+		var line [][]float64
+		values := map[string][]any{}
+		for _, r := range part {
+			if !r.HasPosition() {
+				continue
+			}
+			pos := []float64{r.Lon, r.Lat}
+			if ele := exportElevation(r); ele != nil {
+				pos = append(pos, *ele)
+			}
+			line = append(line, pos)
+			values["times"] = append(values["times"], r.Time.UTC().Format(time.RFC3339))
+			values["distances"] = append(values["distances"], math.Round(r.Distance*10)/10)
+			values["speeds"] = append(values["speeds"], math.Round(r.Speed*1000)/1000)
+			values["heartRates"] = append(values["heartRates"], nonZero(r.HeartRate))
+			values["cadences"] = append(values["cadences"], nonZero(r.Cadence))
+			values["powers"] = append(values["powers"], nonZero(r.Power))
+		}
+		if len(line) < 2 {
+			continue
+		}
+		coords = append(coords, line)
+		for _, c := range channels {
+			props[c] = append(props[c], values[c])
+		}
+	}
+
+	var geometry map[string]any
+	coordProps := map[string]any{}
+	switch len(coords) {
+	case 0: // entirely hidden or without positions: a feature with null geometry
+	case 1:
+		geometry = map[string]any{"type": "LineString", "coordinates": coords[0]}
+		for _, c := range channels {
+			coordProps[c] = props[c][0]
+		}
+	default:
+		geometry = map[string]any{"type": "MultiLineString", "coordinates": coords}
+		for _, c := range channels {
+			coordProps[c] = props[c]
+		}
+	}
+	return map[string]any{
+		"type":     "Feature",
+		"id":       t.ID,
+		"geometry": geometry,
+		"properties": map[string]any{
+			"name":                 t.Name,
+			"sport":                t.Sport,
+			"time":                 t.Start.UTC().Format(time.RFC3339),
+			"coordinateProperties": coordProps,
+		},
+	}
+}
+
+// nonZero returns v, or nil for a channel the device didn't record.
+func nonZero[T uint8 | uint16](v T) any {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
+
+func (g *geojsonWriter) WriteTrack(t ExportTrack) error {
+	feature, err := json.Marshal(geojsonFeature(t))
+	if err != nil {
+		return fmt.Errorf("failed to encode geojson: %w", err)
+	}
+	if g.collection {
+		sep := ","
+		if g.n == 0 {
+			sep = `{"type":"FeatureCollection","features":[`
+		}
+		if _, err := io.WriteString(g.w, sep); err != nil {
+			return err
+		}
+	}
+	g.n++
+	_, err = g.w.Write(feature)
+	return err
+}
+
+func (g *geojsonWriter) Close() error {
+	if !g.collection {
+		return nil
+	}
+	end := "]}\n"
+	if g.n == 0 {
+		end = `{"type":"FeatureCollection","features":[]}` + "\n"
+	}
+	_, err := io.WriteString(g.w, end)
+	return err
+}
+
+// KML namespaces and the schema of the per-point data in exported documents.
+const (
+	kmlNamespace   = "http://www.opengis.net/kml/2.2"
+	kmlGxNamespace = "http://www.google.com/kml/ext/2.2"
+	kmlSchemaID    = "ownpath"
+)
+
+// kmlPlacemark is one activity as a gx:MultiTrack with a gx:Track per part, which Google
+// Earth animates with its time slider.
+type kmlPlacemark struct {
+	XMLName     xml.Name `xml:"Placemark"`
+	Name        string   `xml:"name"`
+	Description string   `xml:"description,omitempty"`
+	TimeSpan    struct {
+		Begin string `xml:"begin"`
+		End   string `xml:"end"`
+	} `xml:"TimeSpan"`
+	StyleURL string `xml:"styleUrl"`
+	Track    struct {
+		Interpolate int        `xml:"gx:interpolate"`
+		Tracks      []kmlTrack `xml:"gx:Track"`
+	} `xml:"gx:MultiTrack"`
+}
+
+type kmlTrack struct {
+	When         []string         `xml:"when"`
+	Coord        []string         `xml:"gx:coord"`
+	ExtendedData *kmlExtendedData `xml:"ExtendedData,omitempty"`
+}
+
+type kmlExtendedData struct {
+	SchemaData struct {
+		SchemaURL string         `xml:"schemaUrl,attr"`
+		Arrays    []kmlArrayData `xml:"gx:SimpleArrayData"`
+	} `xml:"SchemaData"`
+}
+
+type kmlArrayData struct {
+	Name   string   `xml:"name,attr"`
+	Values []string `xml:"gx:value"`
+}
+
+// kmlTrackOf converts one part to a gx:Track, with the sensor channels it has as
+// SimpleArrayData. Returns nil for parts without positions.
+func kmlTrackOf(part []models.Record) *kmlTrack {
+	var trk kmlTrack
+	channels := []struct {
+		name  string
+		value func(models.Record) int
+	}{
+		{"heartrate", func(r models.Record) int { return int(r.HeartRate) }},
+		{"cadence", func(r models.Record) int { return int(r.Cadence) }},
+		{"power", func(r models.Record) int { return int(r.Power) }},
+	}
+	arrays := make([]kmlArrayData, len(channels))
+	present := make([]bool, len(channels))
+	for _, r := range part {
+		if !r.HasPosition() {
+			continue
+		}
+		trk.When = append(trk.When, r.Time.UTC().Format(time.RFC3339))
+		coord := strconv.FormatFloat(r.Lon, 'f', -1, 64) + " " + strconv.FormatFloat(r.Lat, 'f', -1, 64)
+		if ele := exportElevation(r); ele != nil {
+			coord += " " + strconv.FormatFloat(*ele, 'f', -1, 64)
+		}
+		trk.Coord = append(trk.Coord, coord)
+		for i, c := range channels {
+			v := c.value(r)
+			arrays[i].Values = append(arrays[i].Values, strconv.Itoa(v))
+			present[i] = present[i] || v > 0
+		}
+	}
+	if len(trk.Coord) < 2 {
+		return nil
+	}
+	for i, c := range channels {
+		if !present[i] {
+			continue
+		}
+		if trk.ExtendedData == nil {
+			trk.ExtendedData = &kmlExtendedData{}
+			trk.ExtendedData.SchemaData.SchemaURL = "#" + kmlSchemaID
+		}
+		arrays[i].Name = c.name
+		trk.ExtendedData.SchemaData.Arrays = append(trk.ExtendedData.SchemaData.Arrays, arrays[i])
+	}
+	return &trk
+}
+
+// kmlWriter writes a KML document with a placemark per activity.
+type kmlWriter struct {
+	w       io.Writer
+	enc     *xml.Encoder
+	name    string
+	started bool
+}
+
+// NewKMLWriter returns a writer of a KML 2.2 document named name.
+func NewKMLWriter(w io.Writer, name string) TrackWriter {
+	enc := xml.NewEncoder(w)
+	enc.Indent("  ", " ")
+	return &kmlWriter{w: w, enc: enc, name: name}
+}
+
+// start writes the document head: the shared line style and the schema of the
+// per-point arrays.
+func (k *kmlWriter) start() error {
+	if k.started {
+		return nil
+	}
+	k.started = true
+	var name string
+	if k.name != "" {
+		var sb strings.Builder
+		xml.EscapeText(&sb, []byte(k.name))
+		name = "\n  <name>" + sb.String() + "</name>"
+	}
+	_, err := fmt.Fprintf(k.w, `%s<kml xmlns="%s" xmlns:gx="%s">
+ <Document>%s
+  <Style id="track"><LineStyle><color>ffd27619</color><width>3</width></LineStyle></Style>
+  <Schema id="%s">
+   <gx:SimpleArrayField name="heartrate" type="int"><displayName>Heart rate</displayName></gx:SimpleArrayField>
+   <gx:SimpleArrayField name="cadence" type="int"><displayName>Cadence</displayName></gx:SimpleArrayField>
+   <gx:SimpleArrayField name="power" type="int"><displayName>Power</displayName></gx:SimpleArrayField>
+  </Schema>
+`, xml.Header, kmlNamespace, kmlGxNamespace, name, kmlSchemaID)
+	return err
+}
+
+func (k *kmlWriter) WriteTrack(t ExportTrack) error {
+	if err := k.start(); err != nil {
+		return err
+	}
+	pm := kmlPlacemark{Name: t.Name, Description: t.Sport, StyleURL: "#track"}
+	for _, part := range t.Parts {
+		if trk := kmlTrackOf(part); trk != nil {
+			pm.Track.Tracks = append(pm.Track.Tracks, *trk)
+		}
+	}
+	if len(pm.Track.Tracks) == 0 {
+		return nil
+	}
+	first := pm.Track.Tracks[0]
+	last := pm.Track.Tracks[len(pm.Track.Tracks)-1]
+	pm.TimeSpan.Begin, pm.TimeSpan.End = first.When[0], last.When[len(last.When)-1]
+	if err := k.enc.Encode(pm); err != nil {
+		return fmt.Errorf("failed to encode kml: %w", err)
+	}
+	return k.enc.Flush()
+}
+
+func (k *kmlWriter) Close() error {
+	if err := k.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(k.w, "\n </Document>\n</kml>\n")
+	return err
+}
+
+// csvWriter writes the full record stream of activities, one row per record.
+type csvWriter struct {
+	w       *csv.Writer
+	started bool
+}
+
+// csvHeader is the first row of CSV exports. Empty cells mean no value.
+var csvHeader = []string{"activity_id", "time", "latitude", "longitude", "altitude", "dem_altitude",
+	"distance", "speed", "heart_rate", "cadence", "power", "temperature"}
+
+// NewCSVWriter returns a writer of CSV with a header row and a row per record.
+func NewCSVWriter(w io.Writer) TrackWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+// header writes the header row before the first record.
+func (c *csvWriter) header() error {
+	if c.started {
+		return nil
+	}
+	c.started = true
+	return c.w.Write(csvHeader)
+}
+
+func (c *csvWriter) WriteTrack(t ExportTrack) error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	optFloat := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', 2, 64)
+	}
+	optInt := func(v int) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.Itoa(v)
+	}
+	for _, part := range t.Parts {
+		for _, r := range part {
+			row := []string{t.ID, r.Time.UTC().Format(time.RFC3339), "", "",
+				optFloat(r.Altitude), optFloat(r.DEMAltitude),
+				strconv.FormatFloat(r.Distance, 'f', 2, 64), strconv.FormatFloat(r.Speed, 'f', 3, 64),
+				optInt(int(r.HeartRate)), optInt(int(r.Cadence)), optInt(int(r.Power)), ""}
+			if r.HasPosition() {
+				row[2], row[3] = strconv.FormatFloat(r.Lat, 'f', 7, 64), strconv.FormatFloat(r.Lon, 'f', 7, 64)
+			}
+			if r.Temperature != nil {
+				row[11] = strconv.Itoa(int(*r.Temperature))
+			}
+			if err := c.w.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,57 @@
+package utils
+
+import "fmt"
+
+// Unit systems accepted by the "units" setting.
+const (
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+)
+
+const metersPerMile = 1609.344
+
+// ValidUnits reports whether units names a supported unit system.
+func ValidUnits(units string) bool {
+	return units == UnitsMetric || units == UnitsImperial
+}
+
+// UnitLength returns the length in meters of the unit system's distance unit (km or mile).
+func UnitLength(units string) float64 {
+	if units == UnitsImperial {
+		return metersPerMile
+	}
+	return 1000
+}
+
+// DistanceLabel returns the short name of the unit system's distance unit.
+func DistanceLabel(units string) string {
+	if units == UnitsImperial {
+		return "mi"
+	}
+	return "km"
+}
+
+// FormatDistance renders meters in the unit system's distance unit.
+func FormatDistance(meters float64, units string) string {
+	return fmt.Sprintf("%.2f %s", meters/UnitLength(units), DistanceLabel(units))
+}
+
+// FormatSpeed renders a speed in m/s as km/h or mph.
+func FormatSpeed(mps float64, units string) string {
+	if units == UnitsImperial {
+		return fmt.Sprintf("%.1f mph", mps*3600/metersPerMile)
+	}
+	return fmt.Sprintf("%.1f km/h", mps*3.6)
+}
+
+// FormatSpeedOrPace renders a speed in m/s as pace per distance unit for pace sports
+// and as speed for everything else.
+func FormatSpeedOrPace(mps float64, sport, units string) string {
+	if mps <= 0 {
+		return "-"
+	}
+	if IsPaceSport(sport) {
+		return FormatPace(UnitLength(units)/mps) + " /" + DistanceLabel(units)
+	}
+	return FormatSpeed(mps, units)
+}
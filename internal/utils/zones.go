@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gratten/ownpath/internal/models"
+)
+
+// HRZone is one heart-rate zone; Min is inclusive and Max exclusive (bpm).
+// The top zone has Max 0, meaning unbounded.
+type HRZone struct {
+	Name string `json:"name"`
+	Min  int    `json:"min"`
+	Max  int    `json:"max"`
+}
+
+// Zone boundaries as fractions of the model's reference value.
+var (
+	percentZoneBounds = []float64{0.6, 0.7, 0.8, 0.9}
+	frielZoneBounds   = []float64{0.85, 0.90, 0.95, 1.00, 1.03, 1.06}
+	frielZoneNames    = []string{"Z1", "Z2", "Z3", "Z4", "Z5a", "Z5b", "Z5c"}
+)
+
+// HRZones returns the zones defined by a heart-rate profile. Zone 1 starts at 0 so
+// easy efforts below the model's lower bound still count towards it.
+func HRZones(p models.HRProfile) []HRZone {
+	var bounds []int
+	var names []string
+	switch p.Model {
+	case models.ZoneModelHRR:
+		reserve := float64(p.MaxHR - p.RestingHR)
+		for _, f := range percentZoneBounds {
+			bounds = append(bounds, int(math.Round(float64(p.RestingHR)+f*reserve)))
+		}
+	case models.ZoneModelLTHR:
+		for _, f := range frielZoneBounds {
+			bounds = append(bounds, int(math.Round(f*float64(p.LTHR))))
+		}
+		names = frielZoneNames
+	default:
+		for _, f := range percentZoneBounds {
+			bounds = append(bounds, int(math.Round(f*float64(p.MaxHR))))
+		}
+	}
+
+	zones := make([]HRZone, len(bounds)+1)
+	for i := range zones {
+		zones[i].Name = fmt.Sprintf("Z%d", i+1)
+		if names != nil {
+			zones[i].Name = names[i]
+		}
+		if i > 0 {
+			zones[i].Min = bounds[i-1]
+		}
+		if i < len(bounds) {
+			zones[i].Max = bounds[i]
+		}
+	}
+	return zones
+}
+
+// ZoneIndex returns the zone containing hr.
+func ZoneIndex(zones []HRZone, hr int) int {
+	for i, z := range zones {
+		if z.Max == 0 || hr < z.Max {
+			return i
+		}
+	}
+	return len(zones) - 1
+}
+
+// TimeInZones sums the seconds spent in each zone. Each interval between records is
+// credited to the zone of its closing heart-rate sample; auto-pause gaps are skipped.
+func TimeInZones(records []models.Record, zones []HRZone) []float64 {
+	seconds := make([]float64, len(zones))
+	if len(zones) == 0 {
+		return seconds
+	}
+	for i := 1; i < len(records); i++ {
+		hr := records[i].HeartRate
+		dt := records[i].Time.Sub(records[i-1].Time)
+		if hr == 0 || dt <= 0 || dt > autoPauseGap {
+			continue
+		}
+		seconds[ZoneIndex(zones, int(hr))] += dt.Seconds()
+	}
+	return seconds
+}
+
+// HasHeartRate reports whether any record carries a heart-rate sample.
+func HasHeartRate(records []models.Record) bool {
+	for _, r := range records {
+		if r.HeartRate > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+// Package web holds the dashboard pages and their vendored assets, embedded so the
+// binary serves them without a web directory next to it.
+package web
+
+import "embed"
+
+//go:generate sh vendor/fetch.sh
+
+// FS is the embedded web root: the pages, styles, scripts and everything in vendor/.
+//
+//go:embed *.html *.css *.js vendor
+var FS embed.FS
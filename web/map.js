@@ -0,0 +1,81 @@
+// Adds the configured base map to a Leaflet map: local tiles from /tiles when the server
+// has a tile file, OpenStreetMap otherwise, none when online maps are switched off.
+// Returns a promise of the tile layer (null without a base map).
+function addBaseLayer(map) {
+    return fetch('/api/map-config')
+        .then(function (res) { return res.json(); })
+        .catch(function () {
+            return {
+                url: 'https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png',
+                attribution: '&copy; <a href="https://www.openstreetmap.org/copyright">OpenStreetMap</a> contributors',
+                maxZoom: 19
+            };
+        })
+        .then(function (cfg) {
+            if (!cfg.url) return null;
+            const opts = { attribution: cfg.attribution || '', maxZoom: cfg.maxZoom || 19 };
+            if (cfg.minZoom !== undefined) opts.minZoom = cfg.minZoom;
+            const layer = L.tileLayer(cfg.url, opts).addTo(map);
+            layer.bringToBack();
+            return layer;
+        });
+}
+
+// Decodes a Google encoded polyline into [lat, lon] pairs.
+function decodePolyline(str) {
+    const points = [];
+    let i = 0, lat = 0, lon = 0;
+    function next() {
+        let result = 0, shift = 0, b;
+        do {
+            b = str.charCodeAt(i++) - 63;
+            result |= (b & 0x1f) << shift;
+            shift += 5;
+        } while (b >= 0x20 && i < str.length);
+        return (result & 1) ? ~(result >> 1) : (result >> 1);
+    }
+    while (i < str.length) {
+        lat += next();
+        lon += next();
+        points.push([lat / 1e5, lon / 1e5]);
+    }
+    return points;
+}
+
+// Draws an activity track served by /api/activities/{id}/track on a Leaflet map and fits
+// the map to it. The simplified track for the current zoom is fetched again whenever the
+// zoom leaves the range the loaded one was made for. With markers, the start and end
+// are marked. Returns the layer group.
+function addTrackLayer(map, url, markers) {
+    const layer = L.featureGroup().addTo(map);
+    let loaded = null; // zoom range of the loaded track
+    function load(zoom, fit) {
+        const sep = url.indexOf('?') >= 0 ? '&' : '?';
+        return fetch(url + sep + 'zoom=' + zoom)
+            .then(function (res) { return res.json(); })
+            .then(function (track) {
+                loaded = track;
+                layer.clearLayers();
+                const parts = track.parts.map(decodePolyline);
+                parts.forEach(function (p) {
+                    L.polyline(p, { color: '#1976d2', weight: 3 }).addTo(layer);
+                });
+                if (markers && parts.length > 0) {
+                    const last = parts[parts.length - 1];
+                    L.circleMarker(parts[0][0], { radius: 6, color: '#2e7d32', fillOpacity: 1 }).addTo(layer);
+                    L.circleMarker(last[last.length - 1], { radius: 6, color: '#c62828', fillOpacity: 1 }).addTo(layer);
+                }
+                if (fit && layer.getBounds().isValid()) map.fitBounds(layer.getBounds());
+            });
+    }
+    function refresh() {
+        const z = map.getZoom();
+        if (!loaded || z < loaded.minZoom || z > loaded.maxZoom) load(z, false);
+    }
+    // Fitting can finish its zoom before the listener exists, so check the zoom reached once
+    load(0, true).then(function () {
+        map.on('zoomend', refresh);
+        refresh();
+    });
+    return layer;
+}